@@ -1,3 +1,41 @@
 package _const
 
+import "time"
+
 var BuffSize int = 64
+
+// RepliesPreview -- сколько ответов показывается под корневым постом в режиме threaded
+var RepliesPreview int = 3
+
+// RepliesPage -- размер страницы /post/{id}/replies по умолчанию
+var RepliesPage int = 20
+
+// FeedPage -- размер страницы /user/{nickname}/feed по умолчанию
+var FeedPage int = 20
+
+// StatsTop -- длина топов авторов и тем в /forum/{slug}/stats
+var StatsTop int = 10
+
+// StatsMaxBuckets -- сколько интервалов можно запросить в /forum/{slug}/stats за раз
+var StatsMaxBuckets int = 1000
+
+// HotHalfLife -- период полураспада hot_score темы, переопределяется HOT_HALF_LIFE
+var HotHalfLife = 12 * time.Hour
+
+// HotRecomputeEvery -- как часто фоновая задача пересчитывает hot_score
+var HotRecomputeEvery = time.Minute
+
+// MaxThreadTags -- сколько тегов может быть у темы
+var MaxThreadTags int = 10
+
+// MaxTagLen -- ограничение на длину тега в символах
+var MaxTagLen int = 32
+
+// MaxPollOptions -- сколько вариантов ответа может быть в опросе
+var MaxPollOptions int = 20
+
+// MaxConversationMembers -- сколько участников может быть в личной беседе, включая автора
+var MaxConversationMembers int = 10
+
+// MessagesPage -- размер страницы личных сообщений и бесед по умолчанию
+var MessagesPage int = 50
@@ -18,27 +18,43 @@ CREATE TABLE forums
     title       text                                NOT NULL,
     responsible citext REFERENCES users (nick_name) NOT NULL,
     post_num    integer                             NOT NULL DEFAULT 0,
-    thread_num  integer                             NOT NULL DEFAULT 0
+    thread_num  integer                             NOT NULL DEFAULT 0,
+    parent      citext REFERENCES forums (slug)     NULL,
+    type        text                                NOT NULL DEFAULT 'discussion',
+    visibility  text                                NOT NULL DEFAULT 'public',
+    CHECK ( type IN ('discussion', 'qa') ),
+    CHECK ( visibility IN ('public', 'private', 'read_only') )
 );
 
 CREATE INDEX forums__post_num__idx ON forums (post_num);
+CREATE INDEX forums__parent__idx ON forums (parent) WHERE parent IS NOT NULL;
 
 
 DROP TABLE IF EXISTS threads CASCADE;
 CREATE TABLE threads
 (
-    id       serial PRIMARY KEY,
-    author   citext REFERENCES users (nick_name) NOT NULL,
-    forum    citext REFERENCES forums (slug)     NOT NULL,
-    created  timestamptz                         NOT NULL DEFAULT now(),
-    message  text                                NOT NULL,
-    slug     citext                              NULL,
-    title    text                                NOT NULL,
-    vote_num integer                                      default 0 NOT NULL
+    id           serial PRIMARY KEY,
+    author       citext REFERENCES users (nick_name) NOT NULL,
+    forum        citext REFERENCES forums (slug)     NOT NULL,
+    created      timestamptz                         NOT NULL DEFAULT now(),
+    message      text                                NOT NULL,
+    slug         citext                              NULL,
+    title        text                                NOT NULL,
+    vote_num     integer                                      default 0 NOT NULL,
+    locked       bool                                         default false NOT NULL,
+    pinned       bool                                         default false NOT NULL,
+    closed       bool                                         default false NOT NULL,
+    close_reason text                                NULL,
+    message_html text                                         default '' NOT NULL,
+    post_num     integer                                      default 0 NOT NULL,
+    hot_score    double precision                             default 0 NOT NULL, -- см. thread_hot_init
+    tags         text[]                                       default '{}' NOT NULL, -- в нижнем регистре
+    accepted_post integer                                     NULL, -- корневой пост-ответ в qa-форуме
+    hidden       bool                                         default false NOT NULL -- задержана фильтром
 );
 
 DROP INDEX IF EXISTS threads__slug__idx__not_null;
-CREATE INDEX threads__slug__idx__not_null ON threads (slug) WHERE slug IS NOT NULL;
+CREATE UNIQUE INDEX threads__slug__idx__not_null ON threads (slug) WHERE slug IS NOT NULL;
 
 DROP INDEX IF EXISTS threads__created__idx;
 CREATE INDEX threads__created__idx ON threads (created);
@@ -46,6 +62,15 @@ CREATE INDEX threads__created__idx ON threads (created);
 DROP INDEX IF EXISTS threads__forum__hidx;
 CREATE INDEX threads__forum__hidx ON threads USING hash (forum);
 
+DROP INDEX IF EXISTS threads__tags__gin;
+CREATE INDEX threads__tags__gin ON threads USING gin (tags);
+
+DROP INDEX IF EXISTS threads__hot__idx;
+CREATE INDEX threads__hot__idx ON threads (hot_score DESC, id DESC);
+
+DROP INDEX IF EXISTS threads__forum_hot__idx;
+CREATE INDEX threads__forum_hot__idx ON threads (forum, hot_score DESC, id DESC);
+
 
 
 DROP TABLE IF EXISTS votes;
@@ -58,6 +83,9 @@ CREATE TABLE votes
     CHECK ( voice = 1 OR voice = -1)
 );
 
+DROP INDEX IF EXISTS votes__thread_author__idx;
+CREATE INDEX votes__thread_author__idx ON votes (thread, author);
+
 
 
 DROP TABLE IF EXISTS posts CASCADE;
@@ -71,10 +99,19 @@ CREATE TABLE posts
     parent    integer REFERENCES posts (id)                DEFAULT NULL,
     thread    integer REFERENCES threads (id)     NOT NULL,
     forum     citext REFERENCES forums (SLUG)     NOT NULL,
-    path      integer[]
+    path      integer[],
+    vote_num  integer                                      DEFAULT 0 NOT NULL,
+    reactions jsonb                                        DEFAULT '{}' NOT NULL,
+    hidden    bool                                         DEFAULT FALSE NOT NULL,
+    -- message, отрисованный из CommonMark при записи
+    message_html text                                      DEFAULT '' NOT NULL,
+    num       integer                                      DEFAULT 0 NOT NULL -- порядковый номер в теме
 );
 DROP INDEX IF EXISTS posts__author__idx;
-CREATE INDEX posts__author__idx ON posts (author);
+CREATE INDEX posts__author__idx ON posts (author, id);
+
+DROP INDEX IF EXISTS threads__author_created__idx;
+CREATE INDEX threads__author_created__idx ON threads (author, created);
 
 
 DROP INDEX IF EXISTS posts__thread_path__idx;
@@ -92,6 +129,210 @@ CREATE INDEX posts__thread_created_id__idx ON posts (thread, created);
 -- DROP INDEX IF EXISTS posts__created__idx;
 -- CREATE INDEX if not exists posts__created__idx ON posts(thread, created, id);
 
+DROP TABLE IF EXISTS post_votes;
+CREATE TABLE post_votes
+(
+    author citext REFERENCES users (nick_name) NOT NULL,
+    post   integer REFERENCES posts (id)       NOT NULL,
+    voice  integer                             NOT NULL,
+    PRIMARY KEY (author, post),
+    CHECK ( voice = 1 OR voice = -1)
+);
+
+
+DROP TABLE IF EXISTS post_reactions;
+CREATE TABLE post_reactions
+(
+    author citext REFERENCES users (nick_name) NOT NULL,
+    post   integer REFERENCES posts (id)       NOT NULL,
+    emoji  text                                NOT NULL,
+    PRIMARY KEY (author, post, emoji)
+);
+
+
+DROP TABLE IF EXISTS post_reports;
+CREATE TABLE post_reports
+(
+    id          serial PRIMARY KEY,
+    post        integer REFERENCES posts (id)       NOT NULL,
+    forum       citext REFERENCES forums (slug)     NOT NULL,
+    reporter    citext REFERENCES users (nick_name) NULL, -- null -- пост задержан фильтром
+    reason      text                                NOT NULL,
+    created     timestamptz                         NOT NULL DEFAULT now(),
+    status      text                                NOT NULL DEFAULT 'open',
+    resolved_by citext REFERENCES users (nick_name) NULL,
+    resolved_at timestamptz                         NULL,
+    UNIQUE (post, reporter),
+    CHECK ( status IN ('open', 'dismissed', 'hidden', 'banned') )
+);
+
+DROP INDEX IF EXISTS post_reports__forum_status__idx;
+CREATE INDEX post_reports__forum_status__idx ON post_reports (forum, status, id);
+
+
+DROP TABLE IF EXISTS mentions;
+CREATE TABLE mentions
+(
+    id        serial PRIMARY KEY,
+    post      integer REFERENCES posts (id)       NOT NULL,
+    user_nick citext REFERENCES users (nick_name) NOT NULL,
+    read      bool                                NOT NULL DEFAULT false,
+    UNIQUE (post, user_nick)
+);
+
+DROP INDEX IF EXISTS mentions__user_id__idx;
+CREATE INDEX mentions__user_id__idx ON mentions (user_nick, id);
+
+
+DROP TABLE IF EXISTS thread_subscriptions;
+CREATE TABLE thread_subscriptions
+(
+    user_nick citext REFERENCES users (nick_name) NOT NULL,
+    thread    integer REFERENCES threads (id)     NOT NULL,
+    created   timestamptz                         NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_nick, thread)
+);
+
+DROP TABLE IF EXISTS forum_subscriptions;
+CREATE TABLE forum_subscriptions
+(
+    user_nick citext REFERENCES users (nick_name) NOT NULL,
+    forum     citext REFERENCES forums (slug)     NOT NULL,
+    created   timestamptz                         NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_nick, forum)
+);
+
+DROP INDEX IF EXISTS threads__forum_created__idx;
+CREATE INDEX threads__forum_created__idx ON threads (forum, created);
+
+
+DROP TABLE IF EXISTS thread_reads;
+CREATE TABLE thread_reads
+(
+    user_nick citext REFERENCES users (nick_name) NOT NULL,
+    thread    integer REFERENCES threads (id)     NOT NULL,
+    last_read integer REFERENCES posts (id)       NOT NULL,
+    read_num  integer                             NOT NULL, -- posts.num последнего прочитанного поста
+    updated   timestamptz                         NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_nick, thread)
+);
+
+DROP INDEX IF EXISTS posts__created__idx;
+CREATE INDEX posts__created__idx ON posts (created);
+
+
+-- перенос темы в другой форум, по ним в старом форуме показывается заглушка
+DROP TABLE IF EXISTS thread_moves;
+CREATE TABLE thread_moves
+(
+    id         serial PRIMARY KEY,
+    thread     integer REFERENCES threads (id)     NOT NULL,
+    from_forum citext REFERENCES forums (slug)     NOT NULL,
+    to_forum   citext REFERENCES forums (slug)     NOT NULL,
+    moved_by   citext REFERENCES users (nick_name) NOT NULL,
+    created    timestamptz                         NOT NULL DEFAULT now()
+);
+
+DROP INDEX IF EXISTS thread_moves__from_forum__idx;
+CREATE INDEX thread_moves__from_forum__idx ON thread_moves (from_forum, thread);
+
+
+-- слаг и id влитой темы продолжают открывать тему, в которую её влили
+DROP TABLE IF EXISTS thread_redirects;
+CREATE TABLE thread_redirects
+(
+    from_id   integer PRIMARY KEY,
+    from_slug citext                          NULL,
+    thread    integer REFERENCES threads (id) NOT NULL
+);
+
+DROP INDEX IF EXISTS thread_redirects__from_slug__idx;
+CREATE INDEX thread_redirects__from_slug__idx ON thread_redirects (from_slug) WHERE from_slug IS NOT NULL;
+
+DROP INDEX IF EXISTS posts__thread_id__idx;
+CREATE INDEX posts__thread_id__idx ON posts (thread, id);
+
+-- скрытые посты вычитаются из непрочитанных
+DROP INDEX IF EXISTS posts__thread_hidden__idx;
+CREATE INDEX posts__thread_hidden__idx ON posts (thread, id) WHERE hidden;
+
+
+-- почасовые счётчики форума, /forum/{slug}/stats суммирует их вместо подсчёта постов
+DROP TABLE IF EXISTS forum_stats_hourly;
+CREATE TABLE forum_stats_hourly
+(
+    forum        citext REFERENCES forums (slug) NOT NULL,
+    hour         timestamptz                     NOT NULL,
+    posts        integer                         NOT NULL DEFAULT 0,
+    threads      integer                         NOT NULL DEFAULT 0,
+    participants integer                         NOT NULL DEFAULT 0,
+    PRIMARY KEY (forum, hour)
+);
+
+DROP TABLE IF EXISTS forum_author_stats_hourly;
+CREATE TABLE forum_author_stats_hourly
+(
+    forum  citext REFERENCES forums (slug)     NOT NULL,
+    hour   timestamptz                         NOT NULL,
+    author citext REFERENCES users (nick_name) NOT NULL,
+    posts  integer                             NOT NULL DEFAULT 0,
+    PRIMARY KEY (forum, hour, author)
+);
+
+
+-- опрос темы, отдельно от голосов за тему в votes
+DROP TABLE IF EXISTS polls;
+CREATE TABLE polls
+(
+    thread   integer PRIMARY KEY REFERENCES threads (id),
+    question text                 NOT NULL,
+    multiple bool                 NOT NULL DEFAULT false,
+    closes   timestamptz          NULL
+);
+
+DROP TABLE IF EXISTS poll_options;
+CREATE TABLE poll_options
+(
+    id       serial PRIMARY KEY,
+    thread   integer REFERENCES polls (thread) NOT NULL,
+    position integer                           NOT NULL,
+    text     text                              NOT NULL,
+    UNIQUE (thread, position)
+);
+
+-- бюллетень пользователя -- все его строки по опросу, переголосование заменяет их целиком
+DROP TABLE IF EXISTS poll_ballots;
+CREATE TABLE poll_ballots
+(
+    user_nick citext REFERENCES users (nick_name) NOT NULL,
+    thread    integer REFERENCES polls (thread)   NOT NULL,
+    option    integer REFERENCES poll_options (id) NOT NULL,
+    created   timestamptz                         NOT NULL DEFAULT now(),
+    PRIMARY KEY (thread, user_nick, option)
+);
+
+DROP INDEX IF EXISTS poll_ballots__option__idx;
+CREATE INDEX poll_ballots__option__idx ON poll_ballots (option);
+
+
+-- если у форума есть хоть один разрешённый тег, темы можно помечать только ими
+DROP TABLE IF EXISTS forum_tags;
+CREATE TABLE forum_tags
+(
+    forum citext REFERENCES forums (slug) NOT NULL,
+    tag   text                            NOT NULL,
+    PRIMARY KEY (forum, tag)
+);
+
+
+DROP TABLE IF EXISTS forum_filters;
+CREATE TABLE forum_filters
+(
+    forum  citext REFERENCES forums (slug) PRIMARY KEY,
+    config jsonb                           NOT NULL DEFAULT '{}'
+);
+
+
 DROP TABLE IF EXISTS status;
 CREATE TABLE status
 (
@@ -110,12 +351,93 @@ CREATE TABLE forum_users
 (
     forum     citext REFERENCES forums (slug),
     user_nick citext REFERENCES users (nick_name),
+    created   timestamptz DEFAULT now() NOT NULL, -- первый пост или тема участника в форуме
     primary key (forum, user_nick)
 );
 
 drop index if exists forum_users__all;
 create index forum_users__all on forum_users (forum, user_nick);
 
+drop index if exists forum_users__user__idx;
+create index forum_users__user__idx on forum_users (user_nick, forum);
+
+
+DROP TABLE IF EXISTS forum_roles;
+CREATE TABLE forum_roles
+(
+    forum     citext REFERENCES forums (slug)     NOT NULL,
+    user_nick citext REFERENCES users (nick_name) NOT NULL,
+    role      text                                NOT NULL,
+    expires   timestamptz                         NULL,
+    PRIMARY KEY (forum, user_nick),
+    CHECK ( role IN ('owner', 'moderator', 'member', 'banned') )
+);
+
+
+-- приглашение модератора (invite) или просьба пользователя (request) вступить в форум;
+-- встречная заявка превращает их в членство
+DROP TABLE IF EXISTS forum_invites;
+CREATE TABLE forum_invites
+(
+    forum      citext REFERENCES forums (slug)     NOT NULL,
+    user_nick  citext REFERENCES users (nick_name) NOT NULL,
+    kind       text                                NOT NULL,
+    invited_by citext REFERENCES users (nick_name) NULL,
+    created    timestamptz                         NOT NULL DEFAULT now(),
+    PRIMARY KEY (forum, user_nick),
+    CHECK ( kind IN ('invite', 'request') )
+);
+
+
+-- личные беседы вне форумов; members_key -- отсортированные ники участников,
+-- чтобы у одного и того же состава была одна беседа
+DROP TABLE IF EXISTS conversations CASCADE;
+CREATE TABLE conversations
+(
+    id           serial PRIMARY KEY,
+    members_key  text UNIQUE NOT NULL,
+    created      timestamptz NOT NULL DEFAULT now(),
+    last_message integer     NULL
+);
+
+-- last_read -- id последнего прочитанного сообщения, по нему считаются отметки о прочтении
+DROP TABLE IF EXISTS conversation_members;
+CREATE TABLE conversation_members
+(
+    conversation integer REFERENCES conversations (id) NOT NULL,
+    user_nick    citext REFERENCES users (nick_name)   NOT NULL,
+    last_read    integer                               NOT NULL DEFAULT 0,
+    PRIMARY KEY (conversation, user_nick)
+);
+
+CREATE INDEX conversation_members__user__idx ON conversation_members (user_nick);
+
+DROP TABLE IF EXISTS direct_messages;
+CREATE TABLE direct_messages
+(
+    id           serial PRIMARY KEY,
+    conversation integer REFERENCES conversations (id) NOT NULL,
+    author       citext REFERENCES users (nick_name)   NOT NULL,
+    message      text                                  NOT NULL,
+    message_html text                                  NOT NULL DEFAULT '',
+    created      timestamptz                           NOT NULL DEFAULT now()
+);
+
+CREATE INDEX direct_messages__conversation__idx ON direct_messages (conversation, id);
+
+-- посты и темы blocked свёрнуты для user_nick; при kind = block user_nick
+-- к тому же не получает от него личных сообщений и упоминаний
+DROP TABLE IF EXISTS user_blocks;
+CREATE TABLE user_blocks
+(
+    user_nick citext REFERENCES users (nick_name) NOT NULL,
+    blocked   citext REFERENCES users (nick_name) NOT NULL,
+    kind      text                                NOT NULL DEFAULT 'block',
+    created   timestamptz                         NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_nick, blocked),
+    CHECK ( kind IN ('block', 'mute') )
+);
+
 
 DROP FUNCTION IF EXISTS set_post_is_edited;
 CREATE OR REPLACE FUNCTION set_post_is_edited() RETURNS TRIGGER AS
@@ -137,6 +459,33 @@ EXECUTE PROCEDURE set_post_is_edited();
 
 
 
+DROP FUNCTION IF EXISTS forum_check_parent;
+CREATE OR REPLACE FUNCTION forum_check_parent() RETURNS TRIGGER AS
+$forum_check_parent$
+begin
+    if new.parent is not null and exists(
+            with recursive up as (
+                select slug, parent from forums where slug = new.parent
+                union
+                select f.slug, f.parent from forums f join up on f.slug = up.parent
+            )
+            select 1 from up where slug = new.slug) then
+        raise EXCEPTION 'Forum cannot be a descendant of itself';
+    end if;
+
+    return new;
+end;
+$forum_check_parent$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS forum_check_parent ON forums;
+CREATE TRIGGER forum_check_parent
+    BEFORE INSERT OR UPDATE OF parent, slug
+    ON forums
+    FOR EACH ROW
+EXECUTE PROCEDURE forum_check_parent();
+
+
+
 DROP FUNCTION IF EXISTS thread_num_inc;
 CREATE OR REPLACE FUNCTION thread_num_inc() RETURNS TRIGGER AS
 $thread_num_inc$
@@ -158,6 +507,26 @@ EXECUTE PROCEDURE thread_num_inc();
 
 
 
+DROP FUNCTION IF EXISTS thread_hot_init;
+CREATE OR REPLACE FUNCTION thread_hot_init() RETURNS TRIGGER AS
+$thread_hot_init$
+begin
+    -- hot_score -- время создания в секундах, сдвинутое вперёд за голоса и посты,
+    -- не зависит от текущего момента; у новой темы сдвига ещё нет
+    new.hot_score = extract(epoch from new.created);
+    return new;
+end;
+$thread_hot_init$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS thread_hot_init ON threads;
+CREATE TRIGGER thread_hot_init
+    BEFORE INSERT
+    ON threads
+    FOR EACH ROW
+EXECUTE PROCEDURE thread_hot_init();
+
+
+
 DROP FUNCTION IF EXISTS forum_num_inc;
 CREATE OR REPLACE FUNCTION forum_num_inc() RETURNS TRIGGER AS
 $forum_num_inc$
@@ -200,6 +569,13 @@ DROP FUNCTION IF EXISTS thread_rating_recount;
 CREATE OR REPLACE FUNCTION thread_rating_recount() RETURNS TRIGGER AS
 $thread_rating_recount$
 begin
+    if TG_OP = 'DELETE' then
+        update Threads
+        set vote_num = vote_num - old.voice
+        where id = old.thread;
+        return old;
+    end if;
+
     if new.voice = old.voice then
         return new;
     end if;
@@ -213,13 +589,128 @@ $thread_rating_recount$ LANGUAGE plpgsql;
 
 DROP TRIGGER IF EXISTS thread_rating_recount ON votes;
 CREATE TRIGGER thread_rating_recount
-    AFTER UPDATE
+    AFTER UPDATE OR DELETE
     ON votes
     FOR EACH ROW
 EXECUTE PROCEDURE thread_rating_recount();
 
 
 
+-- thread_vote -- голос за тему одним запросом: INSERT ... ON CONFLICT не упирается в unique при
+-- параллельных голосах, vote_num меняют триггеры thread_rating_* под блокировкой строки темы;
+-- vc = 0 -- отзыв голоса, без темы или пользователя строк нет
+DROP FUNCTION IF EXISTS thread_vote(tslug citext, tid integer, nick citext, vc integer);
+CREATE OR REPLACE FUNCTION thread_vote(tslug citext, tid integer, nick citext, vc integer)
+    RETURNS SETOF threads AS
+$$
+declare
+    t integer;
+    u citext;
+begin
+    select id into t from threads where slug = tslug or id = tid;
+    select nick_name into u from users where nick_name = nick;
+    if t is null or u is null then
+        return;
+    end if;
+
+    if vc = 0 then
+        delete from votes where author = u and thread = t;
+    else
+        insert into votes (author, thread, voice)
+        values (u, t, vc)
+        on conflict (author, thread) do update set voice = excluded.voice;
+    end if;
+
+    return query select * from threads where id = t;
+end
+$$ LANGUAGE plpgsql;
+
+
+
+DROP FUNCTION IF EXISTS post_rating_count;
+CREATE OR REPLACE FUNCTION post_rating_count() RETURNS TRIGGER AS
+$post_rating_count$
+begin
+    update Posts
+    set vote_num = vote_num + new.voice
+    where id = new.post;
+    return new;
+end;
+$post_rating_count$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS post_rating_count ON post_votes;
+CREATE TRIGGER post_rating_count
+    AFTER INSERT
+    ON post_votes
+    FOR EACH ROW
+EXECUTE PROCEDURE post_rating_count();
+
+
+
+DROP FUNCTION IF EXISTS post_rating_recount;
+CREATE OR REPLACE FUNCTION post_rating_recount() RETURNS TRIGGER AS
+$post_rating_recount$
+begin
+    if TG_OP = 'DELETE' then
+        update Posts
+        set vote_num = vote_num - old.voice
+        where id = old.post;
+        return old;
+    end if;
+
+    if new.voice = old.voice then
+        return new;
+    end if;
+
+    update Posts
+    set vote_num = vote_num + new.voice - old.voice
+    where id = new.post;
+    return new;
+end;
+$post_rating_recount$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS post_rating_recount ON post_votes;
+CREATE TRIGGER post_rating_recount
+    AFTER UPDATE OR DELETE
+    ON post_votes
+    FOR EACH ROW
+EXECUTE PROCEDURE post_rating_recount();
+
+
+
+DROP FUNCTION IF EXISTS post_reactions_count;
+CREATE OR REPLACE FUNCTION post_reactions_count() RETURNS TRIGGER AS
+$post_reactions_count$
+begin
+    -- снятая реакция уменьшает счётчик, обнулившийся счётчик убирается
+    if TG_OP = 'DELETE' then
+        update Posts
+        set reactions = case
+                            when (reactions ->> old.emoji)::integer > 1
+                                then jsonb_set(reactions, array [old.emoji],
+                                               to_jsonb((reactions ->> old.emoji)::integer - 1))
+                            else reactions - old.emoji end
+        where id = old.post;
+        return old;
+    end if;
+
+    update Posts
+    set reactions = jsonb_set(reactions, array [new.emoji],
+                              to_jsonb(coalesce((reactions ->> new.emoji)::integer, 0) + 1))
+    where id = new.post;
+    return new;
+end;
+$post_reactions_count$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS post_reactions_count ON post_reactions;
+CREATE TRIGGER post_reactions_count
+    AFTER INSERT OR DELETE
+    ON post_reactions
+    FOR EACH ROW
+EXECUTE PROCEDURE post_reactions_count();
+
+
+
 DROP FUNCTION IF EXISTS user_num_inc;
 CREATE OR REPLACE FUNCTION user_num_inc() RETURNS TRIGGER AS
 $user_num_inc$
@@ -284,12 +775,137 @@ EXECUTE PROCEDURE post_set_path();
 
 
 
+-- номера постов раздаются пачкой при вставке, а не триггером на каждый пост
+DROP TRIGGER IF EXISTS post_set_num ON posts;
+DROP FUNCTION IF EXISTS post_set_num;
+
+DROP FUNCTION IF EXISTS thread_unread(tid integer, nick citext, lastRead integer, readNum integer);
+CREATE OR REPLACE FUNCTION thread_unread(tid integer, nick citext, lastRead integer, readNum integer,
+                                         OUT unread integer, OUT first_unread integer) AS
+$$
+begin
+    -- разность номеров без скрытых постов и постов заглушённых nick авторов после lastRead
+    select t.post_num - readNum into unread from threads t where t.id = tid;
+    unread := unread
+        - (select count(*) from posts p where p.thread = tid and p.id > lastRead and p.hidden)
+        - (select count(*) from user_blocks b join posts p on p.author = b.blocked
+               where b.user_nick = nick and p.thread = tid and p.id > lastRead and not p.hidden);
+
+    select p.id into first_unread from posts p
+        where p.thread = tid and p.id > lastRead and not p.hidden
+            and not exists (select 1 from user_blocks b where b.user_nick = nick and b.blocked = p.author)
+        order by p.id
+        limit 1;
+    first_unread := coalesce(first_unread, 0);
+end
+$$ LANGUAGE plpgsql STABLE;
+
+
+
+DROP FUNCTION IF EXISTS forum_stats_add;
+CREATE OR REPLACE FUNCTION forum_stats_add(tbl name, fslug citext, ts timestamptz, nick citext, delta integer)
+    RETURNS void AS
+$$
+begin
+    if tbl = 'posts' then
+        INSERT INTO forum_stats_hourly (forum, hour, posts)
+        VALUES (fslug, date_trunc('hour', ts), delta)
+        ON CONFLICT (forum, hour) DO UPDATE SET posts = forum_stats_hourly.posts + delta;
+
+        INSERT INTO forum_author_stats_hourly (forum, hour, author, posts)
+        VALUES (fslug, date_trunc('hour', ts), nick, delta)
+        ON CONFLICT (forum, hour, author) DO UPDATE SET posts = forum_author_stats_hourly.posts + delta;
+    elsif tbl = 'threads' then
+        INSERT INTO forum_stats_hourly (forum, hour, threads)
+        VALUES (fslug, date_trunc('hour', ts), delta)
+        ON CONFLICT (forum, hour) DO UPDATE SET threads = forum_stats_hourly.threads + delta;
+    else
+        INSERT INTO forum_stats_hourly (forum, hour, participants)
+        VALUES (fslug, date_trunc('hour', ts), delta)
+        ON CONFLICT (forum, hour) DO UPDATE SET participants = forum_stats_hourly.participants + delta;
+    end if;
+end;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS forum_stats_count;
+CREATE OR REPLACE FUNCTION forum_stats_count() RETURNS TRIGGER AS
+$forum_stats_count$
+begin
+    -- старая строка вычитается из своего часа, новая прибавляется: так перенос, слияние и разделение тем
+    -- сдвигают сводки вместе с постами; участник форума считается в час первого поста или темы
+    if TG_TABLE_NAME = 'forum_users' then
+        if TG_OP in ('UPDATE', 'DELETE') then
+            perform forum_stats_add(TG_TABLE_NAME, old.forum, old.created, old.user_nick, -1);
+        end if;
+        if TG_OP in ('INSERT', 'UPDATE') then
+            perform forum_stats_add(TG_TABLE_NAME, new.forum, new.created, new.user_nick, 1);
+        end if;
+    else
+        if TG_OP in ('UPDATE', 'DELETE') then
+            perform forum_stats_add(TG_TABLE_NAME, old.forum, old.created, old.author, -1);
+        end if;
+        if TG_OP in ('INSERT', 'UPDATE') then
+            perform forum_stats_add(TG_TABLE_NAME, new.forum, new.created, new.author, 1);
+        end if;
+    end if;
+    return null;
+end;
+$forum_stats_count$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS forum_stats_posts ON posts;
+CREATE TRIGGER forum_stats_posts
+    AFTER INSERT
+    ON posts
+    FOR EACH ROW
+EXECUTE PROCEDURE forum_stats_count();
+
+DROP TRIGGER IF EXISTS forum_stats_posts_move ON posts;
+CREATE TRIGGER forum_stats_posts_move
+    AFTER UPDATE OF forum
+    ON posts
+    FOR EACH ROW
+    WHEN (old.forum IS DISTINCT FROM new.forum)
+EXECUTE PROCEDURE forum_stats_count();
+
+DROP TRIGGER IF EXISTS forum_stats_threads ON threads;
+CREATE TRIGGER forum_stats_threads
+    AFTER INSERT OR DELETE
+    ON threads
+    FOR EACH ROW
+EXECUTE PROCEDURE forum_stats_count();
+
+DROP TRIGGER IF EXISTS forum_stats_threads_move ON threads;
+CREATE TRIGGER forum_stats_threads_move
+    AFTER UPDATE OF forum
+    ON threads
+    FOR EACH ROW
+    WHEN (old.forum IS DISTINCT FROM new.forum)
+EXECUTE PROCEDURE forum_stats_count();
+
+DROP TRIGGER IF EXISTS forum_stats_users ON forum_users;
+CREATE TRIGGER forum_stats_users
+    AFTER INSERT OR DELETE
+    ON forum_users
+    FOR EACH ROW
+EXECUTE PROCEDURE forum_stats_count();
+
+DROP TRIGGER IF EXISTS forum_stats_users_created ON forum_users;
+CREATE TRIGGER forum_stats_users_created
+    AFTER UPDATE OF created
+    ON forum_users
+    FOR EACH ROW
+    WHEN (old.created IS DISTINCT FROM new.created)
+EXECUTE PROCEDURE forum_stats_count();
+
+
+
 CREATE OR REPLACE FUNCTION add_forum_user() RETURNS TRIGGER AS
 $add_forum_user$
 begin
-    INSERT INTO forum_users (FORUM, USER_NICK)
-    VALUES (new.forum, new.author)
-    ON CONFLICT DO NOTHING;
+    INSERT INTO forum_users (FORUM, USER_NICK, CREATED)
+    VALUES (new.forum, new.author, new.created)
+    ON CONFLICT (forum, user_nick) DO UPDATE SET created = excluded.created
+        WHERE forum_users.created > excluded.created;
     return new;
 end;
 $add_forum_user$ LANGUAGE plpgsql;
@@ -304,30 +920,159 @@ EXECUTE PROCEDURE add_forum_user();
 
 
 
+-- роль с истёкшим сроком (например, временный бан) считается обычным участием
+DROP FUNCTION IF EXISTS forum_role;
+CREATE OR REPLACE FUNCTION forum_role(fslug citext, nick citext) RETURNS text AS
+$$
+select coalesce((select role
+                 from forum_roles
+                 where forum = fslug
+                   and user_nick = nick
+                   and (expires is null or expires > now())), 'member');
+$$ LANGUAGE sql STABLE;
+
+-- forum_visible -- форум не приватный или nick -- его участник, см. canRead
+DROP FUNCTION IF EXISTS forum_visible;
+CREATE OR REPLACE FUNCTION forum_visible(fslug citext, nick citext) RETURNS bool AS
+$$
+select exists(select 1 from forums where slug = fslug and visibility <> 'private')
+           or exists(select 1
+                     from forum_roles
+                     where forum = fslug
+                       and user_nick = nick
+                       and role in ('owner', 'moderator', 'member')
+                       and (expires is null or expires > now()));
+$$ LANGUAGE sql STABLE;
+
+
+
+DROP FUNCTION IF EXISTS add_forum_owner;
+CREATE OR REPLACE FUNCTION add_forum_owner() RETURNS TRIGGER AS
+$add_forum_owner$
+begin
+    INSERT INTO forum_roles (forum, user_nick, role)
+    VALUES (new.slug, new.responsible, 'owner')
+    ON CONFLICT (forum, user_nick) DO UPDATE SET role = 'owner', expires = null;
+    return new;
+end;
+$add_forum_owner$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS add_forum_owner on forums;
+CREATE TRIGGER add_forum_owner
+    AFTER INSERT
+    ON forums
+    FOR EACH ROW
+EXECUTE PROCEDURE add_forum_owner();
+
+
+
+DROP FUNCTION IF EXISTS subscribe_author;
+CREATE OR REPLACE FUNCTION subscribe_author() RETURNS TRIGGER AS
+$subscribe_author$
+begin
+    -- автор темы или поста подписывается на тему; автор задержанного фильтром поста -- после одобрения
+    if TG_TABLE_NAME = 'threads' then
+        INSERT INTO thread_subscriptions (user_nick, thread) VALUES (new.author, new.id) ON CONFLICT DO NOTHING;
+    elsif not new.hidden then
+        INSERT INTO thread_subscriptions (user_nick, thread) VALUES (new.author, new.thread) ON CONFLICT DO NOTHING;
+    end if;
+    return new;
+end;
+$subscribe_author$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS subscribe_thread_author on threads;
+CREATE TRIGGER subscribe_thread_author
+    AFTER INSERT
+    ON threads
+    FOR EACH ROW
+EXECUTE PROCEDURE subscribe_author();
+
+DROP TRIGGER IF EXISTS subscribe_post_author on posts;
+CREATE TRIGGER subscribe_post_author
+    AFTER INSERT OR UPDATE OF hidden
+    ON posts
+    FOR EACH ROW
+EXECUTE PROCEDURE subscribe_author();
+
+
+
+DROP FUNCTION IF EXISTS post_hidden_unaccept;
+CREATE OR REPLACE FUNCTION post_hidden_unaccept() RETURNS TRIGGER AS
+$post_hidden_unaccept$
+begin
+    -- скрытый модератором пост не может оставаться принятым ответом
+    update threads set accepted_post = null where id = new.thread and accepted_post = new.id;
+    return new;
+end;
+$post_hidden_unaccept$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS post_hidden_unaccept on posts;
+CREATE TRIGGER post_hidden_unaccept
+    AFTER UPDATE OF hidden
+    ON posts
+    FOR EACH ROW
+    WHEN (new.hidden AND NOT old.hidden)
+EXECUTE PROCEDURE post_hidden_unaccept();
+
+
+
 DROP FUNCTION IF EXISTS select_threads_by_forum(forum citext, lmt integer, snc text, dsc bool);
-CREATE OR REPLACE FUNCTION select_threads_by_forum(fslug citext, lmt integer, snc text, dsc bool)
+DROP FUNCTION IF EXISTS select_threads_by_forum(forum citext, lmt integer, snc text, dsc bool, tg text[], tg_any bool);
+DROP FUNCTION IF EXISTS select_threads_by_forum(forum citext, lmt integer, snc text, dsc bool, tg text[], tg_any bool,
+                                                ans bool);
+DROP FUNCTION IF EXISTS select_threads_by_forum(forum citext, lmt integer, snc text, dsc bool, tg text[], tg_any bool,
+                                                ans bool, hdn bool);
+CREATE OR REPLACE FUNCTION select_threads_by_forum(fslug citext, lmt integer, snc text, dsc bool, tg text[],
+                                                   tg_any bool, ans bool, hdn bool)
     RETURNS SETOF threads AS
 $$
 declare
-    queryS text;
+    queryS       text;
+    cmp          text;
+    afterPinned  bool;
+    afterRegular bool;
 begin
-    queryS := 'SELECT id, author, forum, ' ||
-              'created, message, slug, ' ||
-              'title, vote_num ' ||
+    -- закреплённые темы идут первыми; перенесённые из форума темы остаются в выдаче заглушками
+    queryS := 'SELECT * ' ||
               'FROM threads ' ||
-              'WHERE forum = ' || quote_literal(fslug);
+              'WHERE (forum = ' || quote_literal(fslug) ||
+              ' or id in (select thread from thread_moves where from_forum = ' || quote_literal(fslug) || '))';
+
+    -- hdn -- показывать задержанные фильтром темы, только для модераторов
+    if not hdn then
+        queryS = queryS || ' and not hidden';
+    end if;
 
+    -- tg_any -- хотя бы один из тегов, иначе все сразу
+    if cardinality(tg) > 0 then
+        queryS = queryS || ' and tags ' || case when tg_any then '&&' else '@>' end || ' ' ||
+                 quote_literal(tg) || '::text[]';
+    end if;
+
+    -- ans null -- все темы, иначе только с принятым ответом или без него
+    if ans is not null then
+        queryS = queryS || ' and accepted_post is ' || case when ans then 'not null' else 'null' end;
+    end if;
+
+    -- snc -- created последней темы предыдущей страницы: после незакреплённой закреплённые уже показаны,
+    -- после закреплённой идут оставшиеся закреплённые и все незакреплённые;
+    -- snc, не совпавший ни с одной темой, -- обычный фильтр по времени для всех тем
     if snc is not null then
-        queryS = queryS || ' and created ';
-        if dsc then
-            queryS = queryS || ' <= ';
+        cmp := case when dsc then ' <= ' else ' >= ' end;
+        execute 'select exists(' || queryS || ' and pinned and created = ' || quote_literal(snc) || '), ' ||
+                'exists(' || queryS || ' and not pinned and created = ' || quote_literal(snc) || ')'
+            into afterPinned, afterRegular;
+
+        if afterPinned then
+            queryS = queryS || ' and (not pinned or created ' || cmp || quote_literal(snc) || ')';
+        elsif afterRegular then
+            queryS = queryS || ' and not pinned and created ' || cmp || quote_literal(snc);
         else
-            queryS = queryS || ' >= ';
+            queryS = queryS || ' and created ' || cmp || quote_literal(snc);
         end if;
-        queryS = queryS || quote_literal(snc);
     end if;
 
-    queryS = queryS || ' order by created ';
+    queryS = queryS || ' order by pinned desc, created ';
     if dsc then
         queryS = queryS || ' desc ';
     end if;
@@ -343,24 +1088,67 @@ $$ LANGUAGE plpgsql;
 
 
 DROP FUNCTION IF EXISTS select_posts_by_thread(threadId integer, lmt integer, snc integer, dsc bool, mode text);
-CREATE OR REPLACE FUNCTION select_posts_by_thread(threadId integer, lmt integer, snc integer, dsc bool, mode text)
+DROP FUNCTION IF EXISTS select_posts_by_thread(threadId integer, lmt integer, snc integer, dsc bool, mode text, top bool);
+DROP FUNCTION IF EXISTS select_posts_by_thread(threadId integer, lmt integer, snc integer, dsc bool, mode text, top bool,
+                                               acc integer);
+CREATE OR REPLACE FUNCTION select_posts_by_thread(threadId integer, lmt integer, snc integer, dsc bool, mode text,
+                                                  top bool, acc integer)
     RETURNS SETOF posts AS
 $$
 declare
     withPart  text;
+    selectPart text;
     mainPart  text;
+    joinPart  text := '';
     wherePart text;
     orderPart text;
 begin
     -- mode = 1, flag; 2, tree; 3, par_tree
+    -- top: flat и parent_tree упорядочиваются по рейтингу (vote_num desc, id), dsc при этом не учитывается;
+    -- в parent_tree по рейтингу сортируются только корни, поддерево идёт в порядке path
+    -- скрытые модератором посты остаются на месте, но без текста
     mainPart := 'SELECT author, created, id, ' ||
-                'is_edited, message, coalesce(parent, 0),' ||
-                'thread, forum, path ' ||
+                'is_edited, case when hidden then '''' else message end, coalesce(parent, 0),' ||
+                'thread, forum, path, vote_num, reactions, hidden, ' ||
+                'case when hidden then '''' else message_html end, num ' ||
                 'FROM posts ';
+    selectPart := mainPart;
     wherePart := 'WHERE ';
     orderPart := 'ORDER BY ';
 
-    if mode = '' or mode = 'flat' then
+    -- acc -- принятый ответ qa-форума: в flat и parent_tree он (с поддеревом в parent_tree)
+    -- идёт первым на первой странице и не повторяется на остальных; на первой странице
+    -- он занимает одно из lmt мест, так что остальным остаётся на одно меньше
+    if acc > 0 and coalesce(snc, 0) <= 0 and mode in ('', 'flat', 'parent_tree') then
+        if lmt = 1 then
+            wherePart = wherePart || ' false and ';
+        elsif lmt > 1 then
+            lmt = lmt - 1;
+        end if;
+    end if;
+
+    if acc > 0 and mode = 'parent_tree' then
+        wherePart = wherePart || ' path[1] <> ' || acc || ' and ';
+    elsif acc > 0 and (mode = '' or mode = 'flat') then
+        wherePart = wherePart || ' id <> ' || acc || ' and ';
+    end if;
+
+    if (mode = '' or mode = 'flat') and top then
+        wherePart = wherePart || ' thread = ' || threadId;
+
+        if snc > 0 then
+            wherePart = wherePart || ' and (-vote_num, id) > ' ||
+                        '(select -vote_num, id from posts where id = ' || snc || ') ';
+        end if;
+
+        orderPart = orderPart || ' vote_num desc, id ';
+
+        if lmt > 0 then
+            orderPart = orderPart || ' limit ' || lmt;
+        end if;
+    end if;
+
+    if (mode = '' or mode = 'flat') and not top then
         wherePart = wherePart || ' thread = ' || threadId;
 
         if snc > 0 then
@@ -414,7 +1202,26 @@ begin
         end if;
     end if;
 
-    if mode = 'parent_tree' then
+    if mode = 'parent_tree' and top then
+        joinPart = ' JOIN (select id root, row_number() over (order by vote_num desc, id) rnk from posts ' ||
+                   'where thread = ' || threadId || ' and parent is null ';
+
+        if snc > 0 then
+            joinPart = joinPart || ' and (-vote_num, id) > (select -r.vote_num, r.id from posts r ' ||
+                       'where r.id = (select path[1] from posts where id = ' || snc || ')) ';
+        end if;
+
+        joinPart = joinPart || ' order by vote_num desc, id ';
+        if lmt > 0 then
+            joinPart = joinPart || ' limit ' || lmt;
+        end if;
+        joinPart = joinPart || ') roots ON path[1] = roots.root ';
+
+        wherePart = wherePart || ' thread = ' || threadId;
+        orderPart = orderPart || ' roots.rnk, path ';
+    end if;
+
+    if mode = 'parent_tree' and not top then
         wherePart = wherePart || ' path[1] in (select path[1] from posts where thread = ' || threadId ||
                     ' and parent is null ';
 
@@ -443,7 +1250,17 @@ begin
         orderPart = orderPart || ', path[2:] ';
     end if;
 
-    mainPart = mainPart || wherePart || orderPart;
+    mainPart = mainPart || joinPart || wherePart || orderPart;
+
+    if acc > 0 and coalesce(snc, 0) <= 0 and mode in ('', 'flat', 'parent_tree') then
+        if mode = 'parent_tree' then
+            selectPart = selectPart || 'WHERE path[1] = ' || acc || ' ORDER BY path';
+        else
+            selectPart = selectPart || 'WHERE id = ' || acc;
+        end if;
+        mainPart = '(' || selectPart || ') UNION ALL (' || mainPart || ')';
+    end if;
+
     return query execute mainPart;
 end
 $$ LANGUAGE plpgsql;
@@ -451,16 +1268,29 @@ $$ LANGUAGE plpgsql;
 
 
 DROP FUNCTION IF EXISTS select_users_by_forum(forum citext, dsc bool, lim integer, sinc citext);
-CREATE OR REPLACE FUNCTION select_users_by_forum(forum citext, dsc bool, lim integer, sinc citext)
+DROP FUNCTION IF EXISTS select_users_by_forum(forum citext, dsc bool, lim integer, sinc citext, rl text);
+CREATE OR REPLACE FUNCTION select_users_by_forum(forum citext, dsc bool, lim integer, sinc citext, rl text)
     RETURNS SETOF users AS
 $$
 declare
     queryS text;
 begin
-    queryS := 'SELECT u.about, u.email, u.full_name, u.nick_name ' ||
-              'from forum_users fu ' ||
-              'join users u on u.nick_name = fu.user_nick ' ||
-              'where fu.forum = ' || quote_literal(forum);
+    queryS := 'SELECT u.about, u.email, u.full_name, u.nick_name ';
+
+    if rl = '' then
+        queryS = queryS ||
+                 'from forum_users fu ' ||
+                 'join users u on u.nick_name = fu.user_nick ' ||
+                 'where fu.forum = ' || quote_literal(forum);
+    else
+        -- модераторы и забаненные могли ещё ничего не написать в форуме
+        queryS = queryS ||
+                 'from (select forum, user_nick from forum_users ' ||
+                 '      union select forum, user_nick from forum_roles) fu ' ||
+                 'join users u on u.nick_name = fu.user_nick ' ||
+                 'where fu.forum = ' || quote_literal(forum) ||
+                 ' and forum_role(fu.forum, fu.user_nick) = ' || quote_literal(rl) || ' ';
+    end if;
 
     if sinc <> '' then
         queryS = queryS || 'and u.nick_name ';
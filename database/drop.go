@@ -11,7 +11,29 @@ drop sequence if exists posts_id_seq cascade ;
 drop function if exists PostId;
 drop function if exists PostPar;
 
+drop table if exists Direct_Messages;
+drop table if exists Conversation_Members;
+drop table if exists Conversations;
+drop table if exists User_Blocks;
 drop table if exists Votes;
+drop table if exists Thread_Moves;
+drop table if exists Thread_Redirects;
+drop table if exists Forum_Author_Stats_Hourly;
+drop table if exists Forum_Stats_Hourly;
+drop table if exists Thread_Reads;
+drop table if exists Mentions;
+drop table if exists Thread_Subscriptions;
+drop table if exists Forum_Subscriptions;
+drop table if exists Poll_Ballots;
+drop table if exists Poll_Options;
+drop table if exists Polls;
+drop table if exists Forum_Tags;
+drop table if exists Forum_Filters;
+drop table if exists Post_Reports;
+drop table if exists Forum_Invites;
+drop table if exists Forum_Roles;
+drop table if exists Post_Reactions;
+drop table if exists Post_Votes;
 drop table if exists Posts;
 drop table if exists Threads;
 drop table if exists Forums;
@@ -26,7 +48,29 @@ drop table if exists Status;
 
 func TruncTables(db *pgx.ConnPool) {
 	_, err := db.Exec(`
+truncate table if exists Direct_Messages;
+truncate table if exists Conversation_Members;
+truncate table if exists Conversations;
+truncate table if exists User_Blocks;
 truncate table if exists Votes;
+truncate table if exists Thread_Moves;
+truncate table if exists Thread_Redirects;
+truncate table if exists Forum_Author_Stats_Hourly;
+truncate table if exists Forum_Stats_Hourly;
+truncate table if exists Thread_Reads;
+truncate table if exists Mentions;
+truncate table if exists Thread_Subscriptions;
+truncate table if exists Forum_Subscriptions;
+truncate table if exists Poll_Ballots;
+truncate table if exists Poll_Options;
+truncate table if exists Polls;
+truncate table if exists Forum_Tags;
+truncate table if exists Forum_Filters;
+truncate table if exists Post_Reports;
+truncate table if exists Forum_Invites;
+truncate table if exists Forum_Roles;
+truncate table if exists Post_Reactions;
+truncate table if exists Post_Votes;
 truncate table if exists Posts;
 truncate table if exists Threads;
 truncate table if exists Forums;
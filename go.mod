@@ -1,18 +1,36 @@
 module github.com/ApTyp5/new_db_techno
 
-go 1.14
+go 1.19
 
 require (
-	github.com/cockroachdb/apd v1.1.0 // indirect
-	github.com/gofrs/uuid v3.3.0+incompatible // indirect
-	github.com/jackc/fake v0.0.0-20150926172116-812a484cc733 // indirect
 	github.com/jackc/pgx v3.6.2+incompatible
 	github.com/labstack/echo v3.3.10+incompatible
-	github.com/labstack/echo/v4 v4.1.16
-	github.com/lib/pq v1.7.0 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.27
 	github.com/pkg/errors v0.9.1
-	github.com/shopspring/decimal v1.2.0 // indirect
-	github.com/tiramiseb/echo-humanlog v0.0.0-20170603203611-1664ed75fdbe
 	github.com/valyala/fasthttp v1.14.0
+	github.com/yuin/goldmark v1.5.4
 	go.uber.org/zap v1.15.0
 )
+
+require (
+	github.com/andybalholm/brotli v1.0.0 // indirect
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/cockroachdb/apd v1.1.0 // indirect
+	github.com/gofrs/uuid v3.3.0+incompatible // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+	github.com/jackc/fake v0.0.0-20150926172116-812a484cc733 // indirect
+	github.com/klauspost/compress v1.10.4 // indirect
+	github.com/labstack/gommon v0.3.0 // indirect
+	github.com/lib/pq v1.7.0 // indirect
+	github.com/mattn/go-colorable v0.1.6 // indirect
+	github.com/mattn/go-isatty v0.0.12 // indirect
+	github.com/shopspring/decimal v1.2.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.1.0 // indirect
+	go.uber.org/atomic v1.6.0 // indirect
+	go.uber.org/multierr v1.5.0 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+)
@@ -0,0 +1,125 @@
+// dbtest -- база для тестов репозиториев и сценариев.
+// Строка подключения берётся из TEST_DB, без неё тесты пропускаются.
+// Схема грузится из database/create.sql один раз на процесс; пакеты тестов
+// выполняются параллельно, поэтому процесс держит advisory lock до выхода.
+package dbtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+const (
+	EnvConnStr = "TEST_DB"
+	lockKey    = 20200614
+)
+
+var (
+	once    sync.Once
+	pool    *pgx.ConnPool
+	lock    *pgx.Conn
+	initErr error
+)
+
+// Connect -- пул к тестовой базе со свежей схемой; каждый вызов очищает таблицы
+func Connect(t testing.TB) *pgx.ConnPool {
+	t.Helper()
+
+	connStr := os.Getenv(EnvConnStr)
+	if connStr == "" {
+		t.Skip(EnvConnStr + " is not set")
+	}
+
+	once.Do(func() { initErr = setup(connStr) })
+	if initErr != nil {
+		t.Fatal(initErr)
+	}
+
+	Reset(t, pool)
+	return pool
+}
+
+func setup(connStr string) error {
+	config, err := pgx.ParseConnectionString(connStr)
+	if err != nil {
+		return errors.Wrap(err, "dbtest parse")
+	}
+
+	if lock, err = pgx.Connect(config); err != nil {
+		return errors.Wrap(err, "dbtest lock connect")
+	}
+	if _, err := lock.Exec("select pg_advisory_lock($1)", lockKey); err != nil {
+		return errors.Wrap(err, "dbtest lock")
+	}
+
+	pool, err = pgx.NewConnPool(pgx.ConnPoolConfig{ConnConfig: config, MaxConnections: 20})
+	if err != nil {
+		return errors.Wrap(err, "dbtest pool")
+	}
+
+	schema, err := loadSchema()
+	if err != nil {
+		return err
+	}
+	_, err = pool.Exec(schema)
+	return errors.Wrap(err, "dbtest schema")
+}
+
+// loadSchema -- create.sql без ALTER SYSTEM: он не выполняется внутри транзакции,
+// а весь файл уходит одним запросом
+func loadSchema() (string, error) {
+	_, file, _, _ := runtime.Caller(0)
+	data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(file), "..", "..", "database", "create.sql"))
+	if err != nil {
+		return "", errors.Wrap(err, "dbtest read schema")
+	}
+
+	lines := strings.Split(string(data), "\n")
+	schema := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "ALTER SYSTEM") {
+			continue
+		}
+		schema = append(schema, line)
+	}
+	return strings.Join(schema, "\n"), nil
+}
+
+// Reset -- очистка всех таблиц схемы public и начальная строка status
+func Reset(t testing.TB, db *pgx.ConnPool) {
+	t.Helper()
+
+	rows, err := db.Query("select tablename from pg_tables where schemaname = 'public'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			t.Fatal(err)
+		}
+		tables = append(tables, pgx.Identifier{table}.Sanitize())
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("truncate table " + strings.Join(tables, ", ") + " restart identity cascade"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("insert into status default values"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -25,7 +25,7 @@ func (m ForumHandlerManager) Create() HandlerFunc {
 			return c.JSON(retError(err))
 		}
 
-		return c.JSON(m.uc.Create(&forum))
+		return renderJSON(c)(m.uc.Create(&forum))
 	}
 }
 
@@ -37,14 +37,21 @@ func (m ForumHandlerManager) CreateThread() HandlerFunc {
 			return c.JSON(retError(err))
 		}
 
-		return c.JSON(m.uc.CreateThread(&thread))
+		return renderJSON(c)(m.uc.CreateThread(&thread))
 	}
 }
 
 // /forum/{slug}/details
 func (m ForumHandlerManager) Details() HandlerFunc {
 	return func(c Context) error {
-		return c.JSON(m.uc.Details(c.Param("slug")))
+		return renderJSON(c)(m.uc.Details(c.Param("slug"), c.QueryParam("viewer")))
+	}
+}
+
+// /forum/{slug}/children
+func (m ForumHandlerManager) Children() HandlerFunc {
+	return func(c Context) error {
+		return renderJSON(c)(m.uc.Children(c.Param("slug"), c.QueryParam("viewer")))
 	}
 }
 
@@ -56,7 +63,13 @@ func (m ForumHandlerManager) Threads() HandlerFunc {
 		since := c.QueryParam("since")
 		desc := QueryBool(c, "desc")
 
-		return c.JSON(m.uc.Threads(slug, limit, since, desc))
+		viewer := c.QueryParam("viewer")
+		sort := c.QueryParam("sort")
+		tag := c.QueryParam("tag")
+		tagMode := c.QueryParam("tag_mode")
+		answered := c.QueryParam("answered")
+
+		return renderJSON(c)(m.uc.Threads(slug, limit, since, desc, viewer, sort, tag, tagMode, answered))
 	}
 }
 
@@ -67,7 +80,140 @@ func (m ForumHandlerManager) Users() HandlerFunc {
 		limit := QueryNatural(c, "limit")
 		since := c.QueryParam("since")
 		desc := QueryBool(c, "desc")
+		role := c.QueryParam("role")
+		viewer := c.QueryParam("viewer")
+
+		return renderJSON(c)(m.uc.Users(slug, limit, since, desc, role, viewer))
+	}
+}
+
+// /forum/{slug}/roles
+func (m ForumHandlerManager) GrantRole() HandlerFunc {
+	return func(c Context) error {
+		change := models.RoleChange{}
+		if err := c.Bind(&change); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.GrantRole(c.Param("slug"), &change))
+	}
+}
+
+// DELETE /forum/{slug}/roles/{user}?nickname=
+func (m ForumHandlerManager) RevokeRole() HandlerFunc {
+	return func(c Context) error {
+		change := models.RoleChange{NickName: c.QueryParam("nickname")}
+		change.User = c.Param("user")
+
+		return renderJSON(c)(m.uc.RevokeRole(c.Param("slug"), &change))
+	}
+}
+
+// /forum/{slug}/invite
+func (m ForumHandlerManager) Invite() HandlerFunc {
+	return func(c Context) error {
+		change := models.InviteChange{}
+		if err := c.Bind(&change); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Invite(c.Param("slug"), &change))
+	}
+}
+
+// /forum/{slug}/join
+func (m ForumHandlerManager) Join() HandlerFunc {
+	return func(c Context) error {
+		change := models.InviteChange{}
+		if err := c.Bind(&change); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Join(c.Param("slug"), &change))
+	}
+}
+
+// /forum/{slug}/invites?viewer=
+func (m ForumHandlerManager) Invites() HandlerFunc {
+	return func(c Context) error {
+		return renderJSON(c)(m.uc.Invites(c.Param("slug"), c.QueryParam("viewer")))
+	}
+}
+
+// DELETE /forum/{slug}/invites/{user}?nickname=
+func (m ForumHandlerManager) CancelInvite() HandlerFunc {
+	return func(c Context) error {
+		change := models.InviteChange{NickName: c.QueryParam("nickname"), User: c.Param("user")}
+		return renderJSON(c)(m.uc.CancelInvite(c.Param("slug"), &change))
+	}
+}
+
+// /forum/{slug}/filters?viewer=
+func (m ForumHandlerManager) Filters() HandlerFunc {
+	return func(c Context) error {
+		return renderJSON(c)(m.uc.Filters(c.Param("slug"), c.QueryParam("viewer")))
+	}
+}
+
+// /forum/{slug}/filters
+func (m ForumHandlerManager) SetFilters() HandlerFunc {
+	return func(c Context) error {
+		change := models.FilterChange{}
+		if err := c.Bind(&change); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.SetFilters(c.Param("slug"), &change))
+	}
+}
+
+// /forum/{slug}/tags
+func (m ForumHandlerManager) Tags() HandlerFunc {
+	return func(c Context) error {
+		return renderJSON(c)(m.uc.Tags(c.Param("slug"), c.QueryParam("viewer")))
+	}
+}
+
+// /forum/{slug}/tags
+func (m ForumHandlerManager) SetTags() HandlerFunc {
+	return func(c Context) error {
+		change := models.ForumTags{}
+		if err := c.Bind(&change); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.SetTags(c.Param("slug"), &change))
+	}
+}
+
+// /forum/{slug}/subscribe
+func (m ForumHandlerManager) Subscribe() HandlerFunc {
+	return func(c Context) error {
+		sub := models.Subscription{}
+		if err := c.Bind(&sub); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Subscribe(c.Param("slug"), &sub))
+	}
+}
+
+// /forum/{slug}/subscribe?nickname=
+func (m ForumHandlerManager) Unsubscribe() HandlerFunc {
+	return func(c Context) error {
+		sub := models.Subscription{NickName: c.QueryParam("nickname")}
+		return renderJSON(c)(m.uc.Unsubscribe(c.Param("slug"), &sub))
+	}
+}
+
+// /forum/{slug}/stats
+func (m ForumHandlerManager) Stats() HandlerFunc {
+	return func(c Context) error {
+		from := c.QueryParam("from")
+		to := c.QueryParam("to")
+		bucket := c.QueryParam("bucket")
+		viewer := c.QueryParam("viewer")
 
-		return c.JSON(m.uc.Users(slug, limit, since, desc))
+		return renderJSON(c)(m.uc.Stats(c.Param("slug"), from, to, bucket, viewer))
 	}
 }
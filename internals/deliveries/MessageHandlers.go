@@ -0,0 +1,79 @@
+package deliveries
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/ApTyp5/new_db_techno/internals/usecases"
+	"github.com/jackc/pgx"
+	. "github.com/labstack/echo"
+)
+
+type MessageHandlerManager struct {
+	uc usecases.MessageUseCase
+}
+
+func CreateMessageHandlerManager(db *pgx.ConnPool) MessageHandlerManager {
+	return MessageHandlerManager{uc: usecases.CreateRDBMessageUseCase(db)}
+}
+
+// /messages
+func (m MessageHandlerManager) Send() HandlerFunc {
+	return func(c Context) error {
+		message := models.DirectMessage{}
+		if err := c.Bind(&message); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Send(&message))
+	}
+}
+
+// /user/{nickname}/conversations?viewer=
+func (m MessageHandlerManager) Conversations() HandlerFunc {
+	return func(c Context) error {
+		user := models.User{NickName: c.Param("nickname")}
+		viewer := c.QueryParam("viewer")
+		since := QueryNatural(c, "since")
+		limit := QueryNatural(c, "limit")
+
+		return renderJSON(c)(m.uc.Conversations(&user, viewer, since, limit))
+	}
+}
+
+// /conversation/{id}/messages?viewer=
+func (m MessageHandlerManager) Messages() HandlerFunc {
+	return func(c Context) error {
+		conv := models.Conversation{Id: PathNatural(c, "id")}
+		viewer := c.QueryParam("viewer")
+		since := QueryNatural(c, "since")
+		limit := QueryNatural(c, "limit")
+		desc := QueryBool(c, "desc")
+
+		return renderJSON(c)(m.uc.Messages(&conv, viewer, since, limit, desc))
+	}
+}
+
+// /user/{nickname}/block
+func (m MessageHandlerManager) Block() HandlerFunc {
+	return func(c Context) error {
+		block := models.UserBlock{}
+		if err := c.Bind(&block); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		block.User = c.Param("nickname")
+		return renderJSON(c)(m.uc.Block(&block))
+	}
+}
+
+// DELETE /user/{nickname}/block
+func (m MessageHandlerManager) Unblock() HandlerFunc {
+	return func(c Context) error {
+		block := models.UserBlock{}
+		if err := c.Bind(&block); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		block.User = c.Param("nickname")
+		return renderJSON(c)(m.uc.Unblock(&block))
+	}
+}
@@ -0,0 +1,42 @@
+package deliveries
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/ApTyp5/new_db_techno/internals/usecases"
+	"github.com/labstack/echo"
+)
+
+// recordingMessages -- запоминает, с чем вызван Unblock; остальные методы не нужны
+type recordingMessages struct {
+	usecases.MessageUseCase
+	unblocked *models.UserBlock
+}
+
+func (r *recordingMessages) Unblock(block *models.UserBlock) (int, interface{}) {
+	r.unblocked = block
+	return http.StatusOK, block
+}
+
+func TestUnblockTakesActorFromBody(t *testing.T) {
+	uc := &recordingMessages{}
+	e := echo.New()
+	e.DELETE("/user/:nickname/block", MessageHandlerManager{uc: uc}.Unblock())
+
+	req := httptest.NewRequest(http.MethodDelete, "/user/bob/block?nickname=mallory",
+		strings.NewReader(`{"nickname":"alice"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || uc.unblocked == nil {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	if uc.unblocked.NickName != "alice" || uc.unblocked.User != "bob" {
+		t.Fatalf("unblock %+v", uc.unblocked)
+	}
+}
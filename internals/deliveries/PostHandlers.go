@@ -22,8 +22,9 @@ func (m PostHandlerManager) Details() HandlerFunc {
 		postFull := models.PostFull{Post: &models.Post{}}
 		postFull.Post.Id = PathNatural(c, "id")
 		related := c.QueryParam("related")
+		viewer := c.QueryParam("viewer")
 
-		return c.JSON(m.uc.Details(&postFull, strings.Split(related, ",")))
+		return renderJSON(c)(m.uc.Details(&postFull, strings.Split(related, ","), viewer))
 	}
 }
 
@@ -34,6 +35,60 @@ func (m PostHandlerManager) Edit() HandlerFunc {
 		if err := c.Bind(&post); err != nil {
 			return c.JSON(retError(err))
 		}
-		return c.JSON(m.uc.Edit(&post))
+		return renderJSON(c)(m.uc.Edit(&post))
+	}
+}
+
+// /post/{id}/replies
+func (m PostHandlerManager) Replies() HandlerFunc {
+	return func(c Context) error {
+		post := models.Post{Id: PathNatural(c, "id")}
+		cursor := c.QueryParam("cursor")
+		limit := QueryNatural(c, "limit")
+		viewer := c.QueryParam("viewer")
+
+		return renderJSON(c)(m.uc.Replies(&post, cursor, limit, viewer))
+	}
+}
+
+// /post/{id}/split
+func (m PostHandlerManager) Split() HandlerFunc {
+	return func(c Context) error {
+		post := models.Post{Id: PathNatural(c, "id")}
+		split := models.ThreadSplit{}
+
+		if err := c.Bind(&split); err != nil {
+			return c.JSON(retError(err))
+		}
+		return renderJSON(c)(m.uc.Split(&post, &split))
+	}
+}
+
+// /post/{id}/vote
+func (m PostHandlerManager) Vote() HandlerFunc {
+	return func(c Context) error {
+		post := models.Post{Id: PathNatural(c, "id")}
+		vote := models.Vote{}
+
+		if err := c.Bind(&vote); err != nil {
+			return c.JSON(retError(err))
+		}
+		return renderJSON(c)(m.uc.Vote(&post, &vote))
+	}
+}
+
+// /post/{id}/vote, reaction -- снять реакцию, без неё -- голос
+func (m PostHandlerManager) Unvote() HandlerFunc {
+	return func(c Context) error {
+		post := models.Post{Id: PathNatural(c, "id")}
+
+		vote := models.Vote{NickName: c.QueryParam("nickname"), Reaction: c.QueryParam("reaction")}
+		if vote.NickName == "" {
+			if err := c.Bind(&vote); err != nil {
+				return c.JSON(retError(err))
+			}
+		}
+
+		return renderJSON(c)(m.uc.Unvote(&post, &vote))
 	}
 }
@@ -0,0 +1,56 @@
+package deliveries
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/ApTyp5/new_db_techno/internals/usecases"
+	"github.com/jackc/pgx"
+	. "github.com/labstack/echo"
+)
+
+type ReportHandlerManager struct {
+	uc usecases.ReportUseCase
+}
+
+func CreateReportHandlerManager(db *pgx.ConnPool) ReportHandlerManager {
+	return ReportHandlerManager{uc: usecases.CreateRDBReportUseCase(db)}
+}
+
+// /post/{id}/report
+func (m ReportHandlerManager) Create() HandlerFunc {
+	return func(c Context) error {
+		report := models.Report{}
+		if err := c.Bind(&report); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		report.Post = PathNatural(c, "id")
+		return renderJSON(c)(m.uc.Create(&report))
+	}
+}
+
+// /forum/{slug}/reports?nickname=&status=open|resolved
+func (m ReportHandlerManager) ByForum() HandlerFunc {
+	return func(c Context) error {
+		slug := c.Param("slug")
+		viewer := c.QueryParam("nickname")
+		status := c.QueryParam("status")
+		limit := QueryNatural(c, "limit")
+		since := QueryNatural(c, "since")
+		desc := QueryBool(c, "desc")
+
+		return renderJSON(c)(m.uc.ByForum(slug, viewer, status, limit, since, desc))
+	}
+}
+
+// /report/{id}/resolve
+func (m ReportHandlerManager) Resolve() HandlerFunc {
+	return func(c Context) error {
+		report := models.Report{Id: PathNatural(c, "id")}
+		resolution := models.ReportResolution{}
+		if err := c.Bind(&resolution); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Resolve(&report, &resolution))
+	}
+}
@@ -30,7 +30,7 @@ func (m ThreadHandlerManager) AddPosts() HandlerFunc {
 			return c.JSON(retError(err))
 		}
 
-		return c.JSON(m.uc.AddPosts(&thread, posts))
+		return renderJSON(c)(m.uc.AddPosts(&thread, posts))
 	}
 }
 
@@ -40,7 +40,9 @@ func (m ThreadHandlerManager) Details() HandlerFunc {
 			Id:   PathNatural(c, "slug_or_id"),
 			Slug: c.Param("slug_or_id"),
 		}
-		return c.JSON(m.uc.Details(&thread))
+		viewer := c.QueryParam("viewer")
+
+		return renderJSON(c)(m.uc.Details(&thread, viewer))
 	}
 }
 
@@ -55,7 +57,7 @@ func (m ThreadHandlerManager) Edit() HandlerFunc {
 			return c.JSON(retError(err))
 		}
 
-		return c.JSON(m.uc.Edit(&thread))
+		return renderJSON(c)(m.uc.Edit(&thread))
 	}
 }
 
@@ -66,14 +68,19 @@ func (m ThreadHandlerManager) Posts() HandlerFunc {
 			Slug: c.Param("slug_or_id"),
 		}
 
-		posts := make([]models.Post, 0, _const.BuffSize)
-
 		limit := QueryNatural(c, "limit")
 		since := QueryNatural(c, "since")
 		sort := c.QueryParam("sort")
 		desc := QueryBool(c, "desc")
+		viewer := c.QueryParam("viewer")
+
+		if sort == "threaded" {
+			replies := QueryNatural(c, "replies")
+			return renderJSON(c)(m.uc.ThreadedPosts(&thread, limit, since, replies, desc, viewer))
+		}
 
-		return c.JSON(m.uc.Posts(&posts, &thread, limit, since, sort, desc))
+		posts := make([]models.Post, 0, _const.BuffSize)
+		return renderJSON(c)(m.uc.Posts(&posts, &thread, limit, since, sort, desc, viewer))
 	}
 }
 
@@ -89,6 +96,210 @@ func (m ThreadHandlerManager) Vote() HandlerFunc {
 		if err := c.Bind(&vote); err != nil {
 			return c.JSON(retError(err))
 		}
-		return c.JSON(m.uc.Vote(&thread, &vote))
+		return renderJSON(c)(m.uc.Vote(&thread, &vote))
+	}
+}
+
+// DELETE /thread/{slug_or_id}/vote -- то же, что голос с voice = 0
+func (m ThreadHandlerManager) Unvote() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		vote := models.Vote{NickName: c.QueryParam("nickname")}
+		if vote.NickName == "" {
+			if err := c.Bind(&vote); err != nil {
+				return c.JSON(retError(err))
+			}
+		}
+
+		vote.Voice = 0
+		return renderJSON(c)(m.uc.Vote(&thread, &vote))
+	}
+}
+
+func (m ThreadHandlerManager) GetVote() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		vote := models.Vote{NickName: c.QueryParam("nickname")}
+		return renderJSON(c)(m.uc.GetVote(&thread, &vote))
+	}
+}
+
+func (m ThreadHandlerManager) Votes() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		limit := QueryNatural(c, "limit")
+		since := c.QueryParam("since")
+		desc := QueryBool(c, "desc")
+
+		viewer := c.QueryParam("viewer")
+
+		return renderJSON(c)(m.uc.Votes(&thread, limit, since, desc, viewer))
+	}
+}
+
+func (m ThreadHandlerManager) Moderate() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		moderation := models.ThreadModeration{}
+		if err := c.Bind(&moderation); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Moderate(&thread, &moderation))
+	}
+}
+
+// /thread/{slug_or_id}/move
+func (m ThreadHandlerManager) Move() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		move := models.ThreadMove{}
+		if err := c.Bind(&move); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Move(&thread, &move))
+	}
+}
+
+// /thread/{slug_or_id}/merge
+func (m ThreadHandlerManager) Merge() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		merge := models.ThreadMerge{}
+		if err := c.Bind(&merge); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Merge(&thread, &merge))
+	}
+}
+
+// /thread/{slug_or_id}/poll/vote
+func (m ThreadHandlerManager) PollVote() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		vote := models.PollVote{}
+		if err := c.Bind(&vote); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.PollVote(&thread, &vote))
+	}
+}
+
+// /thread/{slug_or_id}/accept
+func (m ThreadHandlerManager) Accept() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		accept := models.ThreadAccept{}
+		if err := c.Bind(&accept); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Accept(&thread, &accept))
+	}
+}
+
+// /thread/{slug_or_id}/subscribe
+func (m ThreadHandlerManager) Subscribe() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		sub := models.Subscription{}
+		if err := c.Bind(&sub); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Subscribe(&thread, &sub))
+	}
+}
+
+// /thread/{slug_or_id}/subscribe?nickname=
+func (m ThreadHandlerManager) Unsubscribe() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		sub := models.Subscription{NickName: c.QueryParam("nickname")}
+		return renderJSON(c)(m.uc.Unsubscribe(&thread, &sub))
+	}
+}
+
+// /thread/{slug_or_id}/read
+func (m ThreadHandlerManager) Read() HandlerFunc {
+	return func(c Context) error {
+		thread := models.Thread{
+			Id:   PathNatural(c, "slug_or_id"),
+			Slug: c.Param("slug_or_id"),
+		}
+
+		read := models.ThreadRead{}
+		if err := c.Bind(&read); err != nil {
+			return c.JSON(retError(err))
+		}
+
+		return renderJSON(c)(m.uc.Read(&thread, &read))
+	}
+}
+
+// /threads/hot
+func (m ThreadHandlerManager) Hot() HandlerFunc {
+	return func(c Context) error {
+		limit := QueryNatural(c, "limit")
+		since := QueryNatural(c, "since")
+		tag := c.QueryParam("tag")
+		tagMode := c.QueryParam("tag_mode")
+		viewer := c.QueryParam("viewer")
+
+		return renderJSON(c)(m.uc.Hot(limit, since, tag, tagMode, viewer))
+	}
+}
+
+// /tags
+func (m ThreadHandlerManager) Tags() HandlerFunc {
+	return func(c Context) error {
+		forum := c.QueryParam("forum")
+		limit := QueryNatural(c, "limit")
+		viewer := c.QueryParam("viewer")
+
+		return renderJSON(c)(m.uc.Tags(forum, limit, viewer))
 	}
 }
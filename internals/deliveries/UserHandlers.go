@@ -28,14 +28,14 @@ func (m UserHandlerManager) Create() HandlerFunc {
 			return c.JSON(retError(err))
 		}
 
-		return c.JSON(m.uc.Create(users, &user))
+		return renderJSON(c)(m.uc.Create(users, &user))
 	}
 }
 
 func (m UserHandlerManager) Profile() HandlerFunc {
 	return func(c Context) error {
 		user := models.User{NickName: c.Param("nickname")}
-		return c.JSON(m.uc.Get(&user))
+		return renderJSON(c)(m.uc.Get(&user))
 	}
 }
 
@@ -46,6 +46,75 @@ func (m UserHandlerManager) UpdateProfile() HandlerFunc {
 		if err := c.Bind(&user); err != nil {
 			return c.JSON(retError(err))
 		}
-		return c.JSON(m.uc.Update(&user))
+		return renderJSON(c)(m.uc.Update(&user))
+	}
+}
+
+func (m UserHandlerManager) Mentions() HandlerFunc {
+	return func(c Context) error {
+		user := models.User{NickName: c.Param("nickname")}
+		limit := QueryNatural(c, "limit")
+		since := QueryNatural(c, "since")
+		desc := QueryBool(c, "desc")
+		unread := QueryBool(c, "unread")
+
+		return renderJSON(c)(m.uc.Mentions(&user, limit, since, desc, unread))
+	}
+}
+
+func (m UserHandlerManager) ReadMentions() HandlerFunc {
+	return func(c Context) error {
+		user := models.User{NickName: c.Param("nickname")}
+		read := models.MentionsRead{}
+
+		if err := c.Bind(&read); err != nil {
+			return c.JSON(retError(err))
+		}
+		return renderJSON(c)(m.uc.ReadMentions(&user, &read))
+	}
+}
+
+func (m UserHandlerManager) Feed() HandlerFunc {
+	return func(c Context) error {
+		user := models.User{NickName: c.Param("nickname")}
+		cursor := c.QueryParam("cursor")
+		limit := QueryNatural(c, "limit")
+
+		return renderJSON(c)(m.uc.Feed(&user, cursor, limit))
+	}
+}
+
+func (m UserHandlerManager) Posts() HandlerFunc {
+	return func(c Context) error {
+		user := models.User{NickName: c.Param("nickname")}
+		forum := c.QueryParam("forum")
+		limit := QueryNatural(c, "limit")
+		since := QueryNatural(c, "since")
+		desc := QueryBool(c, "desc")
+
+		viewer := c.QueryParam("viewer")
+
+		return renderJSON(c)(m.uc.Posts(&user, forum, viewer, limit, since, desc))
+	}
+}
+
+func (m UserHandlerManager) Threads() HandlerFunc {
+	return func(c Context) error {
+		user := models.User{NickName: c.Param("nickname")}
+		forum := c.QueryParam("forum")
+		limit := QueryNatural(c, "limit")
+		since := QueryNatural(c, "since")
+		desc := QueryBool(c, "desc")
+
+		viewer := c.QueryParam("viewer")
+
+		return renderJSON(c)(m.uc.Threads(&user, forum, viewer, limit, since, desc))
+	}
+}
+
+func (m UserHandlerManager) Stats() HandlerFunc {
+	return func(c Context) error {
+		user := models.User{NickName: c.Param("nickname")}
+		return renderJSON(c)(m.uc.Stats(&user, c.QueryParam("viewer")))
 	}
 }
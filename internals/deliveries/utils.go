@@ -1,8 +1,12 @@
+// Package deliveries -- http-обработчики. Параметр ?viewer= не проверка доступа: аутентификации
+// в сервисе нет, viewer лишь выбирает, от чьего имени показывать приватные форумы,
+// скрытых блокировкой авторов и непрочитанное
 package deliveries
 
 import (
 	"github.com/ApTyp5/new_db_techno/internals/models"
 	. "github.com/labstack/echo"
+	"reflect"
 	"strconv"
 )
 
@@ -34,3 +38,55 @@ func QueryNatural(c Context, name string) int {
 func QueryBool(c Context, name string) bool {
 	return c.QueryParam(name) == "true"
 }
+
+// renderJSON -- ответ сценария; message_html хранится рядом с сообщением,
+// но попадает в ответ только с render=html
+func renderJSON(c Context) func(int, interface{}) error {
+	return func(status int, body interface{}) error {
+		if c.QueryParam("render") != "html" && body != nil {
+			body = withoutHTML(reflect.ValueOf(body)).Interface()
+		}
+		return c.JSON(status, body)
+	}
+}
+
+// withoutHTML -- копия значения без MessageHTML на любой глубине; указатели и слайсы
+// правятся на месте, значения копируются
+func withoutHTML(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Struct && !v.CanAddr() {
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		v = copied
+	}
+	clearHTML(v)
+	return v
+}
+
+func clearHTML(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			clearHTML(v.Elem())
+		}
+	case reflect.Interface:
+		if !v.IsNil() && v.CanSet() {
+			v.Set(withoutHTML(v.Elem()))
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			clearHTML(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+			if v.Type().Field(i).Name == "MessageHTML" && field.Kind() == reflect.String {
+				field.SetString("")
+			} else {
+				clearHTML(field)
+			}
+		}
+	}
+}
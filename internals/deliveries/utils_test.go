@@ -0,0 +1,39 @@
+package deliveries
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ApTyp5/new_db_techno/internals/models"
+)
+
+func TestWithoutHTML(t *testing.T) {
+	thread := &models.Thread{Message: "m", MessageHTML: "<p>m</p>"}
+	full := &models.PostFull{
+		Post:   &models.Post{Message: "p", MessageHTML: "<p>p</p>"},
+		Thread: thread,
+	}
+	posts := []models.Post{{MessageHTML: "<p>1</p>"}, {MessageHTML: "<p>2</p>"}}
+	threaded := []models.ThreadedPost{{Post: models.Post{MessageHTML: "<p>r</p>"},
+		Replies: models.Replies{Posts: []models.Post{{MessageHTML: "<p>c</p>"}}}}}
+	convs := models.Conversations{Conversations: []models.Conversation{
+		{LastMessage: &models.DirectMessage{MessageHTML: "<p>dm</p>"}}}}
+
+	withoutHTML(reflect.ValueOf(full))
+	withoutHTML(reflect.ValueOf(posts))
+	withoutHTML(reflect.ValueOf(threaded))
+	stripped := withoutHTML(reflect.ValueOf(convs)).Interface().(models.Conversations)
+
+	if full.Post.MessageHTML != "" || thread.MessageHTML != "" || full.Post.Message != "p" || thread.Message != "m" {
+		t.Fatalf("post full %+v %+v", full.Post, thread)
+	}
+	if posts[0].MessageHTML != "" || posts[1].MessageHTML != "" {
+		t.Fatalf("posts %+v", posts)
+	}
+	if threaded[0].MessageHTML != "" || threaded[0].Replies.Posts[0].MessageHTML != "" {
+		t.Fatalf("threaded %+v", threaded)
+	}
+	if stripped.Conversations[0].LastMessage.MessageHTML != "" {
+		t.Fatalf("conversations %+v", stripped)
+	}
+}
@@ -0,0 +1,298 @@
+package filters
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Verdict -- решение фильтра о сообщении
+type Verdict int
+
+const (
+	Accept Verdict = iota
+	Modify         // сообщение изменено (например, замаскированы слова), проверка продолжается
+	Reject         // сообщение отклонено
+	Hold           // сообщение принимается скрытым до решения модератора
+)
+
+// Content -- проверяемое сообщение поста или темы
+type Content struct {
+	Forum   string
+	Author  string
+	Message string
+}
+
+// Result -- итог работы конвейера; Filter -- имя фильтра, который вынес решение
+type Result struct {
+	Verdict Verdict
+	Filter  string
+	Reason  string
+}
+
+type Filter interface {
+	Name() string
+	Apply(content *Content) (Verdict, string, error)
+}
+
+// Pipeline -- фильтры применяются по порядку до первого Reject или Hold
+type Pipeline []Filter
+
+func (p Pipeline) Run(content *Content) (Result, error) {
+	result := Result{Verdict: Accept}
+
+	for _, filter := range p {
+		verdict, reason, err := filter.Apply(content)
+		if err != nil {
+			return result, errors.Wrap(err, filter.Name())
+		}
+
+		switch verdict {
+		case Modify:
+			result = Result{Verdict: Modify, Filter: filter.Name(), Reason: reason}
+		case Reject, Hold:
+			return Result{Verdict: verdict, Filter: filter.Name(), Reason: reason}, nil
+		}
+	}
+
+	return result, nil
+}
+
+// RecentFunc -- было ли у автора такое же сообщение после since
+type RecentFunc func(author string, message string, since time.Time) (bool, error)
+
+// Build -- конвейер по настройкам форума
+func Build(config *models.FilterConfig, recent RecentFunc) (Pipeline, error) {
+	pipeline := Pipeline{}
+
+	if config.MaxLength > 0 {
+		pipeline = append(pipeline, MaxLength{Max: config.MaxLength})
+	}
+
+	if len(config.BannedWords) > 0 {
+		verdict, err := parseVerdict(config.BannedWordsMode, Modify)
+		if err != nil {
+			return nil, errors.Wrap(err, "banned_words_mode")
+		}
+		pipeline = append(pipeline, NewBannedWords(config.BannedWords, verdict))
+	}
+
+	if config.MaxLinks != nil {
+		verdict, err := parseVerdict(config.LinksAction, Reject)
+		if err != nil || verdict == Modify {
+			return nil, errors.New("links_action must be reject or hold")
+		}
+		pipeline = append(pipeline, LinkLimit{Max: *config.MaxLinks, OnFail: verdict})
+	}
+
+	if config.DuplicateWindow != "" {
+		window, err := time.ParseDuration(config.DuplicateWindow)
+		if err != nil || window <= 0 {
+			return nil, errors.New("duplicate_window must be a positive duration")
+		}
+		pipeline = append(pipeline, NewDuplicate(window, recent))
+	}
+
+	return pipeline, nil
+}
+
+func parseVerdict(mode string, def Verdict) (Verdict, error) {
+	switch mode {
+	case "":
+		return def, nil
+	case "mask":
+		return Modify, nil
+	case "reject":
+		return Reject, nil
+	case "hold":
+		return Hold, nil
+	}
+	return Accept, errors.New("unknown mode " + mode)
+}
+
+// MaxLength -- ограничение длины сообщения в символах
+type MaxLength struct {
+	Max int
+}
+
+func (f MaxLength) Name() string {
+	return "max_length"
+}
+
+func (f MaxLength) Apply(content *Content) (Verdict, string, error) {
+	if utf8.RuneCountInString(content.Message) > f.Max {
+		return Reject, "message is longer than " + strconv.Itoa(f.Max) + " characters", nil
+	}
+	return Accept, "", nil
+}
+
+// BannedWords -- запрещённые слова и фразы маскируются звёздочками (Modify) или приводят к OnMatch;
+// слова сравниваются без учёта регистра целиком, в том числе кириллические, слова фразы могут
+// разделяться в сообщении любыми небуквенными символами
+type BannedWords struct {
+	phrases [][]string
+	OnMatch Verdict
+}
+
+func NewBannedWords(words []string, onMatch Verdict) BannedWords {
+	phrases := make([][]string, 0, len(words))
+	for _, phrase := range words {
+		lower := strings.ToLower(phrase)
+		spans := wordSpans(lower)
+		if len(spans) == 0 {
+			continue
+		}
+
+		tokens := make([]string, 0, len(spans))
+		for _, span := range spans {
+			tokens = append(tokens, lower[span[0]:span[1]])
+		}
+		phrases = append(phrases, tokens)
+	}
+
+	return BannedWords{phrases: phrases, OnMatch: onMatch}
+}
+
+func (f BannedWords) Name() string {
+	return "banned_words"
+}
+
+func (f BannedWords) Apply(content *Content) (Verdict, string, error) {
+	spans := wordSpans(content.Message)
+	words := make([]string, 0, len(spans))
+	for _, span := range spans {
+		words = append(words, strings.ToLower(content.Message[span[0]:span[1]]))
+	}
+
+	masked := make([]bool, len(words))
+	matched := false
+	for i := range words {
+		for _, phrase := range f.phrases {
+			if !hasPhraseAt(words, i, phrase) {
+				continue
+			}
+			matched = true
+			for j := range phrase {
+				masked[i+j] = true
+			}
+		}
+	}
+
+	if !matched {
+		return Accept, "", nil
+	}
+
+	if f.OnMatch != Modify {
+		return f.OnMatch, "message contains banned words", nil
+	}
+
+	var result strings.Builder
+	last := 0
+	for i, span := range spans {
+		if !masked[i] {
+			continue
+		}
+		result.WriteString(content.Message[last:span[0]])
+		result.WriteString(strings.Repeat("*", utf8.RuneCountInString(content.Message[span[0]:span[1]])))
+		last = span[1]
+	}
+	result.WriteString(content.Message[last:])
+
+	content.Message = result.String()
+	return Modify, "banned words masked", nil
+}
+
+func hasPhraseAt(words []string, i int, phrase []string) bool {
+	if i+len(phrase) > len(words) {
+		return false
+	}
+	for j := range phrase {
+		if words[i+j] != phrase[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// wordSpans -- границы слов (подряд идущих букв и цифр) в байтах
+func wordSpans(s string) [][2]int {
+	spans := make([][2]int, 0)
+	start := -1
+	for i, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+var linkRe = regexp.MustCompile(`(?i)\b(https?://|www\.)\S+`)
+
+// LinkLimit -- не больше Max ссылок в сообщении
+type LinkLimit struct {
+	Max    int
+	OnFail Verdict
+}
+
+func (f LinkLimit) Name() string {
+	return "max_links"
+}
+
+func (f LinkLimit) Apply(content *Content) (Verdict, string, error) {
+	if len(linkRe.FindAllStringIndex(content.Message, f.Max+1)) > f.Max {
+		return f.OnFail, "message contains more than " + strconv.Itoa(f.Max) + " links", nil
+	}
+	return Accept, "", nil
+}
+
+// Duplicate -- то же сообщение того же автора в пределах Window; конвейер строится на запрос,
+// так что seen ловит повторы внутри одной пачки постов, которых ещё нет в базе
+type Duplicate struct {
+	Window time.Duration
+	Recent RecentFunc
+	seen   map[string]bool
+}
+
+func NewDuplicate(window time.Duration, recent RecentFunc) *Duplicate {
+	return &Duplicate{Window: window, Recent: recent, seen: make(map[string]bool)}
+}
+
+func (f *Duplicate) Name() string {
+	return "duplicate"
+}
+
+func (f *Duplicate) Apply(content *Content) (Verdict, string, error) {
+	reason := "same message was posted less than " + f.Window.String() + " ago"
+
+	key := strings.ToLower(content.Author) + "\x00" + content.Message
+	if f.seen[key] {
+		return Reject, reason, nil
+	}
+
+	found, err := f.Recent(content.Author, content.Message, time.Now().Add(-f.Window))
+	if err != nil {
+		return Accept, "", err
+	}
+
+	if found {
+		return Reject, reason, nil
+	}
+
+	f.seen[key] = true
+	return Accept, "", nil
+}
@@ -0,0 +1,128 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ApTyp5/new_db_techno/internals/models"
+)
+
+func noRecent(string, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func TestBannedWordsMask(t *testing.T) {
+	f := NewBannedWords([]string{"Spam", "купи слона", "  "}, Modify)
+
+	cases := []struct {
+		message string
+		want    string
+		verdict Verdict
+	}{
+		{"no problem here", "no problem here", Accept},
+		{"SPAM and spammer", "**** and spammer", Modify},
+		{"Купи   слона!", "****   *****!", Modify},
+		{"купи-слона, купи кота", "****-*****, купи кота", Modify},
+		{"купи", "купи", Accept},
+		{"слона купи", "слона купи", Accept},
+	}
+
+	for _, c := range cases {
+		content := Content{Message: c.message}
+		verdict, _, err := f.Apply(&content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verdict != c.verdict || content.Message != c.want {
+			t.Errorf("%q: got %q (%d), want %q (%d)", c.message, content.Message, verdict, c.want, c.verdict)
+		}
+	}
+}
+
+func TestBannedWordsReject(t *testing.T) {
+	f := NewBannedWords([]string{"very bad"}, Hold)
+
+	content := Content{Message: "this is VERY  bad"}
+	if verdict, _, _ := f.Apply(&content); verdict != Hold || content.Message != "this is VERY  bad" {
+		t.Fatalf("verdict %d, message %q", verdict, content.Message)
+	}
+}
+
+func TestLinkLimit(t *testing.T) {
+	f := LinkLimit{Max: 1, OnFail: Reject}
+
+	if verdict, _, _ := f.Apply(&Content{Message: "see https://a.example"}); verdict != Accept {
+		t.Fatalf("one link verdict %d", verdict)
+	}
+	if verdict, _, _ := f.Apply(&Content{Message: "https://a.example and www.b.example"}); verdict != Reject {
+		t.Fatalf("two links verdict %d", verdict)
+	}
+}
+
+func TestDuplicateInBatch(t *testing.T) {
+	recent := func(author string, message string, since time.Time) (bool, error) {
+		return author == "bob" && message == "old", nil
+	}
+	f := NewDuplicate(time.Minute, recent)
+
+	steps := []struct {
+		author, message string
+		verdict         Verdict
+	}{
+		{"alice", "hello", Accept},
+		{"bob", "hello", Accept},
+		{"ALICE", "hello", Reject},
+		{"bob", "old", Reject},
+		{"alice", "other", Accept},
+	}
+	for _, s := range steps {
+		if verdict, _, _ := f.Apply(&Content{Author: s.author, Message: s.message}); verdict != s.verdict {
+			t.Errorf("%s %q: verdict %d, want %d", s.author, s.message, verdict, s.verdict)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	maxLinks := 0
+	pipeline, err := Build(&models.FilterConfig{
+		MaxLength:       20,
+		BannedWords:     []string{"darn"},
+		MaxLinks:        &maxLinks,
+		LinksAction:     "hold",
+		DuplicateWindow: "1m",
+	}, noRecent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := Content{Message: "darn it"}
+	if result, _ := pipeline.Run(&content); result.Verdict != Modify || content.Message != "**** it" {
+		t.Fatalf("masked %+v %q", result, content.Message)
+	}
+
+	// после маскировки проверка продолжается, ссылка задерживает сообщение
+	content = Content{Message: "darn www.a.example"}
+	if result, _ := pipeline.Run(&content); result.Verdict != Hold || result.Filter != "max_links" {
+		t.Fatalf("held %+v", result)
+	}
+
+	content = Content{Message: "this message is far too long"}
+	if result, _ := pipeline.Run(&content); result.Verdict != Reject || result.Filter != "max_length" {
+		t.Fatalf("rejected %+v", result)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	maxLinks := 1
+	configs := []models.FilterConfig{
+		{BannedWords: []string{"x"}, BannedWordsMode: "drop"},
+		{MaxLinks: &maxLinks, LinksAction: "mask"},
+		{DuplicateWindow: "soon"},
+		{DuplicateWindow: "-1m"},
+	}
+	for _, config := range configs {
+		if _, err := Build(&config, noRecent); err == nil {
+			t.Errorf("%+v: no error", config)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package markup
+
+import (
+	"bytes"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithParserOptions(
+			parser.WithInlineParsers(util.Prioritized(referenceParser{}, 999)),
+			parser.WithASTTransformers(util.Prioritized(referenceUnwrapper{}, 999))),
+		goldmark.WithRendererOptions(
+			renderer.WithNodeRenderers(util.Prioritized(referenceRenderer{}, 999))))
+
+	// сырой HTML goldmark и так не пропускает, политика вычищает опасные ссылки и атрибуты
+	policy = bluemonday.UGCPolicy()
+)
+
+// Mentions -- ники, упомянутые в сообщении через @nickname, без повторов;
+// упоминания внутри кода и ссылок не считаются
+func Mentions(message string) []string {
+	source := []byte(message)
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	nicks := make([]string, 0)
+	seen := make(map[string]bool)
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if ref, ok := n.(*reference); ok && entering && ref.Nick != "" && !seen[strings.ToLower(ref.Nick)] {
+			seen[strings.ToLower(ref.Nick)] = true
+			nicks = append(nicks, ref.Nick)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return nicks
+}
+
+// Render -- HTML сообщения: CommonMark, ссылки на @пользователей и #посты, очистка от XSS
+func Render(message string) (string, error) {
+	buf := bytes.Buffer{}
+	if err := markdown.Convert([]byte(message), &buf); err != nil {
+		return "", err
+	}
+
+	return policy.Sanitize(buf.String()), nil
+}
+
+var kindReference = ast.NewNodeKind("Reference")
+
+// reference -- ссылка на пользователя или пост; отдельный узел, а не ast.Link,
+// чтобы не ломать обычные ссылки, в тексте которых встречается @nickname
+type reference struct {
+	ast.BaseInline
+	Destination []byte
+	Nick        string // пусто для ссылки на пост
+}
+
+func (n *reference) Kind() ast.NodeKind {
+	return kindReference
+}
+
+func (n *reference) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Destination": string(n.Destination)}, nil)
+}
+
+// referenceParser -- ссылки вида @nickname на профиль и #123 на пост
+type referenceParser struct{}
+
+func (referenceParser) Trigger() []byte {
+	return []byte{'@', '#'}
+}
+
+func (referenceParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if isWordRune(block.PrecendingCharacter()) {
+		return nil
+	}
+
+	line, segment := block.PeekLine()
+	n := referenceLength(line)
+	if n == 0 {
+		return nil
+	}
+
+	ref := &reference{}
+	if line[0] == '@' {
+		ref.Nick = string(line[1:n])
+		ref.Destination = []byte("/api/user/" + url.PathEscape(ref.Nick) + "/profile")
+	} else {
+		ref.Destination = []byte("/api/post/" + string(line[1:n]) + "/details")
+	}
+	ref.AppendChild(ref, ast.NewTextSegment(segment.WithStop(segment.Start+n)))
+	block.Advance(n)
+
+	return ref
+}
+
+// referenceUnwrapper -- внутри обычной ссылки @nickname и #123 остаются текстом
+type referenceUnwrapper struct{}
+
+func (referenceUnwrapper) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	nested := make([]ast.Node, 0)
+	depth := 0
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch n.Kind() {
+		case ast.KindLink, ast.KindAutoLink, ast.KindImage:
+			if entering {
+				depth++
+			} else {
+				depth--
+			}
+		case kindReference:
+			if entering && depth > 0 {
+				nested = append(nested, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, n := range nested {
+		n.Parent().ReplaceChild(n.Parent(), n, n.FirstChild())
+	}
+}
+
+type referenceRenderer struct{}
+
+func (referenceRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindReference, renderReference)
+}
+
+func renderReference(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<a href="`)
+		_, _ = w.Write(util.EscapeHTML(util.URLEscape(n.(*reference).Destination, true)))
+		_, _ = w.WriteString(`">`)
+	} else {
+		_, _ = w.WriteString("</a>")
+	}
+	return ast.WalkContinue, nil
+}
+
+// referenceLength -- длина ссылки в начале строки, 0 -- ссылки нет
+func referenceLength(line []byte) int {
+	n := 1
+	if line[0] == '@' {
+		for n < len(line) && isNickByte(line[n]) {
+			n++
+		}
+		// точка в конце -- конец предложения, а не часть ника
+		for n > 1 && line[n-1] == '.' {
+			n--
+		}
+	} else {
+		for n < len(line) && line[n] >= '0' && line[n] <= '9' {
+			n++
+		}
+		if n < len(line) && isNickByte(line[n]) {
+			return 0
+		}
+	}
+
+	if n == 1 {
+		return 0
+	}
+	return n
+}
+
+func isNickByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_' || b == '.'
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '@' || r == '#'
+}
@@ -0,0 +1,82 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderStripsXSS(t *testing.T) {
+	messages := []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`[click](javascript:alert(1))`,
+		`[click](JAVASCRIPT:alert(1))`,
+		`![img](javascript:alert(1))`,
+		`<a href="javascript:alert(1)">click</a>`,
+		`<iframe src="https://evil.example"></iframe>`,
+		`<svg onload=alert(1)>`,
+		`[click](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)`,
+		`<div style="background:url(javascript:alert(1))">x</div>`,
+		"@nick\"onmouseover=alert(1)",
+		`[@nick](javascript:alert(1))`,
+	}
+
+	forbidden := []string{"<script", "javascript:", "onerror", "onload", `"onmouseover`, "<iframe", "<svg",
+		"data:text/html", "style="}
+
+	for _, message := range messages {
+		html, err := Render(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lower := strings.ToLower(html)
+		for _, f := range forbidden {
+			if strings.Contains(lower, f) {
+				t.Errorf("%q rendered as %q, contains %q", message, html, f)
+			}
+		}
+	}
+}
+
+func TestRenderReferences(t *testing.T) {
+	cases := []struct {
+		message string
+		want    string
+	}{
+		{"hi @bob.", `<a href="/api/user/bob/profile" rel="nofollow">@bob</a>.`},
+		{"see #12", `<a href="/api/post/12/details" rel="nofollow">#12</a>`},
+		{"mail bob@example.com", "mail bob@example.com"},
+		{"`@bob`", "<code>@bob</code>"},
+		{"#12abc", "#12abc"},
+	}
+
+	for _, c := range cases {
+		html, err := Render(c.message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(html, c.want) {
+			t.Errorf("%q rendered as %q, want %q", c.message, html, c.want)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	cases := []struct {
+		message string
+		want    []string
+	}{
+		{"@alice and @Bob, @alice again", []string{"alice", "Bob"}},
+		{"thanks @carol.", []string{"carol"}},
+		{"bob@example.com and `@dave`", []string{}},
+		{"[@erin](https://example.com) @frank_1", []string{"frank_1"}},
+		{"```\n@gina\n```", []string{}},
+	}
+
+	for _, c := range cases {
+		got := Mentions(c.message)
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%q: mentions %v, want %v", c.message, got, c.want)
+		}
+	}
+}
@@ -7,22 +7,197 @@ type Error struct {
 }
 
 type Forum struct {
-	Posts   int    `json:"posts"`
-	Slug    string `json:"slug"`
-	Threads int    `json:"threads"`
-	Title   string `json:"title"`
-	User    string `json:"user"`
+	Posts      int    `json:"posts"`
+	Slug       string `json:"slug"`
+	Threads    int    `json:"threads"`
+	Title      string `json:"title"`
+	User       string `json:"user"`
+	Parent     string `json:"parent,omitempty"`
+	Type       string `json:"type"`       // discussion или qa
+	Visibility string `json:"visibility"` // public, private или read_only
+	// только в /forum/{slug}/details: путь от корня до форума и счётчики по всему поддереву
+	Breadcrumb     []ForumCrumb `json:"breadcrumb,omitempty"`
+	SubtreePosts   int          `json:"subtree_posts,omitempty"`
+	SubtreeThreads int          `json:"subtree_threads,omitempty"`
+}
+
+type ForumCrumb struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+const (
+	ForumDiscussion = "discussion"
+	ForumQA         = "qa"
+)
+
+const (
+	VisibilityPublic   = "public"
+	VisibilityPrivate  = "private"   // читают и пишут только участники, остальным форум не виден
+	VisibilityReadOnly = "read_only" // пишут только владелец и модераторы
+)
+
+const (
+	InviteByModerator = "invite"
+	InviteRequest     = "request"
+)
+
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+	RoleBanned    = "banned"
+)
+
+// ForumRole -- роль пользователя в форуме, Expires -- срок действия (для временных банов)
+type ForumRole struct {
+	Forum   string     `json:"forum"`
+	User    string     `json:"user"`
+	Role    string     `json:"role"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// ForumInvite -- приглашение в форум или просьба о вступлении
+type ForumInvite struct {
+	Forum     string    `json:"forum"`
+	User      string    `json:"user"`
+	Kind      string    `json:"kind"`
+	InvitedBy string    `json:"invited_by,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// InviteChange -- NickName приглашает User; при вступлении User не нужен
+type InviteChange struct {
+	NickName string `json:"nickname"`
+	User     string `json:"user"`
+}
+
+// RoleChange -- выдача или отзыв роли пользователем NickName
+type RoleChange struct {
+	NickName string `json:"nickname"`
+	ForumRole
 }
 
 type Post struct {
-	Author   string    `json:"author"`
+	Author      string         `json:"author"`
+	Created     time.Time      `json:"created"`
+	Forum       string         `json:"forum"`
+	Id          int            `json:"id"`
+	IsEdited    bool           `json:"isEdited"`
+	Message     string         `json:"message"` // updated
+	Parent      int            `json:"parent"`
+	Thread      int            `json:"thread"`
+	Votes       int            `json:"votes"`
+	Reactions   map[string]int `json:"reactions,omitempty"`
+	Hidden      bool           `json:"hidden,omitempty"`
+	Held        string         `json:"-"`                      // причина, по которой фильтр задержал пост до проверки
+	MessageHTML string         `json:"message_html,omitempty"` // отрисованный Message, только с render=html
+	Mentions    []string       `json:"-"`                      // ники из @nickname в Message
+	Muted       bool           `json:"muted,omitempty"`        // автор заглушён читателем, вместо поста заглушка
+}
+
+// Mention -- упоминание пользователя в посте
+type Mention struct {
+	Id      int       `json:"id"`
+	Post    int       `json:"post"`
+	Thread  int       `json:"thread"`
+	Forum   string    `json:"forum"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"created"`
+	Message string    `json:"message"`
+	Read    bool      `json:"read"`
+}
+
+// MentionsRead -- упоминания, которые нужно отметить прочитанными; пустой Ids -- все
+type MentionsRead struct {
+	Ids []int `json:"ids"`
+}
+
+type MentionsUnread struct {
+	Unread int `json:"unread"`
+}
+
+// Subscription -- подписка пользователя на тему или форум
+type Subscription struct {
+	NickName string    `json:"nickname"`
+	Thread   int       `json:"thread,omitempty"`
+	Forum    string    `json:"forum,omitempty"`
 	Created  time.Time `json:"created"`
-	Forum    string    `json:"forum"`
-	Id       int       `json:"id"`
-	IsEdited bool      `json:"isEdited"`
-	Message  string    `json:"message"` // updated
-	Parent   int       `json:"parent"`
-	Thread   int       `json:"thread"`
+}
+
+const (
+	FeedPost   = "post"
+	FeedThread = "thread"
+)
+
+// FeedItem -- событие ленты: новый пост в теме или новая тема на форуме из подписок
+type FeedItem struct {
+	Kind    string    `json:"kind"`
+	Created time.Time `json:"created"`
+	Post    *Post     `json:"post,omitempty"`
+	Thread  *Thread   `json:"thread,omitempty"`
+}
+
+// Feed -- страница ленты, Next -- курсор следующей страницы
+type Feed struct {
+	Items []FeedItem `json:"items"`
+	Next  string     `json:"next,omitempty"`
+}
+
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportHidden    = "hidden"
+	ReportBanned    = "banned"
+)
+
+// Report -- жалоба пользователя NickName на пост, Author и Message -- содержимое поста для модератора
+type Report struct {
+	Id         int       `json:"id"`
+	Post       int       `json:"post"`
+	Forum      string    `json:"forum"`
+	NickName   string    `json:"nickname"`
+	Reason     string    `json:"reason"`
+	Created    time.Time `json:"created"`
+	Status     string    `json:"status"`
+	ResolvedBy string    `json:"resolved_by,omitempty"`
+	Author     string    `json:"author"`
+	Message    string    `json:"message"`
+}
+
+// ReportResolution -- решение модератора: dismiss, hide или ban (Expires -- срок бана)
+type ReportResolution struct {
+	NickName string     `json:"nickname"`
+	Action   string     `json:"action"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+// Replies -- порция ответов на пост и токен для загрузки следующей
+type Replies struct {
+	Posts []Post `json:"posts"`
+	Next  string `json:"next,omitempty"`
+}
+
+// ThreadedPost -- корневой пост с первыми ответами (sort=threaded)
+type ThreadedPost struct {
+	Post
+	Replies Replies `json:"replies"`
+}
+
+// FilterConfig -- настройки фильтров сообщений форума, пустые поля -- фильтр выключен
+type FilterConfig struct {
+	MaxLength       int      `json:"max_length,omitempty"`
+	BannedWords     []string `json:"banned_words,omitempty"`
+	BannedWordsMode string   `json:"banned_words_mode,omitempty"` // mask, reject, hold
+	MaxLinks        *int     `json:"max_links,omitempty"`
+	LinksAction     string   `json:"links_action,omitempty"`     // reject, hold
+	DuplicateWindow string   `json:"duplicate_window,omitempty"` // например, 10m
+}
+
+// FilterChange -- изменение настроек фильтров пользователем NickName
+type FilterChange struct {
+	NickName string `json:"nickname"`
+	FilterConfig
 }
 
 type Status struct {
@@ -33,14 +208,146 @@ type Status struct {
 }
 
 type Thread struct {
-	Author  string    `json:"author"`
-	Created time.Time `json:"created"`
-	Forum   string    `json:"forum"`
-	Id      int       `json:"id"`
-	Message string    `json:"message"` // updated
-	Slug    string    `json:"slug"`
-	Title   string    `json:"title"` // updated
-	Votes   int       `json:"votes"`
+	Author      string    `json:"author"`
+	Created     time.Time `json:"created"`
+	Forum       string    `json:"forum"`
+	Id          int       `json:"id"`
+	Message     string    `json:"message"` // updated
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"` // updated
+	Votes       int       `json:"votes"`
+	Locked      bool      `json:"locked"`
+	Pinned      bool      `json:"pinned"`
+	Closed      bool      `json:"closed"`
+	CloseReason string    `json:"close_reason,omitempty"`
+	MessageHTML string    `json:"message_html,omitempty"`
+	HotScore    float64   `json:"hot_score,omitempty"` // только в sort=hot, затухший к текущему моменту
+	MovedTo     string    `json:"moved_to,omitempty"`  // заглушка перенесённой темы в старом форуме
+	Tags        []string  `json:"tags"`                // при правке nil -- не менять
+	Poll        *Poll     `json:"poll,omitempty"`      // задаётся при создании, в ответе -- в details
+	// принятый ответ темы qa-форума, только в details и списке тем форума
+	AcceptedPost int `json:"accepted_post,omitempty"`
+	// только если известен viewer
+	UnreadCount       *int `json:"unread_count,omitempty"`
+	FirstUnreadPostId int  `json:"first_unread_post_id,omitempty"`
+	Muted             bool `json:"muted,omitempty"` // автор заглушён читателем, тема свёрнута
+	// задержана фильтром: не попадает в общие списки, видна автору и модераторам
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+// ForumStats -- статистика форума за [From, To) с разбивкой по Bucket (day или hour)
+type ForumStats struct {
+	Forum      string        `json:"forum"`
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Bucket     string        `json:"bucket"`
+	Series     []StatsBucket `json:"series"`
+	TopPosters []TopPoster   `json:"top_posters"`
+	TopThreads []Thread      `json:"top_threads"`
+}
+
+type StatsBucket struct {
+	Start        time.Time `json:"start"`
+	Posts        int       `json:"posts"`
+	Threads      int       `json:"threads"`
+	Participants int       `json:"participants"`
+}
+
+type TopPoster struct {
+	NickName string `json:"nickname"`
+	Posts    int    `json:"posts"`
+}
+
+// UserStats -- сводка активности пользователя; Votes -- сумма голосов за его темы
+type UserStats struct {
+	NickName string   `json:"nickname"`
+	Posts    int      `json:"posts"`
+	Threads  int      `json:"threads"`
+	Forums   []string `json:"forums"`
+	Votes    int      `json:"votes_received"`
+}
+
+// ThreadRead -- последний прочитанный пользователем пост темы
+type ThreadRead struct {
+	NickName    string `json:"nickname"`
+	Thread      int    `json:"thread"`
+	Post        int    `json:"post"`
+	UnreadCount int    `json:"unread_count"`
+}
+
+// ThreadModeration -- изменение флагов темы владельцем форума, nil -- не менять
+type ThreadModeration struct {
+	NickName string `json:"nickname"`
+	Locked   *bool  `json:"locked"`
+	Pinned   *bool  `json:"pinned"`
+	Closed   *bool  `json:"closed"`
+	Reason   string `json:"reason"`
+	Hidden   *bool  `json:"hidden"` // false -- одобрить задержанную фильтром тему
+}
+
+// ThreadMove -- перенос темы в форум Forum
+type ThreadMove struct {
+	NickName string    `json:"nickname"`
+	Thread   int       `json:"thread"`
+	From     string    `json:"from"`
+	Forum    string    `json:"forum"`
+	Created  time.Time `json:"created"`
+}
+
+// ThreadMerge -- вливание темы Source (слаг или id) в тему из пути
+type ThreadMerge struct {
+	NickName string `json:"nickname"`
+	Source   string `json:"source"`
+}
+
+// ThreadSplit -- новая тема из поддерева поста, пустые Forum и Message -- форум темы и сообщение поста
+type ThreadSplit struct {
+	NickName string `json:"nickname"`
+	Title    string `json:"title"`
+	Slug     string `json:"slug"`
+	Forum    string `json:"forum"`
+	Message  string `json:"message"`
+}
+
+// ThreadAccept -- автор темы отмечает принятый ответ, Post == 0 -- снять отметку
+type ThreadAccept struct {
+	NickName string `json:"nickname"`
+	Post     int    `json:"post"`
+}
+
+// Poll -- опрос темы; при создании из вариантов нужен только Text
+type Poll struct {
+	Question string       `json:"question"`
+	Options  []PollOption `json:"options"`
+	Multiple bool         `json:"multiple"`
+	Closes   *time.Time   `json:"closes,omitempty"`
+	Closed   bool         `json:"closed"`
+	Voters   int          `json:"voters"`
+	Choice   []int        `json:"choice,omitempty"` // варианты, выбранные viewer
+}
+
+type PollOption struct {
+	Id    int    `json:"id"`
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// PollVote -- бюллетень NickName, заменяет предыдущий
+type PollVote struct {
+	NickName string `json:"nickname"`
+	Options  []int  `json:"options"`
+}
+
+// ForumTags -- разрешённые в форуме теги, пустой список снимает ограничение
+type ForumTags struct {
+	NickName string   `json:"nickname,omitempty"`
+	Tags     []string `json:"tags"`
+}
+
+// TagCount -- сколько тем помечено тегом
+type TagCount struct {
+	Tag     string `json:"tag"`
+	Threads int    `json:"threads"`
 }
 
 type User struct {
@@ -53,6 +360,7 @@ type User struct {
 type Vote struct {
 	NickName string `json:"nickname"`
 	Voice    int    `json:"voice"`
+	Reaction string `json:"reaction,omitempty"` // только для голосов за посты
 }
 
 type PostFull struct {
@@ -61,3 +369,47 @@ type PostFull struct {
 	Post   *Post   `json:"post"`
 	Thread *Thread `json:"thread"`
 }
+
+// DirectMessage -- личное сообщение; To -- адресаты при первом сообщении, иначе указывается Conversation
+type DirectMessage struct {
+	Id           int       `json:"id"`
+	Conversation int       `json:"conversation"`
+	Author       string    `json:"author"`
+	To           []string  `json:"to,omitempty"`
+	Message      string    `json:"message"`
+	MessageHTML  string    `json:"message_html,omitempty"`
+	Created      time.Time `json:"created"`
+	ReadBy       []string  `json:"read_by"` // участники, кроме автора, прочитавшие сообщение
+}
+
+type DirectMessages struct {
+	Messages []DirectMessage `json:"messages"`
+	Next     string          `json:"next,omitempty"`
+}
+
+// Conversation -- беседа с точки зрения одного участника
+type Conversation struct {
+	Id          int            `json:"id"`
+	Members     []string       `json:"members"`
+	LastMessage *DirectMessage `json:"last_message,omitempty"`
+	Unread      int            `json:"unread"`
+}
+
+type Conversations struct {
+	Conversations []Conversation `json:"conversations"`
+	Next          string         `json:"next,omitempty"`
+}
+
+// UserBlock -- NickName не видит постов и тем User, а при Kind = block
+// ещё и не получает от него личных сообщений и упоминаний
+type UserBlock struct {
+	NickName string    `json:"nickname"`
+	User     string    `json:"user"`
+	Kind     string    `json:"kind"` // block или mute, по умолчанию block
+	Created  time.Time `json:"created"`
+}
+
+const (
+	BlockFull = "block"
+	BlockMute = "mute"
+)
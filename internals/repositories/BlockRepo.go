@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+type BlockRepo interface {
+	// user.Block, повторный вызов меняет kind; ErrNoRows -- кого-то из пользователей нет
+	Insert(block *models.UserBlock) error
+	Delete(block *models.UserBlock) error // ErrNoRows -- блокировки не было
+	// первый из nicks, заблокировавший author, ErrNoRows -- таких нет
+	SelectBlocking(author string, nicks []string, nick *string) error
+	// заблокированные или заглушённые viewer, ники в нижнем регистре
+	SelectMuted(viewer string, muted map[string]bool) error
+}
+
+type PSQLBlockRepo struct {
+	db             *pgx.ConnPool
+	insert         *pgx.PreparedStatement
+	delete         *pgx.PreparedStatement
+	selectBlocking *pgx.PreparedStatement
+	selectMuted    *pgx.PreparedStatement
+}
+
+func CreatePSQLBlockRepo(db *pgx.ConnPool) BlockRepo {
+	var err error
+	prefix := "block_"
+	repo := PSQLBlockRepo{db: db}
+
+	// повторная блокировка не меняет дату
+	repo.insert, err = db.Prepare(prefix+"insert", `
+		insert into user_blocks (user_nick, blocked, kind)
+			select u.nick_name, b.nick_name, $3 from users u, users b
+				where u.nick_name = $1 and b.nick_name = $2
+		on conflict (user_nick, blocked) do update set kind = excluded.kind
+		returning user_nick, blocked, kind, created;
+	`)
+	panicIfErr(err)
+
+	repo.delete, err = db.Prepare(prefix+"delete", `
+		delete from user_blocks where user_nick = $1 and blocked = $2
+		returning user_nick, blocked, kind, created;
+	`)
+	panicIfErr(err)
+
+	repo.selectBlocking, err = db.Prepare(prefix+"selectBlocking", `
+		select user_nick from user_blocks
+			where blocked = $1 and user_nick = any($2::text[]::citext[]) and kind = 'block'
+			limit 1;
+	`)
+	panicIfErr(err)
+
+	repo.selectMuted, err = db.Prepare(prefix+"selectMuted", `
+		select lower(blocked::text) from user_blocks where user_nick = $1;
+	`)
+	panicIfErr(err)
+
+	return repo
+}
+
+func (blockRepo PSQLBlockRepo) Insert(block *models.UserBlock) error {
+	return blockRepo.db.QueryRow(blockRepo.insert.Name, block.NickName, block.User, block.Kind).Scan(
+		&block.NickName, &block.User, &block.Kind, &block.Created)
+}
+
+func (blockRepo PSQLBlockRepo) Delete(block *models.UserBlock) error {
+	return blockRepo.db.QueryRow(blockRepo.delete.Name, block.NickName, block.User).Scan(
+		&block.NickName, &block.User, &block.Kind, &block.Created)
+}
+
+func (blockRepo PSQLBlockRepo) SelectBlocking(author string, nicks []string, nick *string) error {
+	return blockRepo.db.QueryRow(blockRepo.selectBlocking.Name, author, nicks).Scan(nick)
+}
+
+func (blockRepo PSQLBlockRepo) SelectMuted(viewer string, muted map[string]bool) error {
+	rows, err := blockRepo.db.Query(blockRepo.selectMuted.Name, viewer)
+	if err != nil {
+		return errors.Wrap(err, "select muted users")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var nick string
+		if err := rows.Scan(&nick); err != nil {
+			return errors.Wrap(err, "select muted users scan")
+		}
+		muted[nick] = true
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+	"time"
+)
+
+type FilterRepo interface {
+	SelectByForum(forum string, config *models.FilterConfig) error // пустые настройки, если их нет
+	Upsert(forum string, config *models.FilterConfig) error
+	RecentPost(author string, message string, since time.Time) (bool, error)
+	RecentThread(author string, message string, since time.Time) (bool, error)
+}
+
+type PSQLFilterRepo struct {
+	db           *pgx.ConnPool
+	selectConfig *pgx.PreparedStatement
+	upsert       *pgx.PreparedStatement
+	recentPost   *pgx.PreparedStatement
+	recentThread *pgx.PreparedStatement
+}
+
+func CreatePSQLFilterRepo(db *pgx.ConnPool) FilterRepo {
+	var err error
+	prefix := "filter_"
+	repo := PSQLFilterRepo{db: db}
+
+	repo.selectConfig, err = db.Prepare(prefix+"selectConfig", `
+		select coalesce((select config from forum_filters where forum = $1), '{}');
+	`)
+	panicIfErr(err)
+
+	repo.upsert, err = db.Prepare(prefix+"upsert", `
+		insert into forum_filters (forum, config) values ($1, $2)
+		on conflict (forum) do update set config = excluded.config;
+	`)
+	panicIfErr(err)
+
+	repo.recentPost, err = db.Prepare(prefix+"recentPost", `
+		select exists(select 1 from posts where author = $1 and message = $2 and created > $3);
+	`)
+	panicIfErr(err)
+
+	repo.recentThread, err = db.Prepare(prefix+"recentThread", `
+		select exists(select 1 from threads where author = $1 and message = $2 and created > $3);
+	`)
+	panicIfErr(err)
+
+	return repo
+}
+
+func (filterRepo PSQLFilterRepo) SelectByForum(forum string, config *models.FilterConfig) error {
+	return filterRepo.db.QueryRow(filterRepo.selectConfig.Name, forum).Scan(config)
+}
+
+func (filterRepo PSQLFilterRepo) Upsert(forum string, config *models.FilterConfig) error {
+	_, err := filterRepo.db.Exec(filterRepo.upsert.Name, forum, config)
+	return err
+}
+
+func (filterRepo PSQLFilterRepo) RecentPost(author string, message string, since time.Time) (found bool, err error) {
+	err = filterRepo.db.QueryRow(filterRepo.recentPost.Name, author, message, since).Scan(&found)
+	return
+}
+
+func (filterRepo PSQLFilterRepo) RecentThread(author string, message string, since time.Time) (found bool, err error) {
+	err = filterRepo.db.QueryRow(filterRepo.recentThread.Name, author, message, since).Scan(&found)
+	return
+}
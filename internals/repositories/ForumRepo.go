@@ -3,12 +3,16 @@ package repositories
 import (
 	"github.com/ApTyp5/new_db_techno/internals/models"
 	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
 )
 
 type ForumRepo interface {
 	SelectBySlug(forum *models.Forum) error
 	Insert(forum *models.Forum) error
 	Count(num *uint) error
+	SelectStats(stats *models.ForumStats, top int) error // Stats, top -- размер топов
+	SelectChildren(forums *[]models.Forum, forum *models.Forum) error
+	SelectTree(forum *models.Forum) error // Details: breadcrumb и счётчики поддерева
 }
 
 type PSQLForumRepo struct {
@@ -26,16 +30,16 @@ func CreatePSQLForumRepo(db *pgx.ConnPool) ForumRepo {
 	}
 
 	repo.selectBySlug, err = db.Prepare(prefix+"selectBySlug", `
-		SELECT post_num, thread_num, title, slug, responsible
+		SELECT post_num, thread_num, title, slug, responsible, coalesce(parent, ''), type, visibility
 			FROM forums
 		WHERE slug = $1;
 	`)
 	panicIfErr(err)
 
 	repo.insert, err = db.Prepare(prefix+"insert", `
-		INSERT INTO FORUMS (slug, title, responsible)
-		VALUES ($1, $2, (select nick_name from Users where nick_name = $3))
-		RETURNING slug, title, responsible, post_num, thread_num
+		INSERT INTO FORUMS (slug, title, responsible, parent, type, visibility)
+		VALUES ($1, $2, (select nick_name from Users where nick_name = $3), nullif($4, ''), $5, $6)
+		RETURNING slug, title, responsible, post_num, thread_num, coalesce(parent, ''), type, visibility
 	`)
 	panicIfErr(err)
 
@@ -53,7 +57,10 @@ func (forumRepo PSQLForumRepo) SelectBySlug(forum *models.Forum) error {
 		&forum.Threads,
 		&forum.Title,
 		&forum.Slug,
-		&forum.User)
+		&forum.User,
+		&forum.Parent,
+		&forum.Type,
+		&forum.Visibility)
 }
 
 func (forumRepo PSQLForumRepo) Insert(forum *models.Forum) error {
@@ -61,13 +68,157 @@ func (forumRepo PSQLForumRepo) Insert(forum *models.Forum) error {
 		forumRepo.insert.Name,
 		forum.Slug,
 		forum.Title,
-		forum.User).Scan(&forum.Slug,
+		forum.User,
+		forum.Parent,
+		forum.Type,
+		forum.Visibility).Scan(&forum.Slug,
 		&forum.Title,
 		&forum.User,
 		&forum.Posts,
-		&forum.Threads)
+		&forum.Threads,
+		&forum.Parent,
+		&forum.Type,
+		&forum.Visibility)
+}
+
+func (forumRepo PSQLForumRepo) SelectChildren(forums *[]models.Forum, forum *models.Forum) error {
+	rows, err := forumRepo.db.Query(`
+		SELECT post_num, thread_num, title, slug, responsible, parent, type, visibility
+			FROM forums
+		WHERE parent = $1
+		ORDER BY slug;`,
+		forum.Slug)
+	if err != nil {
+		return errors.Wrap(err, "select forum children")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i := len(*forums)
+		*forums = append(*forums, models.Forum{})
+		if err := rows.Scan(&(*forums)[i].Posts, &(*forums)[i].Threads, &(*forums)[i].Title,
+			&(*forums)[i].Slug, &(*forums)[i].User, &(*forums)[i].Parent, &(*forums)[i].Type,
+			&(*forums)[i].Visibility); err != nil {
+			return errors.Wrap(err, "select forum children scan")
+		}
+	}
+
+	return rows.Err()
+}
+
+func (forumRepo PSQLForumRepo) SelectTree(forum *models.Forum) error {
+	rows, err := forumRepo.db.Query(`
+		with recursive up as (
+			select slug, title, parent, 0 depth from forums where slug = $1
+			union all
+			select f.slug, f.title, f.parent, up.depth + 1 from forums f join up on f.slug = up.parent
+		)
+		select slug, title from up order by depth desc;`,
+		forum.Slug)
+	if err != nil {
+		return errors.Wrap(err, "select forum breadcrumb")
+	}
+
+	forum.Breadcrumb = make([]models.ForumCrumb, 0)
+	for rows.Next() {
+		crumb := models.ForumCrumb{}
+		if err := rows.Scan(&crumb.Slug, &crumb.Title); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "select forum breadcrumb scan")
+		}
+		forum.Breadcrumb = append(forum.Breadcrumb, crumb)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return forumRepo.db.QueryRow(`
+		with recursive down as (
+			select slug, post_num, thread_num from forums where slug = $1
+			union all
+			select f.slug, f.post_num, f.thread_num from forums f join down on f.parent = down.slug
+		)
+		select coalesce(sum(post_num), 0), coalesce(sum(thread_num), 0) from down;`,
+		forum.Slug).Scan(
+		&forum.SubtreePosts,
+		&forum.SubtreeThreads)
 }
 
 func (forumRepo PSQLForumRepo) Count(num *uint) error {
 	return forumRepo.db.QueryRow(forumRepo.count.Name).Scan(num)
 }
+
+func (forumRepo PSQLForumRepo) SelectStats(stats *models.ForumStats, top int) error {
+	// интервалы считаются в UTC, чтобы границы суток не зависели от настроек сервера
+	rows, err := forumRepo.db.Query(`
+		select g.start,
+			coalesce(sum(s.posts), 0), coalesce(sum(s.threads), 0), coalesce(sum(s.participants), 0)
+			from generate_series(
+				date_trunc($4, $2::timestamptz at time zone 'UTC') at time zone 'UTC',
+				$3::timestamptz - interval '1 microsecond',
+				('1 ' || $4)::interval) g(start)
+			left join forum_stats_hourly s on s.forum = $1
+				and s.hour >= greatest(g.start, date_trunc('hour', $2::timestamptz))
+				and s.hour < least(g.start + ('1 ' || $4)::interval, $3::timestamptz)
+			group by g.start
+			order by g.start;`,
+		stats.Forum, stats.From, stats.To, stats.Bucket)
+	if err != nil {
+		return errors.Wrap(err, "select forum stats series")
+	}
+
+	for rows.Next() {
+		bucket := models.StatsBucket{}
+		if err := rows.Scan(&bucket.Start, &bucket.Posts, &bucket.Threads, &bucket.Participants); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "select forum stats series scan")
+		}
+		stats.Series = append(stats.Series, bucket)
+	}
+	rows.Close()
+
+	rows, err = forumRepo.db.Query(`
+		select author, sum(posts) from forum_author_stats_hourly
+			where forum = $1 and hour >= date_trunc('hour', $2::timestamptz) and hour < $3
+			group by author
+			order by 2 desc, author
+			limit $4;`,
+		stats.Forum, stats.From, stats.To, top)
+	if err != nil {
+		return errors.Wrap(err, "select forum top posters")
+	}
+
+	for rows.Next() {
+		poster := models.TopPoster{}
+		if err := rows.Scan(&poster.NickName, &poster.Posts); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "select forum top posters scan")
+		}
+		stats.TopPosters = append(stats.TopPosters, poster)
+	}
+	rows.Close()
+
+	rows, err = forumRepo.db.Query(`
+		select id, author, forum, created, message, coalesce(slug, ''), title, vote_num,
+			locked, pinned, closed, coalesce(close_reason, '')
+			from threads
+			where forum = $1 and created >= $2 and created < $3 and not hidden
+			order by vote_num desc, id
+			limit $4;`,
+		stats.Forum, stats.From, stats.To, top)
+	if err != nil {
+		return errors.Wrap(err, "select forum top threads")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := models.Thread{}
+		if err := rows.Scan(&t.Id, &t.Author, &t.Forum, &t.Created, &t.Message, &t.Slug, &t.Title, &t.Votes,
+			&t.Locked, &t.Pinned, &t.Closed, &t.CloseReason); err != nil {
+			return errors.Wrap(err, "select forum top threads scan")
+		}
+		stats.TopThreads = append(stats.TopThreads, t)
+	}
+
+	return rows.Err()
+}
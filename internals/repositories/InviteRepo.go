@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+type InviteRepo interface {
+	Select(invite *models.ForumInvite) error // по forum и user, ErrNoRows -- заявки нет
+	Upsert(invite *models.ForumInvite) error // forum.Invite, forum.Join
+	Delete(invite *models.ForumInvite) error // ErrNoRows -- заявки не было
+	SelectByForum(invites *[]models.ForumInvite, forum string) error
+}
+
+type PSQLInviteRepo struct {
+	db     *pgx.ConnPool
+	sel    *pgx.PreparedStatement
+	upsert *pgx.PreparedStatement
+	delete *pgx.PreparedStatement
+}
+
+func CreatePSQLInviteRepo(db *pgx.ConnPool) InviteRepo {
+	var err error
+	prefix := "invite_"
+	repo := PSQLInviteRepo{db: db}
+
+	repo.sel, err = db.Prepare(prefix+"select", `
+		select forum, user_nick, kind, coalesce(invited_by, ''), created
+			from forum_invites where forum = $1 and user_nick = $2;
+	`)
+	panicIfErr(err)
+
+	repo.upsert, err = db.Prepare(prefix+"upsert", `
+		insert into forum_invites (forum, user_nick, kind, invited_by) values ($1, $2, $3, nullif($4, ''))
+		on conflict (forum, user_nick) do update
+			set kind = excluded.kind, invited_by = excluded.invited_by, created = now()
+		returning forum, user_nick, kind, coalesce(invited_by, ''), created;
+	`)
+	panicIfErr(err)
+
+	repo.delete, err = db.Prepare(prefix+"delete", `
+		delete from forum_invites where forum = $1 and user_nick = $2
+		returning forum, user_nick, kind, coalesce(invited_by, ''), created;
+	`)
+	panicIfErr(err)
+
+	return repo
+}
+
+func (inviteRepo PSQLInviteRepo) Select(invite *models.ForumInvite) error {
+	return inviteRepo.db.QueryRow(inviteRepo.sel.Name, invite.Forum, invite.User).Scan(
+		&invite.Forum, &invite.User, &invite.Kind, &invite.InvitedBy, &invite.Created)
+}
+
+func (inviteRepo PSQLInviteRepo) Upsert(invite *models.ForumInvite) error {
+	return inviteRepo.db.QueryRow(inviteRepo.upsert.Name, invite.Forum, invite.User, invite.Kind, invite.InvitedBy).Scan(
+		&invite.Forum, &invite.User, &invite.Kind, &invite.InvitedBy, &invite.Created)
+}
+
+func (inviteRepo PSQLInviteRepo) Delete(invite *models.ForumInvite) error {
+	return inviteRepo.db.QueryRow(inviteRepo.delete.Name, invite.Forum, invite.User).Scan(
+		&invite.Forum, &invite.User, &invite.Kind, &invite.InvitedBy, &invite.Created)
+}
+
+func (inviteRepo PSQLInviteRepo) SelectByForum(invites *[]models.ForumInvite, forum string) error {
+	rows, err := inviteRepo.db.Query(`
+		select forum, user_nick, kind, coalesce(invited_by, ''), created
+			from forum_invites where forum = $1
+			order by created;`,
+		forum)
+	if err != nil {
+		return errors.Wrap(err, "select forum invites")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		invite := models.ForumInvite{}
+		if err := rows.Scan(&invite.Forum, &invite.User, &invite.Kind, &invite.InvitedBy, &invite.Created); err != nil {
+			return errors.Wrap(err, "select forum invites scan")
+		}
+		*invites = append(*invites, invite)
+	}
+
+	return rows.Err()
+}
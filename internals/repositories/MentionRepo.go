@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+type MentionRepo interface {
+	// user.Mentions, unread -- только непрочитанные
+	SelectByUser(mentions *[]models.Mention, user *models.User, limit int, since int, desc bool, unread bool) error
+	MarkRead(user *models.User, ids []int, unread *int) error // user.ReadMentions, пустой ids -- все
+}
+
+type PSQLMentionRepo struct {
+	db       *pgx.ConnPool
+	markRead *pgx.PreparedStatement
+}
+
+func CreatePSQLMentionRepo(db *pgx.ConnPool) MentionRepo {
+	var err error
+	prefix := "mention_"
+	repo := PSQLMentionRepo{db: db}
+
+	repo.markRead, err = db.Prepare(prefix+"markRead", `
+		with r as (
+			update mentions set read = true
+				where user_nick = $1 and not read
+					and (coalesce(array_length($2::int[], 1), 0) = 0 or id = any($2::int[]))
+			returning id
+		)
+		select count(*) from mentions m join posts p on p.id = m.post
+			where m.user_nick = $1 and not m.read and m.id not in (select id from r)
+				and forum_visible(p.forum, $1);
+	`)
+	panicIfErr(err)
+
+	return repo
+}
+
+func (mentionRepo PSQLMentionRepo) SelectByUser(mentions *[]models.Mention, user *models.User,
+	limit int, since int, desc bool, unread bool) error {
+	query := `
+		select m.id, m.post, p.thread, p.forum, p.author, p.created,
+			case when p.hidden then '' else p.message end, m.read
+			from mentions m join posts p on p.id = m.post
+			where m.user_nick = $1 and (not $2::bool or not m.read) and forum_visible(p.forum, $1) `
+
+	if desc {
+		query += " and ($3::int <= 0 or m.id < $3) order by m.id desc "
+	} else {
+		query += " and ($3::int <= 0 or m.id > $3) order by m.id "
+	}
+	query += " limit case when $4::int > 0 then $4 end"
+
+	rows, err := mentionRepo.db.Query(query, user.NickName, unread, since, limit)
+	if err != nil {
+		return errors.Wrap(err, "select mentions by user")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i := len(*mentions)
+		*mentions = append(*mentions, models.Mention{})
+		if err := rows.Scan(&(*mentions)[i].Id, &(*mentions)[i].Post, &(*mentions)[i].Thread,
+			&(*mentions)[i].Forum, &(*mentions)[i].Author, &(*mentions)[i].Created,
+			&(*mentions)[i].Message, &(*mentions)[i].Read); err != nil {
+			return errors.Wrap(err, "select mentions by user scan")
+		}
+	}
+
+	return rows.Err()
+}
+
+func (mentionRepo PSQLMentionRepo) MarkRead(user *models.User, ids []int, unread *int) error {
+	return mentionRepo.db.QueryRow(
+		mentionRepo.markRead.Name,
+		user.NickName,
+		ids).Scan(
+		unread)
+}
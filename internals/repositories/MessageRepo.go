@@ -0,0 +1,201 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"strconv"
+)
+
+type MessageRepo interface {
+	// FindOrCreate -- беседа ровно с составом conv.Members, при отсутствии создаётся
+	FindOrCreate(conv *models.Conversation) error
+	SelectConversation(conv *models.Conversation) error // участники по id, ErrNoRows -- беседы нет
+	Insert(message *models.DirectMessage) error         // автор сразу считается прочитавшим
+	SelectByConversation(messages *models.DirectMessages, conversation int, since int, limit int, desc bool) error
+	// беседы участника, свежие сверху; since -- id последнего сообщения беседы
+	SelectByUser(convs *models.Conversations, nick string, since int, limit int) error
+	MarkRead(conversation int, nick string, message int) error // отметка о прочтении не сдвигается назад
+}
+
+type PSQLMessageRepo struct {
+	db                 *pgx.ConnPool
+	selectConversation *pgx.PreparedStatement
+	markRead           *pgx.PreparedStatement
+}
+
+func CreatePSQLMessageRepo(db *pgx.ConnPool) MessageRepo {
+	var err error
+	prefix := "message_"
+	repo := PSQLMessageRepo{db: db}
+
+	repo.selectConversation, err = db.Prepare(prefix+"selectConversation", `
+		select conversation, array_agg(user_nick::text order by user_nick)
+			from conversation_members where conversation = $1
+			group by conversation;
+	`)
+	panicIfErr(err)
+
+	repo.markRead, err = db.Prepare(prefix+"markRead", `
+		update conversation_members set last_read = greatest(last_read, $3)
+			where conversation = $1 and user_nick = $2;
+	`)
+	panicIfErr(err)
+
+	return repo
+}
+
+func (messageRepo PSQLMessageRepo) FindOrCreate(conv *models.Conversation) error {
+	tx, err := messageRepo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "PSQLMessageRepo FindOrCreate begin")
+	}
+	defer tx.Rollback()
+
+	created := false
+	if err := tx.QueryRow(`
+		insert into conversations (members_key)
+			select string_agg(lower(nick_name::text), ',' order by lower(nick_name::text))
+				from users where nick_name = any($1::text[]::citext[])
+		on conflict (members_key) do update set members_key = excluded.members_key
+		returning id, xmax = 0`,
+		conv.Members).Scan(&conv.Id, &created); err != nil {
+		return errors.Wrap(err, "insert conversation")
+	}
+
+	if created {
+		if _, err := tx.Exec(`
+			insert into conversation_members (conversation, user_nick)
+				select $1, nick_name from users where nick_name = any($2::text[]::citext[])`,
+			conv.Id, conv.Members); err != nil {
+			return errors.Wrap(err, "insert conversation members")
+		}
+	}
+
+	if err := tx.QueryRow(messageRepo.selectConversation.Name, conv.Id).Scan(&conv.Id, &conv.Members); err != nil {
+		return errors.Wrap(err, "select conversation members")
+	}
+
+	return tx.Commit()
+}
+
+func (messageRepo PSQLMessageRepo) SelectConversation(conv *models.Conversation) error {
+	return messageRepo.db.QueryRow(messageRepo.selectConversation.Name, conv.Id).Scan(&conv.Id, &conv.Members)
+}
+
+func (messageRepo PSQLMessageRepo) Insert(message *models.DirectMessage) error {
+	tx, err := messageRepo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "PSQLMessageRepo Insert begin")
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(`
+		insert into direct_messages (conversation, author, message, message_html)
+			values ($1, (select nick_name from users where nick_name = $2), $3, $4)
+		returning id, author, created`,
+		message.Conversation, message.Author, message.Message, message.MessageHTML).Scan(
+		&message.Id, &message.Author, &message.Created); err != nil {
+		return errors.Wrap(err, "insert direct message")
+	}
+
+	if _, err := tx.Exec("update conversations set last_message = $2 where id = $1",
+		message.Conversation, message.Id); err != nil {
+		return errors.Wrap(err, "update conversation last message")
+	}
+
+	if _, err := tx.Exec(messageRepo.markRead.Name, message.Conversation, message.Author, message.Id); err != nil {
+		return errors.Wrap(err, "mark own message read")
+	}
+
+	message.ReadBy = make([]string, 0)
+	return tx.Commit()
+}
+
+func (messageRepo PSQLMessageRepo) SelectByConversation(messages *models.DirectMessages, conversation int,
+	since int, limit int, desc bool) error {
+	query := `
+		select m.id, m.conversation, m.author, m.message, m.message_html, m.created,
+			coalesce((select array_agg(cm.user_nick::text order by cm.user_nick)
+				from conversation_members cm
+				where cm.conversation = m.conversation and cm.user_nick <> m.author
+					and cm.last_read >= m.id), '{}')
+			from direct_messages m
+			where m.conversation = $1 `
+
+	if desc {
+		query += " and ($2::int <= 0 or m.id < $2) order by m.id desc "
+	} else {
+		query += " and ($2::int <= 0 or m.id > $2) order by m.id "
+	}
+	query += " limit $3::int + 1"
+
+	rows, err := messageRepo.db.Query(query, conversation, since, limit)
+	if err != nil {
+		return errors.Wrap(err, "select direct messages")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		message := models.DirectMessage{}
+		if err := rows.Scan(&message.Id, &message.Conversation, &message.Author, &message.Message,
+			&message.MessageHTML, &message.Created, &message.ReadBy); err != nil {
+			return errors.Wrap(err, "select direct messages scan")
+		}
+
+		if len(messages.Messages) == limit {
+			messages.Next = strconv.Itoa(messages.Messages[limit-1].Id)
+			break
+		}
+		messages.Messages = append(messages.Messages, message)
+	}
+
+	return rows.Err()
+}
+
+func (messageRepo PSQLMessageRepo) SelectByUser(convs *models.Conversations, nick string, since int, limit int) error {
+	rows, err := messageRepo.db.Query(`
+		select c.id,
+			(select array_agg(cm.user_nick::text order by cm.user_nick)
+				from conversation_members cm where cm.conversation = c.id),
+			(select count(*) from direct_messages d
+				where d.conversation = c.id and d.id > me.last_read and d.author <> me.user_nick),
+			m.id, m.author, m.message, m.message_html, m.created,
+			coalesce((select array_agg(cm.user_nick::text order by cm.user_nick)
+				from conversation_members cm
+				where cm.conversation = c.id and cm.user_nick <> m.author and cm.last_read >= m.id), '{}')
+			from conversation_members me
+				join conversations c on c.id = me.conversation
+				join direct_messages m on m.id = c.last_message
+			where me.user_nick = $1 and ($2::int <= 0 or c.last_message < $2)
+			order by c.last_message desc
+			limit $3::int + 1`,
+		nick, since, limit)
+	if err != nil {
+		return errors.Wrap(err, "select conversations by user")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		conv := models.Conversation{LastMessage: &models.DirectMessage{}}
+		if err := rows.Scan(&conv.Id, &conv.Members, &conv.Unread,
+			&conv.LastMessage.Id, &conv.LastMessage.Author, &conv.LastMessage.Message,
+			&conv.LastMessage.MessageHTML, &conv.LastMessage.Created, &conv.LastMessage.ReadBy); err != nil {
+			return errors.Wrap(err, "select conversations by user scan")
+		}
+		conv.LastMessage.Conversation = conv.Id
+
+		if len(convs.Conversations) == limit {
+			convs.Next = strconv.Itoa(convs.Conversations[limit-1].LastMessage.Id)
+			break
+		}
+		convs.Conversations = append(convs.Conversations, conv)
+	}
+
+	return rows.Err()
+}
+
+func (messageRepo PSQLMessageRepo) MarkRead(conversation int, nick string, message int) error {
+	_, err := messageRepo.db.Exec(messageRepo.markRead.Name, conversation, nick, message)
+	return err
+}
@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+type PollRepo interface {
+	// thread.Details, viewer -- чей выбор вернуть в poll.Choice
+	SelectByThread(thread int, poll *models.Poll, viewer string) error
+	Vote(thread int, vote *models.PollVote) error // thread.PollVote
+}
+
+type PSQLPollRepo struct {
+	db           *pgx.ConnPool
+	selectPoll   *pgx.PreparedStatement
+	selectResult *pgx.PreparedStatement
+}
+
+func CreatePSQLPollRepo(db *pgx.ConnPool) PollRepo {
+	var err error
+	prefix := "poll_"
+	repo := PSQLPollRepo{db: db}
+
+	repo.selectPoll, err = db.Prepare(prefix+"selectPoll", `
+		select question, multiple, closes, coalesce(closes <= now(), false),
+			(select count(distinct user_nick) from poll_ballots where thread = $1),
+			coalesce((select array_agg(option order by option) from poll_ballots
+				where thread = $1 and user_nick = $2::citext), '{}')
+			from polls where thread = $1;`)
+	panicIfErr(err)
+
+	repo.selectResult, err = db.Prepare(prefix+"selectResult", `
+		select o.id, o.text, count(b.user_nick)
+			from poll_options o left join poll_ballots b on b.option = o.id
+			where o.thread = $1
+			group by o.id
+			order by o.position;`)
+	panicIfErr(err)
+
+	return repo
+}
+
+// insertPoll -- опрос создаётся вместе с темой в её транзакции, см. ThreadRepo.Insert
+func insertPoll(tx *pgx.Tx, thread int, poll *models.Poll) error {
+	if _, err := tx.Exec("insert into polls (thread, question, multiple, closes) values ($1, $2, $3, $4)",
+		thread, poll.Question, poll.Multiple, poll.Closes); err != nil {
+		return errors.Wrap(err, "insert poll")
+	}
+
+	for i := range poll.Options {
+		if err := tx.QueryRow("insert into poll_options (thread, position, text) values ($1, $2, $3) returning id",
+			thread, i, poll.Options[i].Text).Scan(&poll.Options[i].Id); err != nil {
+			return errors.Wrap(err, "insert poll option")
+		}
+	}
+
+	return nil
+}
+
+func (pollRepo PSQLPollRepo) SelectByThread(thread int, poll *models.Poll, viewer string) error {
+	var choice []int32
+	if err := pollRepo.db.QueryRow(pollRepo.selectPoll.Name, thread, viewer).Scan(
+		&poll.Question,
+		&poll.Multiple,
+		&poll.Closes,
+		&poll.Closed,
+		&poll.Voters,
+		&choice); err != nil {
+		return err
+	}
+
+	poll.Choice = nil
+	for _, option := range choice {
+		poll.Choice = append(poll.Choice, int(option))
+	}
+
+	rows, err := pollRepo.db.Query(pollRepo.selectResult.Name, thread)
+	if err != nil {
+		return errors.Wrap(err, "select poll results")
+	}
+	defer rows.Close()
+
+	poll.Options = make([]models.PollOption, 0)
+	for rows.Next() {
+		option := models.PollOption{}
+		if err := rows.Scan(&option.Id, &option.Text, &option.Votes); err != nil {
+			return errors.Wrap(err, "select poll results scan")
+		}
+		poll.Options = append(poll.Options, option)
+	}
+
+	return rows.Err()
+}
+
+func (pollRepo PSQLPollRepo) Vote(thread int, vote *models.PollVote) error {
+	tx, err := pollRepo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "PSQLPollRepo Vote begin")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("delete from poll_ballots where thread = $1 and user_nick = $2",
+		thread, vote.NickName); err != nil {
+		return errors.Wrap(err, "delete ballot")
+	}
+
+	// встречный бюллетень того же пользователя мог вставить те же строки после нашего delete
+	if _, err := tx.Exec(`
+		insert into poll_ballots (user_nick, thread, option)
+			select $2, $1, o.id from poll_options o where o.thread = $1 and o.id = any($3::int[])
+		on conflict (thread, user_nick, option) do nothing`,
+		thread, vote.NickName, vote.Options); err != nil {
+		return errors.Wrap(err, "insert ballot")
+	}
+
+	return tx.Commit()
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/jackc/pgx"
 	"github.com/pkg/errors"
 	"sort"
+	"strconv"
 )
 
 type PostRepo interface {
@@ -14,7 +15,15 @@ type PostRepo interface {
 	UpdateById(post *models.Post) error                                                          // Edit
 	InsertPostsByThread(thread *models.Thread, posts []models.Post, nicks map[string]bool) error // thread.AddPosts
 	// threads.Posts
-	SelectByThread(posts *[]models.Post, thread *models.Thread, limit int, since int, desc bool, mode string) error
+	// accepted -- принятый ответ, который идёт первым в flat и parent_tree
+	SelectByThread(posts *[]models.Post, thread *models.Thread, limit int, since int, desc bool, mode string, top bool,
+		accepted int) error
+	// threads.Posts, sort=threaded
+	SelectThreaded(posts *[]models.ThreadedPost, thread *models.Thread, limit int, since int, replies int, desc bool) error
+	SelectReplies(replies *models.Replies, post *models.Post, cursor int, limit int) error // post.Replies
+	// user.Posts, forum == "" -- по всем форумам, видимым viewer
+	SelectByAuthor(posts *[]models.Post, user *models.User, forum string, viewer string, limit int, since int,
+		desc bool) error
 }
 
 type PSQLPostRepo struct {
@@ -23,7 +32,12 @@ type PSQLPostRepo struct {
 	selectById     *pgx.PreparedStatement
 	updateById     *pgx.PreparedStatement
 	insertByThread *pgx.PreparedStatement
+	insertHeld     *pgx.PreparedStatement
+	insertMentions *pgx.PreparedStatement
 	addForumUsers  *pgx.PreparedStatement
+	selectThreaded *pgx.PreparedStatement
+	threadedDesc   *pgx.PreparedStatement
+	selectReplies  *pgx.PreparedStatement
 }
 
 func CreatePSQLPostRepo(db *pgx.ConnPool) PostRepo {
@@ -35,36 +49,102 @@ func CreatePSQLPostRepo(db *pgx.ConnPool) PostRepo {
 	panicIfErr(err)
 
 	repo.selectById, err = db.Prepare(prefix+"selectById", `
-		select p.author, p.Created, t.Forum, p.is_edited, p.Message, coalesce(p.Parent, 0), p.Thread
+		select p.author, p.Created, t.Forum, p.is_edited,
+			case when p.hidden then '' else p.Message end, coalesce(p.Parent, 0), p.Thread,
+			p.vote_num, p.reactions, p.hidden, case when p.hidden then '' else p.message_html end
 			from Posts p
 				join Threads t on p.Thread = t.Id
 			where p.id = $1;`)
 	panicIfErr(err)
 
+	// скрытый пост правится, но его текст в ответ не попадает
 	repo.updateById, err = db.Prepare(prefix+"updateById", `
 		update Posts p
-			set Message = coalesce(nullif($1, ''), message)
+			set Message = coalesce(nullif($1, ''), message),
+				message_html = case when $1 = '' then message_html else $3 end
 			where p.id = $2
 		returning 
 			p.author, 
 		    Created, 
 		    (select t.Forum from Posts p join Threads t on t.Id = p.Thread where p.Id = $2), 
-		    is_edited, Message, coalesce(p.parent, 0), Thread;
+		    is_edited, case when hidden then '' else Message end, coalesce(p.parent, 0), Thread, vote_num,
+		    reactions, hidden, case when hidden then '' else message_html end;
 `)
 	panicIfErr(err)
 
 	repo.insertByThread, err = db.Prepare("InsertPostsByThread", `
-	INSERT INTO posts (author, thread, message, parent, forum) values 
-		($1, $2, $3, nullif($4, 0), $5)
-		RETURNING id, thread, created, is_edited, message, coalesce(parent, 0), forum
+	INSERT INTO posts (author, thread, message, parent, forum, hidden, message_html, num) values 
+		($1, $2, $3, nullif($4, 0), $5, $6, $7, $8)
+		RETURNING id, thread, created, is_edited, message, coalesce(parent, 0), forum, hidden, message_html
 	`)
 	panicIfErr(err)
 
+	repo.insertHeld, err = db.Prepare(prefix+"insertHeld", `
+		insert into post_reports (post, forum, reason) values ($1, $2, $3)`)
+	panicIfErr(err)
+
+	// незнакомые ники просто не находятся в users, и упоминание не создаётся;
+	// заблокировавшие автора упоминаний от него не получают
+	repo.insertMentions, err = db.Prepare(prefix+"insertMentions", `
+		insert into mentions (post, user_nick)
+			select $1, u.nick_name from users u
+				where u.nick_name = any($2::text[]::citext[]) and u.nick_name <> $3
+					and not exists (select 1 from user_blocks b
+						where b.user_nick = u.nick_name and b.blocked = $3 and b.kind = 'block')
+		on conflict do nothing`)
+	panicIfErr(err)
+
 	repo.addForumUsers, err = db.Prepare(prefix+"addForumUsers", `
 		insert into forum_users (forum, user_nick) values
 			($1, $2) on conflict do nothing`)
 	panicIfErr(err)
 
+	// первые $4 ответов каждого корня + ещё один, чтобы понять, есть ли продолжение;
+	// корни выбираются так же, как в parent_tree, поддерево -- по индексу posts__path1__idx
+	threaded := func(order string) string {
+		cmp := ">"
+		if order == "desc" {
+			cmp = "<"
+		}
+		return `
+		with roots as (
+			select id from posts
+			where thread = $1 and parent is null
+				and ($3::int <= 0 or id ` + cmp + ` (select path[1] from posts where id = $3))
+			order by id ` + order + `
+			limit case when $2::int > 0 then $2 end
+		)
+		select p.author, p.created, p.id, p.is_edited, case when p.hidden then '' else p.message end,
+			coalesce(p.parent, 0), p.thread, p.forum, p.vote_num, p.reactions, p.hidden,
+			case when p.hidden then '' else p.message_html end
+			from (
+				select p.*, row_number() over (partition by p.path[1] order by p.path) rn
+					from roots r join posts p on p.path[1] = r.id
+			) p
+			where p.rn <= $4::int + 2
+			order by p.path[1] ` + order + `, p.path;`
+	}
+
+	repo.selectThreaded, err = db.Prepare(prefix+"selectThreaded", threaded("asc"))
+	panicIfErr(err)
+
+	repo.threadedDesc, err = db.Prepare(prefix+"threadedDesc", threaded("desc"))
+	panicIfErr(err)
+
+	repo.selectReplies, err = db.Prepare(prefix+"selectReplies", `
+		select p.author, p.created, p.id, p.is_edited, case when p.hidden then '' else p.message end,
+			coalesce(p.parent, 0), p.thread, p.forum, p.vote_num, p.reactions, p.hidden,
+			case when p.hidden then '' else p.message_html end
+			from posts b
+				join posts p on p.path[1] = b.path[1]
+					and p.path[1:array_length(b.path, 1)] = b.path
+					and p.id <> b.id
+			where b.id = $1
+				and ($2::int <= 0 or p.path > (select path from posts where id = $2))
+			order by p.path
+			limit $3::int + 1;`)
+	panicIfErr(err)
+
 	return repo
 }
 
@@ -90,21 +170,30 @@ func (postRepo PSQLPostRepo) SelectById(post *models.Post) error {
 		&post.IsEdited,
 		&post.Message,
 		&post.Parent,
-		&post.Thread)
+		&post.Thread,
+		&post.Votes,
+		&post.Reactions,
+		&post.Hidden,
+		&post.MessageHTML)
 }
 
 func (postRepo PSQLPostRepo) UpdateById(post *models.Post) error {
 	return postRepo.db.QueryRow(
 		postRepo.updateById.Name,
 		post.Message,
-		post.Id).Scan(
+		post.Id,
+		post.MessageHTML).Scan(
 		&post.Author,
 		&post.Created,
 		&post.Forum,
 		&post.IsEdited,
 		&post.Message,
 		&post.Parent,
-		&post.Thread)
+		&post.Thread,
+		&post.Votes,
+		&post.Reactions,
+		&post.Hidden,
+		&post.MessageHTML)
 }
 
 func (postRepo PSQLPostRepo) InsertPostsByThread(thread *models.Thread, posts []models.Post, nicks map[string]bool) error {
@@ -118,6 +207,14 @@ func (postRepo PSQLPostRepo) InsertPostsByThread(thread *models.Thread, posts []
 	}
 	defer tx.Rollback()
 
+	// номера раздаются всей пачке одним обновлением темы, оно же держит её строку до конца
+	// транзакции, так что номера идут в порядке id
+	var last int
+	if err := tx.QueryRow("update threads set post_num = post_num + $1 where id = $2 returning post_num",
+		len(posts), thread.Id).Scan(&last); err != nil {
+		return err
+	}
+
 	bt := tx.BeginBatch()
 
 	for i := range posts {
@@ -127,7 +224,10 @@ func (postRepo PSQLPostRepo) InsertPostsByThread(thread *models.Thread, posts []
 				thread.Id,
 				posts[i].Message,
 				posts[i].Parent,
-				thread.Forum},
+				thread.Forum,
+				posts[i].Held != "",
+				posts[i].MessageHTML,
+				last - len(posts) + i + 1},
 			nil, nil)
 	}
 
@@ -157,7 +257,9 @@ func (postRepo PSQLPostRepo) InsertPostsByThread(thread *models.Thread, posts []
 			&posts[i].IsEdited,
 			&posts[i].Message,
 			&posts[i].Parent,
-			&posts[i].Forum); err != nil {
+			&posts[i].Forum,
+			&posts[i].Hidden,
+			&posts[i].MessageHTML); err != nil {
 			return err
 		}
 	}
@@ -169,6 +271,28 @@ func (postRepo PSQLPostRepo) InsertPostsByThread(thread *models.Thread, posts []
 		}
 	}
 
+	// задержанные фильтром посты попадают в очередь модерации форума
+	for i := range posts {
+		if posts[i].Held == "" {
+			continue
+		}
+
+		if _, err := tx.Exec(postRepo.insertHeld.Name, posts[i].Id, thread.Forum, posts[i].Held); err != nil {
+			return err
+		}
+	}
+
+	// задержанный пост никому не виден, упоминать в нём некого
+	for i := range posts {
+		if len(posts[i].Mentions) == 0 || posts[i].Held != "" {
+			continue
+		}
+
+		if _, err := tx.Exec(postRepo.insertMentions.Name, posts[i].Id, posts[i].Mentions, posts[i].Author); err != nil {
+			return err
+		}
+	}
+
 	_, err = tx.Exec("update forums set post_num = post_num + $1 where slug = $2", len(posts), thread.Forum)
 	if err != nil {
 		return err
@@ -182,17 +306,20 @@ func (postRepo PSQLPostRepo) InsertPostsByThread(thread *models.Thread, posts []
 	return tx.Commit()
 }
 
-func (postRepo PSQLPostRepo) SelectByThread(posts *[]models.Post, thread *models.Thread, limit int, since int, desc bool, mode string) error {
+func (postRepo PSQLPostRepo) SelectByThread(posts *[]models.Post, thread *models.Thread, limit int, since int, desc bool, mode string, top bool,
+	accepted int) error {
 	rows, err := postRepo.db.Query(
 		"SELECT author, created, id,"+
 			"is_edited, message, parent, "+
-			"thread, forum "+
-			"from select_posts_by_thread($1, $2, $3, $4, $5);",
+			"thread, forum, vote_num, reactions, hidden, message_html "+
+			"from select_posts_by_thread($1, $2, $3, $4, $5, $6, $7);",
 		thread.Id,
 		limit,
 		since,
 		desc,
-		mode)
+		mode,
+		top,
+		accepted)
 	if err != nil {
 		return err
 	}
@@ -202,7 +329,8 @@ func (postRepo PSQLPostRepo) SelectByThread(posts *[]models.Post, thread *models
 		*posts = append(*posts, models.Post{})
 		if err := rows.Scan(&(*posts)[i].Author, &(*posts)[i].Created, &(*posts)[i].Id,
 			&(*posts)[i].IsEdited, &(*posts)[i].Message, &(*posts)[i].Parent,
-			&(*posts)[i].Thread, &(*posts)[i].Forum); err != nil {
+			&(*posts)[i].Thread, &(*posts)[i].Forum, &(*posts)[i].Votes, &(*posts)[i].Reactions,
+			&(*posts)[i].Hidden, &(*posts)[i].MessageHTML); err != nil {
 			return err
 		}
 	}
@@ -366,3 +494,102 @@ func (postRepo PSQLPostRepo) SelectByThreadParentTree(posts *[]*models.Post, thr
 	}
 	return nil
 }
+
+func (postRepo PSQLPostRepo) SelectThreaded(posts *[]models.ThreadedPost, thread *models.Thread, limit int, since int, replies int, desc bool) error {
+	stmt := postRepo.selectThreaded.Name
+	if desc {
+		stmt = postRepo.threadedDesc.Name
+	}
+
+	rows, err := postRepo.db.Query(stmt, thread.Id, limit, since, replies)
+	if err != nil {
+		return errors.Wrap(err, "select threaded")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		post := models.Post{}
+		if err := rows.Scan(&post.Author, &post.Created, &post.Id, &post.IsEdited,
+			&post.Message, &post.Parent, &post.Thread, &post.Forum, &post.Votes, &post.Reactions,
+			&post.Hidden, &post.MessageHTML); err != nil {
+			return errors.Wrap(err, "select threaded scan")
+		}
+
+		if post.Parent == 0 {
+			*posts = append(*posts, models.ThreadedPost{
+				Post:    post,
+				Replies: models.Replies{Posts: make([]models.Post, 0, replies)},
+			})
+			continue
+		}
+
+		root := &(*posts)[len(*posts)-1].Replies
+		if len(root.Posts) < replies {
+			root.Posts = append(root.Posts, post)
+		} else {
+			root.Next = strconv.Itoa(root.Posts[len(root.Posts)-1].Id)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (postRepo PSQLPostRepo) SelectReplies(replies *models.Replies, post *models.Post, cursor int, limit int) error {
+	rows, err := postRepo.db.Query(postRepo.selectReplies.Name, post.Id, cursor, limit)
+	if err != nil {
+		return errors.Wrap(err, "select replies")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		reply := models.Post{}
+		if err := rows.Scan(&reply.Author, &reply.Created, &reply.Id, &reply.IsEdited,
+			&reply.Message, &reply.Parent, &reply.Thread, &reply.Forum, &reply.Votes, &reply.Reactions,
+			&reply.Hidden, &reply.MessageHTML); err != nil {
+			return errors.Wrap(err, "select replies scan")
+		}
+
+		if len(replies.Posts) == limit {
+			replies.Next = strconv.Itoa(replies.Posts[limit-1].Id)
+			break
+		}
+		replies.Posts = append(replies.Posts, reply)
+	}
+
+	return rows.Err()
+}
+
+func (postRepo PSQLPostRepo) SelectByAuthor(posts *[]models.Post, user *models.User, forum string, viewer string,
+	limit int, since int, desc bool) error {
+	query := `
+		select author, created, id, is_edited, case when hidden then '' else message end,
+			coalesce(parent, 0), thread, forum, vote_num, reactions, hidden
+			from posts
+			where author = $1 and ($2 = '' or forum = $2::citext) and forum_visible(forum, $5) `
+
+	if desc {
+		query += " and ($3::int <= 0 or id < $3) order by id desc "
+	} else {
+		query += " and ($3::int <= 0 or id > $3) order by id "
+	}
+	query += " limit case when $4::int > 0 then $4 end"
+
+	rows, err := postRepo.db.Query(query, user.NickName, forum, since, limit, viewer)
+	if err != nil {
+		return errors.Wrap(err, "select posts by author")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i := len(*posts)
+		*posts = append(*posts, models.Post{})
+		if err := rows.Scan(&(*posts)[i].Author, &(*posts)[i].Created, &(*posts)[i].Id,
+			&(*posts)[i].IsEdited, &(*posts)[i].Message, &(*posts)[i].Parent,
+			&(*posts)[i].Thread, &(*posts)[i].Forum, &(*posts)[i].Votes, &(*posts)[i].Reactions,
+			&(*posts)[i].Hidden); err != nil {
+			return errors.Wrap(err, "select posts by author scan")
+		}
+	}
+
+	return rows.Err()
+}
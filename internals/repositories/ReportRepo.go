@@ -0,0 +1,179 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+type ReportRepo interface {
+	// post.Report, повторная жалоба не создаёт новую, а заново открывает прежнюю
+	Insert(report *models.Report, created *bool) error
+	SelectById(report *models.Report) error
+	// forum.Reports, status = open или resolved
+	SelectByForum(reports *[]models.Report, forum *models.Forum, status string, limit int, since int, desc bool) error
+	Resolve(report *models.Report, resolution *models.ReportResolution) error // report.Resolve
+}
+
+type PSQLReportRepo struct {
+	db         *pgx.ConnPool
+	insert     *pgx.PreparedStatement
+	selectById *pgx.PreparedStatement
+}
+
+func CreatePSQLReportRepo(db *pgx.ConnPool) ReportRepo {
+	var err error
+	prefix := "report_"
+	repo := PSQLReportRepo{db: db}
+
+	repo.insert, err = db.Prepare(prefix+"insert", `
+		with r as (
+			insert into post_reports (post, forum, reporter, reason)
+				values ($1, (select forum from posts where id = $1),
+					(select nick_name from users where nick_name = $2), $3)
+			on conflict (post, reporter) do update
+				set reason = excluded.reason, status = 'open', resolved_by = null, resolved_at = null
+			returning id, post, forum, reporter, reason, created, status,
+				coalesce(resolved_by, '') as resolved_by, xmax = 0 as created_now
+		)
+		select r.id, r.post, r.forum, r.reporter, r.reason, r.created, r.status, r.resolved_by,
+			p.author, p.message, r.created_now
+			from r join posts p on p.id = r.post;
+	`)
+	panicIfErr(err)
+
+	repo.selectById, err = db.Prepare(prefix+"selectById", `
+		select r.id, r.post, r.forum, coalesce(r.reporter, ''), r.reason, r.created, r.status,
+			coalesce(r.resolved_by, ''),
+			p.author, p.message
+			from post_reports r join posts p on p.id = r.post
+			where r.id = $1;
+	`)
+	panicIfErr(err)
+
+	return repo
+}
+
+func (reportRepo PSQLReportRepo) Insert(report *models.Report, created *bool) error {
+	return reportRepo.db.QueryRow(
+		reportRepo.insert.Name,
+		report.Post,
+		report.NickName,
+		report.Reason).Scan(
+		&report.Id,
+		&report.Post,
+		&report.Forum,
+		&report.NickName,
+		&report.Reason,
+		&report.Created,
+		&report.Status,
+		&report.ResolvedBy,
+		&report.Author,
+		&report.Message,
+		created)
+}
+
+func (reportRepo PSQLReportRepo) SelectById(report *models.Report) error {
+	return reportRepo.db.QueryRow(
+		reportRepo.selectById.Name,
+		report.Id).Scan(
+		&report.Id,
+		&report.Post,
+		&report.Forum,
+		&report.NickName,
+		&report.Reason,
+		&report.Created,
+		&report.Status,
+		&report.ResolvedBy,
+		&report.Author,
+		&report.Message)
+}
+
+func (reportRepo PSQLReportRepo) SelectByForum(reports *[]models.Report, forum *models.Forum, status string,
+	limit int, since int, desc bool) error {
+	query := `
+		select r.id, r.post, r.forum, coalesce(r.reporter, ''), r.reason, r.created, r.status,
+			coalesce(r.resolved_by, ''),
+			p.author, p.message
+			from post_reports r join posts p on p.id = r.post
+			where r.forum = $1 `
+
+	if status == models.ReportOpen {
+		query += " and r.status = 'open' "
+	} else {
+		query += " and r.status <> 'open' "
+	}
+
+	if desc {
+		query += " and ($2::int <= 0 or r.id < $2) order by r.id desc "
+	} else {
+		query += " and ($2::int <= 0 or r.id > $2) order by r.id "
+	}
+	query += " limit case when $3::int > 0 then $3 end"
+
+	rows, err := reportRepo.db.Query(query, forum.Slug, since, limit)
+	if err != nil {
+		return errors.Wrap(err, "select reports by forum")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i := len(*reports)
+		*reports = append(*reports, models.Report{})
+		if err := rows.Scan(&(*reports)[i].Id, &(*reports)[i].Post, &(*reports)[i].Forum,
+			&(*reports)[i].NickName, &(*reports)[i].Reason, &(*reports)[i].Created, &(*reports)[i].Status,
+			&(*reports)[i].ResolvedBy, &(*reports)[i].Author, &(*reports)[i].Message); err != nil {
+			return errors.Wrap(err, "select reports by forum scan")
+		}
+	}
+
+	return rows.Err()
+}
+
+// Resolve -- решение применяется ко всем открытым жалобам на тот же пост
+func (reportRepo PSQLReportRepo) Resolve(report *models.Report, resolution *models.ReportResolution) error {
+	tx, err := reportRepo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "PSQLReportRepo Resolve begin")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		update post_reports set status = $1, resolved_by = $2, resolved_at = now()
+			where post = $3 and (status = 'open' or id = $4)`,
+		report.Status, resolution.NickName, report.Post, report.Id); err != nil {
+		return errors.Wrap(err, "resolve reports")
+	}
+
+	switch report.Status {
+	case models.ReportHidden:
+		if _, err := tx.Exec("update posts set hidden = true where id = $1", report.Post); err != nil {
+			return errors.Wrap(err, "hide post")
+		}
+	case models.ReportDismissed:
+		// отклонённая жалоба на пост, задержанный фильтром, -- одобрение поста,
+		// если его не скрыли раньше по другой жалобе
+		if _, err := tx.Exec(`
+			update posts set hidden = false
+				where id = $1 and hidden
+					and exists (select 1 from post_reports where post = $1 and reporter is null)
+					and not exists (select 1 from post_reports where post = $1 and status = 'hidden')`,
+			report.Post); err != nil {
+			return errors.Wrap(err, "approve held post")
+		}
+	case models.ReportBanned:
+		if _, err := tx.Exec(`
+			insert into forum_roles (forum, user_nick, role, expires) values ($1, $2, 'banned', $3)
+			on conflict (forum, user_nick) do update set role = 'banned', expires = excluded.expires`,
+			report.Forum, report.Author, resolution.Expires); err != nil {
+			return errors.Wrap(err, "ban author")
+		}
+	}
+
+	if err := tx.QueryRow("select coalesce(resolved_by, '') from post_reports where id = $1",
+		report.Id).Scan(&report.ResolvedBy); err != nil {
+		return errors.Wrap(err, "select resolved report")
+	}
+
+	return tx.Commit()
+}
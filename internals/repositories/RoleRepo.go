@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+)
+
+type RoleRepo interface {
+	SelectRole(role *models.ForumRole) error                                // действующая роль, member по умолчанию
+	SelectBanned(forum string, nicks map[string]bool, banned *string) error // первый забаненный из nicks
+	Upsert(role *models.ForumRole) error                                    // forum.GrantRole
+	Delete(role *models.ForumRole) error                                    // forum.RevokeRole
+	// первый из nicks без действующей роли из roles, ErrNoRows -- роль есть у всех
+	SelectWithoutRole(forum string, nicks map[string]bool, roles []string, nick *string) error
+	AddMember(forum string, nick string) error // forum.Join, forum.Invite; старшие роли не понижаются
+}
+
+type PSQLRoleRepo struct {
+	db           *pgx.ConnPool
+	selectRole   *pgx.PreparedStatement
+	selectBanned *pgx.PreparedStatement
+	upsert       *pgx.PreparedStatement
+	delete       *pgx.PreparedStatement
+	withoutRole  *pgx.PreparedStatement
+	addMember    *pgx.PreparedStatement
+}
+
+func CreatePSQLRoleRepo(db *pgx.ConnPool) RoleRepo {
+	var err error
+	prefix := "role_"
+	repo := PSQLRoleRepo{db: db}
+
+	repo.selectRole, err = db.Prepare(prefix+"selectRole", `
+		select forum_role($1, $2),
+			(select expires from forum_roles
+				where forum = $1 and user_nick = $2 and (expires is null or expires > now()));
+	`)
+	panicIfErr(err)
+
+	repo.selectBanned, err = db.Prepare(prefix+"selectBanned", `
+		select user_nick from forum_roles
+			where forum = $1
+				and user_nick = any($2::text[]::citext[])
+				and role = 'banned'
+				and (expires is null or expires > now())
+			limit 1;
+	`)
+	panicIfErr(err)
+
+	repo.upsert, err = db.Prepare(prefix+"upsert", `
+		insert into forum_roles (forum, user_nick, role, expires)
+			values (
+				(select slug from forums where slug = $1),
+				(select nick_name from users where nick_name = $2),
+				$3, $4)
+		on conflict (forum, user_nick) do update set role = excluded.role, expires = excluded.expires
+		returning forum, user_nick, role, expires;
+	`)
+	panicIfErr(err)
+
+	repo.delete, err = db.Prepare(prefix+"delete", `
+		delete from forum_roles where forum = $1 and user_nick = $2 and role <> 'owner';
+	`)
+	panicIfErr(err)
+
+	repo.withoutRole, err = db.Prepare(prefix+"withoutRole", `
+		select n from unnest($2::text[]::citext[]) n
+			where not exists (select 1 from forum_roles r
+				where r.forum = $1 and r.user_nick = n and r.role = any($3::text[])
+					and (r.expires is null or r.expires > now()))
+			limit 1;
+	`)
+	panicIfErr(err)
+
+	// истёкший бан -- не препятствие для вступления
+	repo.addMember, err = db.Prepare(prefix+"addMember", `
+		insert into forum_roles (forum, user_nick, role) values ($1, $2, 'member')
+		on conflict (forum, user_nick) do update set role = 'member', expires = null
+			where forum_roles.role = 'banned' and forum_roles.expires <= now();
+	`)
+	panicIfErr(err)
+
+	return repo
+}
+
+func (roleRepo PSQLRoleRepo) SelectRole(role *models.ForumRole) error {
+	return roleRepo.db.QueryRow(
+		roleRepo.selectRole.Name,
+		role.Forum,
+		role.User).Scan(
+		&role.Role,
+		&role.Expires)
+}
+
+func (roleRepo PSQLRoleRepo) SelectBanned(forum string, nicks map[string]bool, banned *string) error {
+	nickSlice := make([]string, 0, len(nicks))
+	for nick := range nicks {
+		nickSlice = append(nickSlice, nick)
+	}
+
+	return roleRepo.db.QueryRow(roleRepo.selectBanned.Name, forum, nickSlice).Scan(banned)
+}
+
+func (roleRepo PSQLRoleRepo) Upsert(role *models.ForumRole) error {
+	return roleRepo.db.QueryRow(
+		roleRepo.upsert.Name,
+		role.Forum,
+		role.User,
+		role.Role,
+		role.Expires).Scan(
+		&role.Forum,
+		&role.User,
+		&role.Role,
+		&role.Expires)
+}
+
+func (roleRepo PSQLRoleRepo) Delete(role *models.ForumRole) error {
+	_, err := roleRepo.db.Exec(roleRepo.delete.Name, role.Forum, role.User)
+	return err
+}
+
+func (roleRepo PSQLRoleRepo) SelectWithoutRole(forum string, nicks map[string]bool, roles []string, nick *string) error {
+	nickSlice := make([]string, 0, len(nicks))
+	for n := range nicks {
+		nickSlice = append(nickSlice, n)
+	}
+
+	return roleRepo.db.QueryRow(roleRepo.withoutRole.Name, forum, nickSlice, roles).Scan(nick)
+}
+
+func (roleRepo PSQLRoleRepo) AddMember(forum string, nick string) error {
+	_, err := roleRepo.db.Exec(roleRepo.addMember.Name, forum, nick)
+	return err
+}
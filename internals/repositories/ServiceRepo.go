@@ -40,7 +40,29 @@ func (serviceRepo PSQLServiceRepo) Status(status *models.Status) error {
 
 func (serviceRepo PSQLServiceRepo) Clear() error {
 	_, err := serviceRepo.db.Exec(`
+	TRUNCATE TABLE direct_messages CASCADE ;
+	TRUNCATE TABLE conversation_members CASCADE ;
+	TRUNCATE TABLE conversations CASCADE ;
+	TRUNCATE TABLE user_blocks CASCADE ;
 	TRUNCATE TABLE votes CASCADE ;
+	TRUNCATE TABLE thread_moves CASCADE ;
+	TRUNCATE TABLE thread_redirects CASCADE ;
+	TRUNCATE TABLE forum_author_stats_hourly CASCADE ;
+	TRUNCATE TABLE forum_stats_hourly CASCADE ;
+	TRUNCATE TABLE thread_reads CASCADE ;
+	TRUNCATE TABLE mentions CASCADE ;
+	TRUNCATE TABLE thread_subscriptions CASCADE ;
+	TRUNCATE TABLE forum_subscriptions CASCADE ;
+	TRUNCATE TABLE poll_ballots CASCADE ;
+	TRUNCATE TABLE poll_options CASCADE ;
+	TRUNCATE TABLE polls CASCADE ;
+	TRUNCATE TABLE forum_tags CASCADE ;
+	TRUNCATE TABLE forum_filters CASCADE ;
+	TRUNCATE TABLE post_reports CASCADE ;
+	TRUNCATE TABLE forum_invites CASCADE ;
+	TRUNCATE TABLE forum_roles CASCADE ;
+	TRUNCATE TABLE post_reactions CASCADE ;
+	TRUNCATE TABLE post_votes CASCADE ;
 	TRUNCATE TABLE posts CASCADE ;
 	TRUNCATE TABLE threads CASCADE ;
 	TRUNCATE TABLE forums CASCADE ;
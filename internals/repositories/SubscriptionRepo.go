@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+type SubscriptionRepo interface {
+	Insert(sub *models.Subscription, created *bool) error // thread.Subscribe, forum.Subscribe
+	Delete(sub *models.Subscription) error                // thread.Unsubscribe, forum.Unsubscribe
+	// user.Feed, since == nil -- с начала ленты, иначе после (since, kind, id)
+	SelectFeed(feed *models.Feed, user *models.User, since *time.Time, kind string, id int, limit int) error
+}
+
+type PSQLSubscriptionRepo struct {
+	db           *pgx.ConnPool
+	insertThread *pgx.PreparedStatement
+	insertForum  *pgx.PreparedStatement
+	deleteThread *pgx.PreparedStatement
+	deleteForum  *pgx.PreparedStatement
+	selectFeed   *pgx.PreparedStatement
+}
+
+func CreatePSQLSubscriptionRepo(db *pgx.ConnPool) SubscriptionRepo {
+	var err error
+	prefix := "subscription_"
+	repo := PSQLSubscriptionRepo{db: db}
+
+	repo.insertThread, err = db.Prepare(prefix+"insertThread", `
+		insert into thread_subscriptions (user_nick, thread) values ($1, $2)
+			on conflict (user_nick, thread) do update set created = thread_subscriptions.created
+		returning user_nick, created, xmax = 0;`)
+	panicIfErr(err)
+
+	repo.insertForum, err = db.Prepare(prefix+"insertForum", `
+		insert into forum_subscriptions (user_nick, forum) values ($1, $2)
+			on conflict (user_nick, forum) do update set created = forum_subscriptions.created
+		returning user_nick, created, xmax = 0;`)
+	panicIfErr(err)
+
+	repo.deleteThread, err = db.Prepare(prefix+"deleteThread", `
+		delete from thread_subscriptions where user_nick = $1 and thread = $2
+		returning user_nick, created;`)
+	panicIfErr(err)
+
+	repo.deleteForum, err = db.Prepare(prefix+"deleteForum", `
+		delete from forum_subscriptions where user_nick = $1 and forum = $2
+		returning user_nick, created;`)
+	panicIfErr(err)
+
+	// свои посты и темы в ленту не попадают, скрытые посты и задержанные фильтром темы -- тоже
+	repo.selectFeed, err = db.Prepare(prefix+"selectFeed", `
+		select kind, created, id, author, forum, thread, parent, message, title, slug from (
+			select 'post' kind, p.created, p.id, p.author, p.forum, p.thread, coalesce(p.parent, 0) parent,
+				p.message, '' title, '' slug
+				from thread_subscriptions s join posts p on p.thread = s.thread
+				where s.user_nick = $1 and p.author <> $1 and not p.hidden and forum_visible(p.forum, $1)
+			union all
+			select 'thread', t.created, t.id, t.author, t.forum, t.id, 0,
+				t.message, t.title, coalesce(t.slug, '')
+				from forum_subscriptions s join threads t on t.forum = s.forum
+				where s.user_nick = $1 and t.author <> $1 and not t.hidden and forum_visible(t.forum, $1)
+		) f
+		where $2::timestamptz is null or (f.created, f.kind, f.id) < ($2, $3, $4)
+		order by f.created desc, f.kind desc, f.id desc
+		limit $5::int + 1;`)
+	panicIfErr(err)
+
+	return repo
+}
+
+func (subscriptionRepo PSQLSubscriptionRepo) Insert(sub *models.Subscription, created *bool) error {
+	if sub.Thread > 0 {
+		return subscriptionRepo.db.QueryRow(
+			subscriptionRepo.insertThread.Name,
+			sub.NickName,
+			sub.Thread).Scan(
+			&sub.NickName,
+			&sub.Created,
+			created)
+	}
+
+	return subscriptionRepo.db.QueryRow(
+		subscriptionRepo.insertForum.Name,
+		sub.NickName,
+		sub.Forum).Scan(
+		&sub.NickName,
+		&sub.Created,
+		created)
+}
+
+func (subscriptionRepo PSQLSubscriptionRepo) Delete(sub *models.Subscription) error {
+	if sub.Thread > 0 {
+		return subscriptionRepo.db.QueryRow(
+			subscriptionRepo.deleteThread.Name,
+			sub.NickName,
+			sub.Thread).Scan(
+			&sub.NickName,
+			&sub.Created)
+	}
+
+	return subscriptionRepo.db.QueryRow(
+		subscriptionRepo.deleteForum.Name,
+		sub.NickName,
+		sub.Forum).Scan(
+		&sub.NickName,
+		&sub.Created)
+}
+
+func (subscriptionRepo PSQLSubscriptionRepo) SelectFeed(feed *models.Feed, user *models.User,
+	since *time.Time, kind string, id int, limit int) error {
+	rows, err := subscriptionRepo.db.Query(subscriptionRepo.selectFeed.Name, user.NickName, since, kind, id, limit)
+	if err != nil {
+		return errors.Wrap(err, "select feed")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			item           models.FeedItem
+			itemId, thread int
+			parent         int
+			author, forum  string
+			message        string
+			title, slug    string
+		)
+
+		if err := rows.Scan(&item.Kind, &item.Created, &itemId, &author, &forum, &thread, &parent,
+			&message, &title, &slug); err != nil {
+			return errors.Wrap(err, "select feed scan")
+		}
+
+		if len(feed.Items) == limit {
+			last := feed.Items[limit-1]
+			feed.Next = feedCursor(last.Created, last.Kind, feedItemId(&last))
+			break
+		}
+
+		if item.Kind == models.FeedPost {
+			item.Post = &models.Post{Id: itemId, Author: author, Forum: forum, Thread: thread, Parent: parent,
+				Message: message, Created: item.Created}
+		} else {
+			item.Thread = &models.Thread{Id: itemId, Author: author, Forum: forum, Message: message,
+				Title: title, Slug: slug, Created: item.Created}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return rows.Err()
+}
+
+// feedCursor -- курсор ленты: время в микросекундах, вид события и его id
+func feedCursor(created time.Time, kind string, id int) string {
+	return strconv.FormatInt(created.UnixMicro(), 10) + "_" + kind + "_" + strconv.Itoa(id)
+}
+
+func feedItemId(item *models.FeedItem) int {
+	if item.Post != nil {
+		return item.Post.Id
+	}
+	return item.Thread.Id
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+type TagRepo interface {
+	SelectAllowed(forum string, tags *[]string) error // forum.Tags, пустой список -- можно любые
+	SetAllowed(forum string, tags []string) error     // forum.SetTags
+	// /tags, forum == "" -- по всем форумам, видимым viewer
+	SelectCounts(counts *[]models.TagCount, forum string, viewer string, limit int) error
+}
+
+type PSQLTagRepo struct {
+	db            *pgx.ConnPool
+	selectAllowed *pgx.PreparedStatement
+}
+
+func CreatePSQLTagRepo(db *pgx.ConnPool) TagRepo {
+	var err error
+	prefix := "tag_"
+	repo := PSQLTagRepo{db: db}
+
+	repo.selectAllowed, err = db.Prepare(prefix+"selectAllowed", `
+		select coalesce(array_agg(tag order by tag), '{}') from forum_tags where forum = $1;`)
+	panicIfErr(err)
+
+	return repo
+}
+
+func (tagRepo PSQLTagRepo) SelectAllowed(forum string, tags *[]string) error {
+	return tagRepo.db.QueryRow(tagRepo.selectAllowed.Name, forum).Scan(tags)
+}
+
+func (tagRepo PSQLTagRepo) SetAllowed(forum string, tags []string) error {
+	tx, err := tagRepo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "PSQLTagRepo SetAllowed begin")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("delete from forum_tags where forum = $1", forum); err != nil {
+		return errors.Wrap(err, "delete allowed tags")
+	}
+
+	if _, err := tx.Exec("insert into forum_tags (forum, tag) select $1, unnest($2::text[])",
+		forum, tags); err != nil {
+		return errors.Wrap(err, "insert allowed tags")
+	}
+
+	return tx.Commit()
+}
+
+func (tagRepo PSQLTagRepo) SelectCounts(counts *[]models.TagCount, forum string, viewer string, limit int) error {
+	rows, err := tagRepo.db.Query(`
+		select tag, count(*) from threads, unnest(tags) tag
+			where not hidden and ($1 = '' or forum = $1::citext) and forum_visible(forum, $3)
+			group by tag
+			order by count(*) desc, tag
+			limit case when $2::int > 0 then $2 end;`,
+		forum, limit, viewer)
+	if err != nil {
+		return errors.Wrap(err, "select tag counts")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		count := models.TagCount{}
+		if err := rows.Scan(&count.Tag, &count.Threads); err != nil {
+			return errors.Wrap(err, "select tag counts scan")
+		}
+		*counts = append(*counts, count)
+	}
+
+	return rows.Err()
+}
@@ -3,15 +3,35 @@ package repositories
 import (
 	"github.com/ApTyp5/new_db_techno/internals/models"
 	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
 )
 
 type ThreadRepo interface {
 	Count(amount *uint) error
-	Insert(thread *models.Thread) error                                                                    // forum.AddThread
-	SelectByForum(threads *[]models.Thread, forum *models.Forum, limit int, since string, desc bool) error // forum.GetThreads
+	Insert(thread *models.Thread) error // forum.AddThread, вместе с thread.Poll
+	// forum.GetThreads, viewer -- для кого считать непрочитанные, anyTag -- хотя бы один из tags, иначе все,
+	// answered != nil -- только темы с принятым ответом или без него, hidden -- вместе с задержанными фильтром
+	SelectByForum(threads *[]models.Thread, forum *models.Forum, limit int, since string, desc bool, viewer string,
+		tags []string, anyTag bool, answered *bool, hidden bool) error
 	////////////////////////
 	SelectBySlugOrId(thread *models.Thread) error // Details
 	Update(thread *models.Thread) error           // Edit
+	Moderate(thread *models.Thread, moderation *models.ThreadModeration) error
+	Move(thread *models.Thread, move *models.ThreadMove) error // Move, thread -- уже перенесённая
+	Merge(thread *models.Thread, source *models.Thread) error  // Merge, source удаляется
+	Split(thread *models.Thread, post *models.Post) error      // post.Split, thread -- новая тема
+	Accept(thread *models.Thread, post int) error              // Accept, post == 0 -- снять отметку
+	SelectUnread(thread *models.Thread, viewer string) error   // Details?viewer=
+	MarkRead(read *models.ThreadRead) error                    // Read
+	// user.Threads, since -- id темы, после которой продолжать; только из форумов, видимых viewer
+	SelectByAuthor(threads *[]models.Thread, user *models.User, forum string, viewer string, limit int, since int,
+		desc bool) error
+	// forum.Threads?sort=hot и /threads/hot, forum == "" -- по всем форумам, видимым viewer
+	SelectHot(threads *[]models.Thread, forum string, viewer string, limit int, since int, tags []string,
+		anyTag bool, halfLife time.Duration) error
+	RecomputeHot(halfLife time.Duration) (int64, error) // фоновая задача
 }
 
 type PSQLThreadRepo struct {
@@ -19,7 +39,12 @@ type PSQLThreadRepo struct {
 	count            *pgx.PreparedStatement
 	insert           *pgx.PreparedStatement
 	selectByIdOrSlug *pgx.PreparedStatement
+	selectRedirect   *pgx.PreparedStatement
 	updateByIdOrSlug *pgx.PreparedStatement
+	moderate         *pgx.PreparedStatement
+	recomputeHot     *pgx.PreparedStatement
+	selectUnread     *pgx.PreparedStatement
+	markRead         *pgx.PreparedStatement
 }
 
 func CreatePSQLThreadRepo(db *pgx.ConnPool) ThreadRepo {
@@ -31,10 +56,15 @@ func CreatePSQLThreadRepo(db *pgx.ConnPool) ThreadRepo {
 	panicIfErr(err)
 
 	repo.selectByIdOrSlug, err = db.Prepare(prefix+"selectByIdOrSlug", `
-	SELECT id, author, forum, created, message, title, vote_num, coalesce(slug, '')
+	SELECT id, author, forum, created, message, title, vote_num, coalesce(slug, ''),
+		locked, pinned, closed, coalesce(close_reason, ''), message_html, tags, coalesce(accepted_post, 0), hidden
 	FROM threads WHERE slug = $1 OR id = $2;`)
 	panicIfErr(err)
 
+	repo.selectRedirect, err = db.Prepare(prefix+"selectRedirect", `
+	SELECT thread FROM thread_redirects WHERE from_slug = $1 OR from_id = $2 LIMIT 1;`)
+	panicIfErr(err)
+
 	repo.insert, err = db.Prepare(prefix+"insert", `
 			INSERT INTO threads (
 			author, 
@@ -42,14 +72,20 @@ func CreatePSQLThreadRepo(db *pgx.ConnPool) ThreadRepo {
 			message, 
 			slug, 
 			title, 
-			created
+			created,
+			message_html,
+			tags,
+			hidden
 		) VALUES (
 			(SELECT nick_name FROM users where nick_name = $1), 
 			(SELECT slug FROM forums WHERE slug = $2),
 			$3, 
 			nullif($4,''), 
 			$5,
-			nullif($6, to_timestamp(0))
+			nullif($6, to_timestamp(0)),
+			$7,
+			coalesce($8::text[], '{}'),
+			$9
 		)
 		returning 
 			id, 
@@ -59,12 +95,21 @@ func CreatePSQLThreadRepo(db *pgx.ConnPool) ThreadRepo {
 			(coalesce(slug, '')), 
 			title,
 			created,
-			vote_num;
+			vote_num,
+			locked,
+			pinned,
+			closed,
+			coalesce(close_reason, ''),
+			message_html,
+			tags,
+			hidden;
 `)
 	panicIfErr(err)
 
 	repo.updateByIdOrSlug, err = db.Prepare(prefix+"updateBySlugOrId", `
-	UPDATE threads SET message = COALESCE(nullif($1, ''), message), title = COALESCE(nullif($2, ''), title)
+	UPDATE threads SET message = COALESCE(nullif($1, ''), message), title = COALESCE(nullif($2, ''), title),
+		message_html = case when $1 = '' then message_html else $5 end,
+		tags = coalesce($6::text[], tags)
 		WHERE slug = $3 OR id = $4 
 	returning 
 		id, 
@@ -74,7 +119,88 @@ func CreatePSQLThreadRepo(db *pgx.ConnPool) ThreadRepo {
 		(coalesce(slug, '')), 
 		title,
 		created,
-		vote_num;
+		vote_num,
+		locked,
+		pinned,
+		closed,
+		coalesce(close_reason, ''),
+		message_html,
+		tags,
+		hidden;
+	`)
+	panicIfErr(err)
+
+	repo.moderate, err = db.Prepare(prefix+"moderate", `
+	UPDATE threads SET
+		locked = coalesce($1, locked),
+		pinned = coalesce($2, pinned),
+		closed = coalesce($3, closed),
+		close_reason = case when coalesce($3, closed) then coalesce(nullif($4, ''), close_reason) end,
+		hidden = coalesce($6, hidden)
+		WHERE id = $5
+	returning 
+		id, 
+		author,
+		forum,
+		message,
+		(coalesce(slug, '')), 
+		title,
+		created,
+		vote_num,
+		locked,
+		pinned,
+		closed,
+		coalesce(close_reason, ''),
+		message_html,
+		tags,
+		hidden;
+	`)
+	panicIfErr(err)
+
+	// рейтинг и число постов за последний период полураспада под натуральным логарифмом, чтобы
+	// первые голоса значили больше следующих; затухание вдвое за период -- то же, что сдвиг
+	// времени создания на период за каждые ln 2 очков, так что hot_score от now() не зависит,
+	// а пересчитываются только темы с голосами, свежими постами или устаревшей скоростью
+	repo.recomputeHot, err = db.Prepare(prefix+"recomputeHot", `
+	WITH velocity AS (
+		SELECT thread, count(*) cnt FROM posts
+			WHERE created > now() - $1::float8 * interval '1 second'
+			GROUP BY thread
+	), scores AS (
+		SELECT t.id, extract(epoch FROM t.created)
+			+ (sign(t.vote_num) * ln(1 + abs(t.vote_num)::float8) + ln(1 + coalesce(v.cnt, 0)::float8))
+				* $1::float8 / ln(2) score
+			FROM threads t LEFT JOIN velocity v ON v.thread = t.id
+			WHERE v.cnt IS NOT NULL OR t.vote_num <> 0 OR t.hot_score <> extract(epoch FROM t.created)
+	)
+	UPDATE threads t SET hot_score = s.score
+		FROM scores s
+		WHERE t.id = s.id AND t.hot_score <> s.score;
+	`)
+	panicIfErr(err)
+
+	// скрытые посты и посты заглушённых авторов непрочитанными не считаются, см. thread_unread
+	repo.selectUnread, err = db.Prepare(prefix+"selectUnread", `
+	SELECT u.unread, u.first_unread
+		FROM threads t LEFT JOIN thread_reads r ON r.thread = t.id AND r.user_nick = $2
+			CROSS JOIN LATERAL thread_unread(t.id, $2, coalesce(r.last_read, 0), coalesce(r.read_num, 0)) u
+		WHERE t.id = $1;
+	`)
+	panicIfErr(err)
+
+	// прочитанное не откатывается назад, если клиент прислал более ранний пост
+	repo.markRead, err = db.Prepare(prefix+"markRead", `
+	WITH r AS (
+		INSERT INTO thread_reads (user_nick, thread, last_read, read_num)
+			SELECT $1, p.thread, p.id, p.num FROM posts p WHERE p.id = $3 AND p.thread = $2
+		ON CONFLICT (user_nick, thread) DO UPDATE SET
+			last_read = greatest(thread_reads.last_read, excluded.last_read),
+			read_num = greatest(thread_reads.read_num, excluded.read_num),
+			updated = now()
+		RETURNING user_nick, last_read, read_num
+	)
+	SELECT r.user_nick, r.last_read, u.unread
+		FROM r CROSS JOIN LATERAL thread_unread($2, r.user_nick, r.last_read, r.read_num) u;
 	`)
 	panicIfErr(err)
 
@@ -88,14 +214,23 @@ func (threadRepo PSQLThreadRepo) Count(amount *uint) error {
 }
 
 func (threadRepo PSQLThreadRepo) Insert(thread *models.Thread) error {
-	return threadRepo.db.QueryRow(
+	tx, err := threadRepo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "PSQLThreadRepo Insert begin")
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(
 		threadRepo.insert.Name,
 		thread.Author,
 		thread.Forum,
 		thread.Message,
 		thread.Slug,
 		thread.Title,
-		thread.Created).Scan(
+		thread.Created,
+		thread.MessageHTML,
+		thread.Tags,
+		thread.Hidden).Scan(
 		&thread.Id,
 		&thread.Author,
 		&thread.Forum,
@@ -103,16 +238,39 @@ func (threadRepo PSQLThreadRepo) Insert(thread *models.Thread) error {
 		&thread.Slug,
 		&thread.Title,
 		&thread.Created,
-		&thread.Votes)
+		&thread.Votes,
+		&thread.Locked,
+		&thread.Pinned,
+		&thread.Closed,
+		&thread.CloseReason,
+		&thread.MessageHTML,
+		&thread.Tags,
+		&thread.Hidden); err != nil {
+		return err
+	}
+
+	if thread.Poll != nil {
+		if err := insertPoll(tx, thread.Id, thread.Poll); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (threadRepo PSQLThreadRepo) SelectByForum(threads *[]models.Thread, forum *models.Forum,
-	limit int, since string, desc bool) error {
-	rows, err := threadRepo.db.Query("SELECT id, author, forum,"+
-		"created, message, coalesce(slug, ''),"+
-		"title, vote_num "+
-		"from select_threads_by_forum($1, $2, nullif($3, ''), $4);",
-		forum.Slug, limit, since, desc)
+	limit int, since string, desc bool, viewer string, tags []string, anyTag bool, answered *bool, hidden bool) error {
+	rows, err := threadRepo.db.Query("SELECT t.id, t.author, t.forum,"+
+		"t.created, t.message, coalesce(t.slug, ''),"+
+		"t.title, t.vote_num, t.locked, t.pinned, t.closed, coalesce(t.close_reason, ''), t.message_html, t.tags, "+
+		"coalesce(t.accepted_post, 0), t.hidden, "+
+		"case when $5::text <> '' then u.unread end, coalesce(u.first_unread, 0) "+
+		"from select_threads_by_forum($1, $2, nullif($3, ''), $4, $6::text[], $7, $8, $9) with ordinality t "+
+		"left join thread_reads r on r.thread = t.id and r.user_nick = $5::citext "+
+		"left join lateral thread_unread(t.id, $5::citext, coalesce(r.last_read, 0), coalesce(r.read_num, 0)) u "+
+		"on $5::text <> '' "+
+		"order by t.ordinality;",
+		forum.Slug, limit, since, desc, viewer, tags, anyTag, answered, hidden)
 
 	if err != nil {
 		return err
@@ -123,15 +281,39 @@ func (threadRepo PSQLThreadRepo) SelectByForum(threads *[]models.Thread, forum *
 		*threads = append(*threads, models.Thread{})
 		if err := rows.Scan(&(*threads)[i].Id, &(*threads)[i].Author, &(*threads)[i].Forum,
 			&(*threads)[i].Created, &(*threads)[i].Message, &(*threads)[i].Slug,
-			&(*threads)[i].Title, &(*threads)[i].Votes); err != nil {
+			&(*threads)[i].Title, &(*threads)[i].Votes, &(*threads)[i].Locked, &(*threads)[i].Pinned,
+			&(*threads)[i].Closed, &(*threads)[i].CloseReason, &(*threads)[i].MessageHTML, &(*threads)[i].Tags,
+			&(*threads)[i].AcceptedPost, &(*threads)[i].Hidden, &(*threads)[i].UnreadCount, &(*threads)[i].FirstUnreadPostId); err != nil {
 			return err
 		}
+
+		if !strings.EqualFold((*threads)[i].Forum, forum.Slug) {
+			(*threads)[i].MovedTo = (*threads)[i].Forum
+			(*threads)[i].Message, (*threads)[i].MessageHTML = "", ""
+			(*threads)[i].UnreadCount, (*threads)[i].FirstUnreadPostId = nil, 0
+		}
 	}
 
 	return nil
 }
 
+// SelectBySlugOrId -- слаг или id влитой темы ведут на тему, в которую её влили
 func (threadRepo PSQLThreadRepo) SelectBySlugOrId(thread *models.Thread) error {
+	err := threadRepo.selectBySlugOrId(thread)
+	if err != pgx.ErrNoRows {
+		return err
+	}
+
+	var target int
+	if err := threadRepo.db.QueryRow(threadRepo.selectRedirect.Name, thread.Slug, thread.Id).Scan(&target); err != nil {
+		return err
+	}
+
+	thread.Id, thread.Slug = target, ""
+	return threadRepo.selectBySlugOrId(thread)
+}
+
+func (threadRepo PSQLThreadRepo) selectBySlugOrId(thread *models.Thread) error {
 	return threadRepo.db.QueryRow(
 		threadRepo.selectByIdOrSlug.Name,
 		thread.Slug,
@@ -143,7 +325,15 @@ func (threadRepo PSQLThreadRepo) SelectBySlugOrId(thread *models.Thread) error {
 		&thread.Message,
 		&thread.Title,
 		&thread.Votes,
-		&thread.Slug)
+		&thread.Slug,
+		&thread.Locked,
+		&thread.Pinned,
+		&thread.Closed,
+		&thread.CloseReason,
+		&thread.MessageHTML,
+		&thread.Tags,
+		&thread.AcceptedPost,
+		&thread.Hidden)
 }
 
 func (threadRepo PSQLThreadRepo) Update(thread *models.Thread) error {
@@ -152,7 +342,9 @@ func (threadRepo PSQLThreadRepo) Update(thread *models.Thread) error {
 		thread.Message,
 		thread.Title,
 		thread.Slug,
-		thread.Id).Scan(
+		thread.Id,
+		thread.MessageHTML,
+		thread.Tags).Scan(
 		&thread.Id,
 		&thread.Author,
 		&thread.Forum,
@@ -160,5 +352,550 @@ func (threadRepo PSQLThreadRepo) Update(thread *models.Thread) error {
 		&thread.Slug,
 		&thread.Title,
 		&thread.Created,
-		&thread.Votes)
+		&thread.Votes,
+		&thread.Locked,
+		&thread.Pinned,
+		&thread.Closed,
+		&thread.CloseReason,
+		&thread.MessageHTML,
+		&thread.Tags,
+		&thread.Hidden)
+}
+
+func (threadRepo PSQLThreadRepo) Moderate(thread *models.Thread, moderation *models.ThreadModeration) error {
+	return threadRepo.db.QueryRow(
+		threadRepo.moderate.Name,
+		moderation.Locked,
+		moderation.Pinned,
+		moderation.Closed,
+		moderation.Reason,
+		thread.Id,
+		moderation.Hidden).Scan(
+		&thread.Id,
+		&thread.Author,
+		&thread.Forum,
+		&thread.Message,
+		&thread.Slug,
+		&thread.Title,
+		&thread.Created,
+		&thread.Votes,
+		&thread.Locked,
+		&thread.Pinned,
+		&thread.Closed,
+		&thread.CloseReason,
+		&thread.MessageHTML,
+		&thread.Tags,
+		&thread.Hidden)
+}
+
+func (threadRepo PSQLThreadRepo) SelectUnread(thread *models.Thread, viewer string) error {
+	thread.UnreadCount = new(int)
+	return threadRepo.db.QueryRow(
+		threadRepo.selectUnread.Name,
+		thread.Id,
+		viewer).Scan(
+		thread.UnreadCount,
+		&thread.FirstUnreadPostId)
+}
+
+func (threadRepo PSQLThreadRepo) MarkRead(read *models.ThreadRead) error {
+	return threadRepo.db.QueryRow(
+		threadRepo.markRead.Name,
+		read.NickName,
+		read.Thread,
+		read.Post).Scan(
+		&read.NickName,
+		&read.Post,
+		&read.UnreadCount)
+}
+
+// SelectByAuthor -- темы упорядочены по (created, id), как и на странице форума
+func (threadRepo PSQLThreadRepo) SelectByAuthor(threads *[]models.Thread, user *models.User, forum string,
+	viewer string, limit int, since int, desc bool) error {
+	query := `
+	SELECT id, author, forum, created, message, coalesce(slug, ''), title, vote_num,
+		locked, pinned, closed, coalesce(close_reason, ''), tags
+		FROM threads
+		WHERE author = $1 AND ($2 = '' OR forum = $2::citext) AND NOT hidden AND forum_visible(forum, $5) `
+
+	if desc {
+		query += " AND ($3::int <= 0 OR (created, id) < (SELECT created, id FROM threads WHERE id = $3)) " +
+			"ORDER BY created DESC, id DESC "
+	} else {
+		query += " AND ($3::int <= 0 OR (created, id) > (SELECT created, id FROM threads WHERE id = $3)) " +
+			"ORDER BY created, id "
+	}
+	query += " LIMIT CASE WHEN $4::int > 0 THEN $4 END"
+
+	rows, err := threadRepo.db.Query(query, user.NickName, forum, since, limit, viewer)
+	if err != nil {
+		return errors.Wrap(err, "select threads by author")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i := len(*threads)
+		*threads = append(*threads, models.Thread{})
+		if err := rows.Scan(&(*threads)[i].Id, &(*threads)[i].Author, &(*threads)[i].Forum,
+			&(*threads)[i].Created, &(*threads)[i].Message, &(*threads)[i].Slug,
+			&(*threads)[i].Title, &(*threads)[i].Votes, &(*threads)[i].Locked, &(*threads)[i].Pinned,
+			&(*threads)[i].Closed, &(*threads)[i].CloseReason, &(*threads)[i].Tags); err != nil {
+			return errors.Wrap(err, "select threads by author scan")
+		}
+	}
+
+	return rows.Err()
+}
+
+// SelectHot -- порядок по hot_score стабилен между пересчётами, затухание к текущему моменту
+// применяется только к отдаваемому значению: логарифм рейтинга минус ln 2 за каждый период
+func (threadRepo PSQLThreadRepo) SelectHot(threads *[]models.Thread, forum string, viewer string, limit int,
+	since int, tags []string, anyTag bool, halfLife time.Duration) error {
+	rows, err := threadRepo.db.Query(`
+	SELECT id, author, forum, created, message, coalesce(slug, ''), title, vote_num,
+		locked, pinned, closed, coalesce(close_reason, ''), message_html, tags,
+		(hot_score - extract(epoch FROM now())) * ln(2) / $6::float8
+		FROM threads
+		WHERE ($1 = '' OR forum = $1::citext) AND NOT hidden
+			AND forum_visible(forum, $7)
+			AND (coalesce(cardinality($4::text[]), 0) = 0 OR CASE WHEN $5 THEN tags && $4 ELSE tags @> $4 END)
+			AND ($2::int <= 0 OR (hot_score, id) < (SELECT hot_score, id FROM threads WHERE id = $2))
+		ORDER BY hot_score DESC, id DESC
+		LIMIT CASE WHEN $3::int > 0 THEN $3 END;`,
+		forum, since, limit, tags, anyTag, halfLife.Seconds(), viewer)
+	if err != nil {
+		return errors.Wrap(err, "select hot threads")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i := len(*threads)
+		*threads = append(*threads, models.Thread{})
+		if err := rows.Scan(&(*threads)[i].Id, &(*threads)[i].Author, &(*threads)[i].Forum,
+			&(*threads)[i].Created, &(*threads)[i].Message, &(*threads)[i].Slug,
+			&(*threads)[i].Title, &(*threads)[i].Votes, &(*threads)[i].Locked, &(*threads)[i].Pinned,
+			&(*threads)[i].Closed, &(*threads)[i].CloseReason, &(*threads)[i].MessageHTML,
+			&(*threads)[i].Tags, &(*threads)[i].HotScore); err != nil {
+			return errors.Wrap(err, "select hot threads scan")
+		}
+	}
+
+	return rows.Err()
+}
+
+func (threadRepo PSQLThreadRepo) RecomputeHot(halfLife time.Duration) (int64, error) {
+	tag, err := threadRepo.db.Exec(threadRepo.recomputeHot.Name, halfLife.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "recompute hot scores")
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// Move -- тема, её посты, счётчики и участники обоих форумов меняются в одной транзакции
+func (threadRepo PSQLThreadRepo) Move(thread *models.Thread, move *models.ThreadMove) error {
+	tx, err := threadRepo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "PSQLThreadRepo Move begin")
+	}
+	defer tx.Rollback()
+
+	// права проверены в форуме thread.Forum; если тему успели перенести, её строка не найдётся
+	var postNum int
+	if err := tx.QueryRow("select forum, post_num from threads where id = $1 and forum = $2 for update",
+		thread.Id, thread.Forum).Scan(&move.From, &postNum); err != nil {
+		if err == pgx.ErrNoRows {
+			return err
+		}
+		return errors.Wrap(err, "lock thread")
+	}
+
+	// принятый ответ бывает только в qa-форуме
+	if _, err := tx.Exec(`
+		update threads set forum = $1,
+			accepted_post = case when (select type from forums where slug = $1) = 'qa' then accepted_post end
+			where id = $2`,
+		move.Forum, thread.Id); err != nil {
+		return errors.Wrap(err, "move thread")
+	}
+
+	if _, err := tx.Exec("update posts set forum = $1 where thread = $2", move.Forum, thread.Id); err != nil {
+		return errors.Wrap(err, "move posts")
+	}
+
+	if _, err := tx.Exec(`
+		update post_reports r set forum = $1 from posts p where p.id = r.post and p.thread = $2`,
+		move.Forum, thread.Id); err != nil {
+		return errors.Wrap(err, "move reports")
+	}
+
+	if _, err := tx.Exec(`
+		update forums set
+			thread_num = thread_num + case when slug = $1 then 1 else -1 end,
+			post_num = post_num + case when slug = $1 then $3 else -$3 end
+			where slug in ($1, $2)`,
+		move.Forum, move.From, postNum); err != nil {
+		return errors.Wrap(err, "move forum counters")
+	}
+
+	if err := moveForumUsers(tx, move.From, move.Forum, thread.Id, thread.Author); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRow(`
+		insert into thread_moves (thread, from_forum, to_forum, moved_by) values ($1, $2, $3, $4)
+		returning thread, to_forum, created`,
+		thread.Id, move.From, move.Forum, move.NickName).Scan(
+		&move.Thread, &move.Forum, &move.Created); err != nil {
+		return errors.Wrap(err, "insert thread move")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "PSQLThreadRepo Move commit")
+	}
+
+	return threadRepo.SelectBySlugOrId(thread)
+}
+
+// Merge -- посты source переезжают в thread под корневой пост с сообщением source,
+// голоса объединяются (голос в thread важнее), source удаляется и остаётся редиректом
+func (threadRepo PSQLThreadRepo) Merge(thread *models.Thread, source *models.Thread) error {
+	tx, err := threadRepo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "PSQLThreadRepo Merge begin")
+	}
+	defer tx.Rollback()
+
+	// обе темы блокируются в порядке id, чтобы встречные слияния не ждали друг друга;
+	// права проверены в форумах thread.Forum и source.Forum, перенесённую тему не трогаем
+	rows, err := tx.Query(`
+		select id, post_num from threads
+			where id = $1 and forum = $2 or id = $3 and forum = $4
+			order by id for update`,
+		thread.Id, thread.Forum, source.Id, source.Forum)
+	if err != nil {
+		return errors.Wrap(err, "lock threads")
+	}
+	var sourcePosts, locked int
+	for rows.Next() {
+		var id, postNum int
+		if err := rows.Scan(&id, &postNum); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "lock threads scan")
+		}
+		if id == source.Id {
+			sourcePosts = postNum
+		}
+		locked++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "lock threads")
+	}
+	if locked != 2 {
+		return pgx.ErrNoRows
+	}
+
+	var root int
+	if err := tx.QueryRow(`
+		insert into posts (author, created, message, message_html, thread, forum)
+			values ($1, $2, $3, $4, $5, $6)
+		returning id`,
+		source.Author, source.Created, source.Message, source.MessageHTML, thread.Id, thread.Forum).Scan(
+		&root); err != nil {
+		return errors.Wrap(err, "insert merge root post")
+	}
+
+	// пути задаются от корня и содержат только id, поэтому поддеревья сохраняются под новым корнем
+	if _, err := tx.Exec(`
+		update posts set thread = $1, forum = $2, parent = coalesce(parent, $3), path = array [$3::int] || path
+			where thread = $4`,
+		thread.Id, thread.Forum, root, source.Id); err != nil {
+		return errors.Wrap(err, "move posts")
+	}
+
+	// порядковые номера должны идти в порядке id, иначе непрочитанные считаются неверно
+	if err := renumberPosts(tx, thread.Id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		update thread_reads r set read_num = p.num from posts p where p.id = r.last_read and r.thread = $1`,
+		thread.Id); err != nil {
+		return errors.Wrap(err, "recount thread reads")
+	}
+
+	if _, err := tx.Exec(`
+		insert into votes (author, thread, voice) select author, $1, voice from votes where thread = $2
+		on conflict (author, thread) do nothing`,
+		thread.Id, source.Id); err != nil {
+		return errors.Wrap(err, "merge votes")
+	}
+
+	if _, err := tx.Exec(`
+		insert into thread_subscriptions (user_nick, thread, created)
+			select user_nick, $1, created from thread_subscriptions where thread = $2
+		on conflict (user_nick, thread) do nothing`,
+		thread.Id, source.Id); err != nil {
+		return errors.Wrap(err, "merge subscriptions")
+	}
+
+	// опрос source переезжает, если у thread своего нет, это проверено до слияния
+	if _, err := tx.Exec(`
+		insert into polls (thread, question, multiple, closes)
+			select $1, question, multiple, closes from polls where thread = $2`,
+		thread.Id, source.Id); err != nil {
+		return errors.Wrap(err, "move poll")
+	}
+	for _, table := range []string{"poll_options", "poll_ballots"} {
+		if _, err := tx.Exec("update "+table+" set thread = $1 where thread = $2", thread.Id, source.Id); err != nil {
+			return errors.Wrap(err, "move "+table)
+		}
+	}
+
+	for _, table := range []string{"votes", "thread_subscriptions", "thread_reads", "thread_moves", "polls"} {
+		if _, err := tx.Exec("delete from "+table+" where thread = $1", source.Id); err != nil {
+			return errors.Wrap(err, "delete source "+table)
+		}
+	}
+
+	// теги уже объединены в thread.Tags; принятый ответ source ушёл под новый корень и перестал
+	// быть корневым постом, поэтому остаётся только ответ thread
+	if _, err := tx.Exec("update threads set tags = coalesce($2::text[], '{}') where id = $1",
+		thread.Id, thread.Tags); err != nil {
+		return errors.Wrap(err, "merge tags")
+	}
+
+	if _, err := tx.Exec("update thread_redirects set thread = $1 where thread = $2",
+		thread.Id, source.Id); err != nil {
+		return errors.Wrap(err, "update redirects")
+	}
+
+	if _, err := tx.Exec("insert into thread_redirects (from_id, from_slug, thread) values ($1, nullif($2, ''), $3)",
+		source.Id, source.Slug, thread.Id); err != nil {
+		return errors.Wrap(err, "insert redirect")
+	}
+
+	if _, err := tx.Exec("delete from threads where id = $1", source.Id); err != nil {
+		return errors.Wrap(err, "delete source thread")
+	}
+
+	// корневой пост -- новый, остальные посты source лишь сменили форум
+	if _, err := tx.Exec("update forums set post_num = post_num + $1 + 1 where slug = $2",
+		sourcePosts, thread.Forum); err != nil {
+		return errors.Wrap(err, "merge target forum counters")
+	}
+
+	if _, err := tx.Exec("update forums set post_num = post_num - $1, thread_num = thread_num - 1 where slug = $2",
+		sourcePosts, source.Forum); err != nil {
+		return errors.Wrap(err, "merge source forum counters")
+	}
+
+	if _, err := tx.Exec("update status set post_num = post_num + 1, thread_num = thread_num - 1"); err != nil {
+		return errors.Wrap(err, "merge status counters")
+	}
+
+	if !strings.EqualFold(thread.Forum, source.Forum) {
+		if err := moveForumUsers(tx, source.Forum, thread.Forum, thread.Id, source.Author); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`
+			update post_reports r set forum = $1 from posts p where p.id = r.post and p.thread = $2`,
+			thread.Forum, thread.Id); err != nil {
+			return errors.Wrap(err, "move reports")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "PSQLThreadRepo Merge commit")
+	}
+
+	return threadRepo.selectBySlugOrId(thread)
+}
+
+// Split -- пост с потомками уходит в новую тему, сам пост становится в ней корнем;
+// поддерево переезжает целиком, так что родитель каждого поста остаётся в той же теме
+func (threadRepo PSQLThreadRepo) Split(thread *models.Thread, post *models.Post) error {
+	tx, err := threadRepo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "PSQLThreadRepo Split begin")
+	}
+	defer tx.Rollback()
+
+	var (
+		old, depth int
+		oldForum   string
+	)
+	// права проверены в форуме post.Forum; если пост успели перенести или удалить, делить нечего
+	if err := tx.QueryRow("select thread, array_length(path, 1) from posts where id = $1",
+		post.Id).Scan(&old, &depth); err != nil {
+		if err == pgx.ErrNoRows {
+			return err
+		}
+		return errors.Wrap(err, "select split post")
+	}
+	if err := tx.QueryRow("select forum from threads where id = $1 and forum = $2 for update",
+		old, post.Forum).Scan(&oldForum); err != nil {
+		if err == pgx.ErrNoRows {
+			return err
+		}
+		return errors.Wrap(err, "lock thread")
+	}
+
+	if err := tx.QueryRow(`
+		insert into threads (author, forum, message, slug, title, message_html, tags)
+			values ($1, $2, $3, nullif($4, ''), $5, $6, coalesce($7::text[], '{}'))
+		returning id, created`,
+		thread.Author, thread.Forum, thread.Message, thread.Slug, thread.Title, thread.MessageHTML,
+		thread.Tags).Scan(
+		&thread.Id, &thread.Created); err != nil {
+		return errors.Wrap(err, "insert split thread")
+	}
+
+	tag, err := tx.Exec(`
+		update posts set thread = $1, forum = $2, path = path[$4:],
+			parent = case when id = $3 then null else parent end
+			where thread = $5 and path[1:$4] = (select path from posts where id = $3)`,
+		thread.Id, thread.Forum, post.Id, depth, old)
+	if err != nil {
+		return errors.Wrap(err, "move subtree")
+	}
+	moved := int(tag.RowsAffected())
+	if moved == 0 {
+		return pgx.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`
+		update threads set accepted_post = null
+			where id = $1 and accepted_post in (select id from posts where thread = $2)`,
+		old, thread.Id); err != nil {
+		return errors.Wrap(err, "reset accepted post")
+	}
+
+	for _, id := range []int{old, thread.Id} {
+		if err := renumberPosts(tx, id); err != nil {
+			return err
+		}
+	}
+
+	// последний прочитанный пост мог уехать в новую тему, тогда отметка сдвигается назад
+	if _, err := tx.Exec(`
+		delete from thread_reads r where r.thread = $1
+			and not exists (select 1 from posts p where p.thread = $1 and p.id <= r.last_read)`,
+		old); err != nil {
+		return errors.Wrap(err, "delete thread reads")
+	}
+
+	if _, err := tx.Exec(`
+		update thread_reads r set (last_read, read_num) = (
+			select p.id, p.num from posts p where p.thread = $1 and p.id <= r.last_read order by p.id desc limit 1)
+			where r.thread = $1`,
+		old); err != nil {
+		return errors.Wrap(err, "recount thread reads")
+	}
+
+	if !strings.EqualFold(oldForum, thread.Forum) {
+		if _, err := tx.Exec("update forums set post_num = post_num + case when slug = $1 then $3 else -$3 end "+
+			"where slug in ($1, $2)", thread.Forum, oldForum, moved); err != nil {
+			return errors.Wrap(err, "split forum counters")
+		}
+
+		if err := moveForumUsers(tx, oldForum, thread.Forum, thread.Id, ""); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`
+			update post_reports r set forum = $1 from posts p where p.id = r.post and p.thread = $2`,
+			thread.Forum, thread.Id); err != nil {
+			return errors.Wrap(err, "move reports")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "PSQLThreadRepo Split commit")
+	}
+
+	return threadRepo.selectBySlugOrId(thread)
+}
+
+// renumberPosts -- порядковые номера постов темы заново по id и post_num по их числу
+func renumberPosts(tx *pgx.Tx, thread int) error {
+	if _, err := tx.Exec(`
+		update posts p set num = n.num
+			from (select id, row_number() over (order by id) num from posts where thread = $1) n
+			where p.id = n.id and p.num <> n.num`,
+		thread); err != nil {
+		return errors.Wrap(err, "renumber posts")
+	}
+
+	if _, err := tx.Exec("update threads set post_num = (select count(*) from posts where thread = $1) where id = $1",
+		thread); err != nil {
+		return errors.Wrap(err, "recount thread posts")
+	}
+
+	return nil
+}
+
+// moveForumUsers -- участники темы появляются в форуме to и пропадают из from,
+// если больше там ничего не писали; author -- автор темы, которой в thread может уже не быть
+func moveForumUsers(tx *pgx.Tx, from string, to string, thread int, author string) error {
+	// участник считается с первого поста или темы, переехавшие могли быть раньше уже имеющихся
+	if _, err := tx.Exec(`
+		insert into forum_users (forum, user_nick, created)
+			select $1, author, min(created) from (
+				select author, created from threads where id = $2
+				union all
+				select author, created from posts where thread = $2
+			) a group by author
+		on conflict (forum, user_nick) do update set created = excluded.created
+			where forum_users.created > excluded.created`,
+		to, thread); err != nil {
+		return errors.Wrap(err, "add forum users")
+	}
+
+	if _, err := tx.Exec(`
+		delete from forum_users fu
+			where fu.forum = $1
+				and fu.user_nick in (select author from threads where id = $2
+					union select author from posts where thread = $2 union select $3::citext)
+				and not exists (select 1 from threads t where t.forum = $1 and t.author = fu.user_nick)
+				and not exists (select 1 from posts p where p.forum = $1 and p.author = fu.user_nick)`,
+		from, thread, author); err != nil {
+		return errors.Wrap(err, "remove forum users")
+	}
+
+	// оставшимся в старом форуме первый пост мог уехать вместе с темой
+	if _, err := tx.Exec(`
+		update forum_users fu set created = m.created
+			from (
+				select author, min(created) created from (
+					select author, created from threads where forum = $1
+					union all
+					select author, created from posts where forum = $1
+				) a
+					where author in (select author from threads where id = $2
+						union select author from posts where thread = $2)
+					group by author
+			) m
+			where fu.forum = $1 and fu.user_nick = m.author and fu.created <> m.created`,
+		from, thread); err != nil {
+		return errors.Wrap(err, "recount forum users")
+	}
+
+	return nil
+}
+
+// Accept -- пост должен быть корневым постом этой темы, иначе ErrNoRows
+func (threadRepo PSQLThreadRepo) Accept(thread *models.Thread, post int) error {
+	if err := threadRepo.db.QueryRow(`
+		update threads set accepted_post = nullif($2, 0)
+			where id = $1 and ($2 = 0 or exists(
+				select 1 from posts where id = $2 and thread = $1 and parent is null and not hidden))
+		returning coalesce(accepted_post, 0)`,
+		thread.Id, post).Scan(&thread.AcceptedPost); err != nil {
+		return err
+	}
+
+	return nil
 }
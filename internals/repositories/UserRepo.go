@@ -9,13 +9,15 @@ import (
 )
 
 type UserRepo interface {
-	SelectByForum(users *[]models.User, forum *models.Forum, limit int, since string, desc bool) error // forum.GetUsers
-	Insert(user *models.User) error                                                                    // Create
-	SelectByNickname(user *models.User) error                                                          // Get
-	UpdateByNickname(user *models.User) error                                                          // Update
+	// forum.GetUsers, role -- фильтр по роли в форуме
+	SelectByForum(users *[]models.User, forum *models.Forum, limit int, since string, desc bool, role string) error
+	Insert(user *models.User) error           // Create
+	SelectByNickname(user *models.User) error // Get
+	UpdateByNickname(user *models.User) error // Update
 	SelectByNickNameOrEmail(users *[]models.User, user *models.User) error
 	CheckExistance(nicks map[string]bool) error
 	AddForumUsers(nicks map[string]bool, forum string) error
+	SelectStats(stats *models.UserStats, viewer string) error // Stats, по форумам, видимым viewer
 }
 
 type PSQLUserRepo struct {
@@ -109,9 +111,9 @@ func CreatePSQLUserRepo(db *pgx.ConnPool) UserRepo {
 	return repo
 }
 
-func (userRepo PSQLUserRepo) SelectByForum(users *[]models.User, forum *models.Forum, limit int, since string, desc bool) error {
+func (userRepo PSQLUserRepo) SelectByForum(users *[]models.User, forum *models.Forum, limit int, since string, desc bool, role string) error {
 	rows, err := userRepo.db.Query("SELECT about, email, full_name, nick_name "+
-		"from select_users_by_forum($1, $2, $3, $4)", forum.Slug, desc, limit, since)
+		"from select_users_by_forum($1, $2, $3, $4, $5)", forum.Slug, desc, limit, since, role)
 	if err != nil {
 		return err
 	}
@@ -161,3 +163,24 @@ func (userRepo PSQLUserRepo) SelectByNickNameOrEmail(users *[]models.User, user
 
 	return nil
 }
+
+func (userRepo PSQLUserRepo) SelectStats(stats *models.UserStats, viewer string) error {
+	if err := userRepo.db.QueryRow(`
+		select u.nick_name,
+			(select count(*) from posts where author = u.nick_name and forum_visible(forum, $2)),
+			(select count(*) from threads where author = u.nick_name and forum_visible(forum, $2)),
+			(select coalesce(sum(vote_num), 0) from threads where author = u.nick_name and forum_visible(forum, $2)),
+			array(select forum::text from forum_users where user_nick = u.nick_name and forum_visible(forum, $2)
+				order by forum)
+			from users u where u.nick_name = $1`,
+		stats.NickName, viewer).Scan(
+		&stats.NickName,
+		&stats.Posts,
+		&stats.Threads,
+		&stats.Votes,
+		&stats.Forums); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -7,9 +7,12 @@ import (
 )
 
 type VoteRepo interface {
-	Insert(vote *models.Vote, thread *models.Thread) error         // thread.Vote
-	Update(vote *models.Vote, thread *models.Thread) error         // thread.Vote
-	InsertOrUpdate(vote *models.Vote, thread *models.Thread) error // thread.Vote
+	InsertOrUpdate(vote *models.Vote, thread *models.Thread) error // thread.Vote, voice = 0 -- отзыв голоса
+	InsertOrUpdatePost(vote *models.Vote, post *models.Post) error // post.Vote
+	DeletePost(vote *models.Vote, post *models.Post) error         // post.Unvote, Reaction == "" -- голос
+	SelectByThreadAndNickname(vote *models.Vote, thread *models.Thread) error
+	// thread.Votes
+	SelectByThread(votes *[]models.Vote, thread *models.Thread, limit int, since string, desc bool) error
 }
 
 type PSQLVoteRepo struct {
@@ -20,139 +23,135 @@ func CreatePSQLVoteRepo(db *pgx.ConnPool) VoteRepo {
 	return PSQLVoteRepo{db: db}
 }
 
+// InsertOrUpdate -- голос ставится одним запросом thread_vote (или удаляется при voice = 0),
+// vote_num пересчитывают триггеры thread_rating_*
 func (voteRepo PSQLVoteRepo) InsertOrUpdate(vote *models.Vote, thread *models.Thread) error {
-	tx, err := voteRepo.db.Begin()
-	if err != nil {
-		return errors.Wrap(err, "PSQLVoteRepo Update begin")
+	return voteRepo.db.QueryRow("select author, created, forum, message, id, title, vote_num, coalesce(slug, ''), "+
+		"locked, pinned, closed, coalesce(close_reason, '') "+
+		"from thread_vote($1, $2, $3, $4)", thread.Slug, thread.Id, vote.NickName, vote.Voice).Scan(
+		&thread.Author, &thread.Created, &thread.Forum, &thread.Message, &thread.Id, &thread.Title, &thread.Votes,
+		&thread.Slug, &thread.Locked, &thread.Pinned, &thread.Closed, &thread.CloseReason)
+}
+
+// SelectByThreadAndNickname -- текущий голос пользователя, 0 если он не голосовал
+func (voteRepo PSQLVoteRepo) SelectByThreadAndNickname(vote *models.Vote, thread *models.Thread) error {
+	if err := voteRepo.db.QueryRow("select nick_name from users where nick_name = $1;",
+		vote.NickName).Scan(&vote.NickName); err != nil {
+		return err
 	}
-	defer tx.Rollback()
 
-	if err := tx.QueryRow("select nick_name from users where nick_name = $1;", vote.NickName).Scan(&vote.NickName); err != nil {
-		return pgx.ErrNoRows
+	err := voteRepo.db.QueryRow("select voice from votes where author = $1 and thread = $2",
+		vote.NickName, thread.Id).Scan(&vote.Voice)
+	if err == pgx.ErrNoRows {
+		vote.Voice = 0
+		return nil
 	}
 
-	if thread.Id >= 0 {
-		if err := tx.QueryRow("select id from threads where id = $1", thread.Id).Scan(&thread.Id); err != nil {
-			return pgx.ErrNoRows
-		}
+	return err
+}
+
+func (voteRepo PSQLVoteRepo) SelectByThread(votes *[]models.Vote, thread *models.Thread, limit int, since string, desc bool) error {
+	query := "select author, voice from votes where thread = $1 "
+
+	if desc {
+		query += " and ($2::citext = '' or author < $2::citext) order by author desc "
 	} else {
-		if err := tx.QueryRow("select id from threads where slug = $1", thread.Slug).Scan(&thread.Id); err != nil {
-			return pgx.ErrNoRows
-		}
+		query += " and ($2::citext = '' or author > $2::citext) order by author "
 	}
+	query += " limit case when $3::int > 0 then $3 end"
 
-	if err := tx.QueryRow("select author, thread from votes where author = $1 and thread = $2",
-		vote.NickName, thread.Id).Scan(&vote.NickName, &thread.Id); err != nil {
-		if _, err := tx.Exec("insert into votes (author, thread, voice) values ($1, $2, $3)",
-			vote.NickName, thread.Id, vote.Voice); err != nil {
-			return errors.Wrap(err, "insert")
-		}
-	} else {
-		if _, err := tx.Exec("update votes set voice = $1 where author = $2 and thread = $3",
-			vote.Voice, vote.NickName, thread.Id); err != nil {
-			return errors.Wrap(err, "update")
-		}
+	rows, err := voteRepo.db.Query(query, thread.Id, since, limit)
+	if err != nil {
+		return errors.Wrap(err, "PSQLVoteRepo SelectByThread")
 	}
+	defer rows.Close()
 
-	if err := tx.QueryRow("select author, created, forum, message, id, title, vote_num, coalesce(slug, '') "+
-		"from threads where id = $1", thread.Id).Scan(&thread.Author, &thread.Created, &thread.Forum,
-		&thread.Message, &thread.Id, &thread.Title, &thread.Votes, &thread.Slug); err != nil {
-		return errors.Wrap(err, "select thread")
+	for rows.Next() {
+		i := len(*votes)
+		*votes = append(*votes, models.Vote{})
+		if err := rows.Scan(&(*votes)[i].NickName, &(*votes)[i].Voice); err != nil {
+			return errors.Wrap(err, "PSQLVoteRepo SelectByThread scan")
+		}
 	}
 
-	return tx.Commit()
+	return rows.Err()
 }
 
-func (voteRepo PSQLVoteRepo) Update(vote *models.Vote, thread *models.Thread) error {
+func (voteRepo PSQLVoteRepo) InsertOrUpdatePost(vote *models.Vote, post *models.Post) error {
 	tx, err := voteRepo.db.Begin()
 	if err != nil {
-		return errors.Wrap(err, "PSQLVoteRepo Update begin")
+		return errors.Wrap(err, "PSQLVoteRepo InsertOrUpdatePost begin")
 	}
-
 	defer tx.Rollback()
 
-	query := `
-		update Votes set Voice = $1
-		where Author = $2 
-			and 
-`
-
-	if thread.Id >= 0 {
-		query += "Thread = $3;"
-		_, err = tx.Exec(query, vote.Voice, vote.NickName, thread.Id)
-	} else {
-		query += "Thread = (select Id from Threads where Slug = $3);"
-		_, err = tx.Exec(query, vote.Voice, vote.NickName, thread.Slug)
+	if err := tx.QueryRow("select nick_name from users where nick_name = $1;", vote.NickName).Scan(&vote.NickName); err != nil {
+		return pgx.ErrNoRows
 	}
 
-	if err != nil {
-		return errors.Wrap(err, "PSQLVoteRepo Update insert")
+	if err := tx.QueryRow("select id from posts where id = $1", post.Id).Scan(&post.Id); err != nil {
+		return pgx.ErrNoRows
 	}
 
-	selectQuery := `
-		select th.author, th.Created, th.Forum,
-	    	th.Message, th.Id, th.Title, th.vote_num, th.Slug
-		from Threads th
-			`
+	if vote.Voice != 0 {
+		if _, err := tx.Exec("insert into post_votes (author, post, voice) values ($1, $2, $3) "+
+			"on conflict (author, post) do update set voice = excluded.voice",
+			vote.NickName, post.Id, vote.Voice); err != nil {
+			return errors.Wrap(err, "post vote")
+		}
+	}
 
-	var row *pgx.Row
-	if thread.Id >= 0 {
-		selectQuery += "where th.Id = $1;"
-		row = tx.QueryRow(selectQuery, thread.Id)
-	} else {
-		selectQuery += "where th.Slug = $1;"
-		row = tx.QueryRow(selectQuery, thread.Slug)
+	if vote.Reaction != "" {
+		if _, err := tx.Exec("insert into post_reactions (author, post, emoji) values ($1, $2, $3) "+
+			"on conflict do nothing", vote.NickName, post.Id, vote.Reaction); err != nil {
+			return errors.Wrap(err, "post reaction")
+		}
 	}
 
-	if err = errors.Wrap(row.Scan(&thread.Author, &thread.Created, &thread.Forum, &thread.Message,
-		&thread.Id, &thread.Title, &thread.Votes, &thread.Slug), "PSQLVoteRepo Update"); err != nil {
+	if err := selectVotedPost(tx, post); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
 
-func (voteRepo PSQLVoteRepo) Insert(vote *models.Vote, thread *models.Thread) error {
+// DeletePost -- снять голос или реакцию, которых нет, не ошибка
+func (voteRepo PSQLVoteRepo) DeletePost(vote *models.Vote, post *models.Post) error {
 	tx, err := voteRepo.db.Begin()
 	if err != nil {
-		return errors.Wrap(err, "PSQLVoteRepo Insert begin")
+		return errors.Wrap(err, "PSQLVoteRepo DeletePost begin")
 	}
 	defer tx.Rollback()
 
-	query := `insert into Votes (Author, Thread, Voice)
-				values ($1,`
-
-	if thread.Id >= 0 {
-		query += "$2, $3);"
-		_, err = tx.Exec(query, vote.NickName, thread.Id, vote.Voice)
-	} else {
-		query += "(SELECT id FROM threads WHERE slug = $2), $3);"
-		_, err = tx.Exec(query, vote.NickName, thread.Slug, vote.Voice)
+	if err := tx.QueryRow("select nick_name from users where nick_name = $1;", vote.NickName).Scan(&vote.NickName); err != nil {
+		return pgx.ErrNoRows
 	}
 
-	if err != nil {
-		return errors.Wrap(err, "PSQLVoteRepo Insert insert")
+	if err := tx.QueryRow("select id from posts where id = $1", post.Id).Scan(&post.Id); err != nil {
+		return pgx.ErrNoRows
 	}
 
-	selectQuery := `
-		select th.author, th.Created, th.Forum,
-	    	th.Message, th.Id, th.Title, th.Vote_num, th.Slug
-		from Threads th
-			`
-
-	var row *pgx.Row
-	if thread.Id >= 0 {
-		selectQuery += "where th.Id = $1;"
-		row = tx.QueryRow(selectQuery, thread.Id)
+	if vote.Reaction == "" {
+		_, err = tx.Exec("delete from post_votes where author = $1 and post = $2", vote.NickName, post.Id)
 	} else {
-		selectQuery += "where th.Slug = $1;"
-		row = tx.QueryRow(selectQuery, thread.Slug)
+		_, err = tx.Exec("delete from post_reactions where author = $1 and post = $2 and emoji = $3",
+			vote.NickName, post.Id, vote.Reaction)
+	}
+	if err != nil {
+		return errors.Wrap(err, "delete post vote")
 	}
 
-	if err = errors.Wrap(row.Scan(&thread.Author, &thread.Created, &thread.Forum, &thread.Message,
-		&thread.Id, &thread.Title, &thread.Votes, &thread.Slug), "PSQLVoteRepo Insert"); err != nil {
+	if err := selectVotedPost(tx, post); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
+
+// selectVotedPost -- пост с уже пересчитанными триггерами голосами и реакциями
+func selectVotedPost(tx *pgx.Tx, post *models.Post) error {
+	err := tx.QueryRow("select author, created, forum, is_edited, case when hidden then '' else message end, "+
+		"coalesce(parent, 0), thread, vote_num, reactions, hidden from posts where id = $1", post.Id).Scan(
+		&post.Author, &post.Created, &post.Forum, &post.IsEdited, &post.Message, &post.Parent, &post.Thread,
+		&post.Votes, &post.Reactions, &post.Hidden)
+	return errors.Wrap(err, "select post")
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ApTyp5/new_db_techno/internals/dbtest"
+	"github.com/ApTyp5/new_db_techno/internals/models"
+)
+
+func TestVoteConcurrentVoters(t *testing.T) {
+	const voters = 20
+
+	db := dbtest.Connect(t)
+	nicks := make([]string, 0, voters)
+	for i := 0; i < voters; i++ {
+		nick := "voter" + strconv.Itoa(i)
+		if _, err := db.Exec("insert into users (nick_name, email, full_name) values ($1, $1 || '@example.com', $1)",
+			nick); err != nil {
+			t.Fatal(err)
+		}
+		nicks = append(nicks, nick)
+	}
+
+	var thread int
+	if _, err := db.Exec("insert into forums (slug, title, responsible) values ('f', 'f', $1)", nicks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("insert into threads (author, forum, title, message) values ($1, 'f', 't', 'm') returning id",
+		nicks[0]).Scan(&thread); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := CreatePSQLVoteRepo(db)
+	vote := func(nick string, voice int) error {
+		return repo.InsertOrUpdate(&models.Vote{NickName: nick, Voice: voice}, &models.Thread{Id: thread})
+	}
+
+	// каждый голосует несколько раз вперемешку с остальными, последним -- за +1,
+	// а нечётные потом ещё и отзывают голос
+	var wg sync.WaitGroup
+	errs := make(chan error, voters*4)
+	for i, nick := range nicks {
+		wg.Add(1)
+		go func(nick string, odd bool) {
+			defer wg.Done()
+			for _, voice := range []int{1, -1, 1} {
+				errs <- vote(nick, voice)
+			}
+			if odd {
+				errs <- vote(nick, 0)
+			}
+		}(nick, i%2 == 1)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := (voters + 1) / 2
+
+	var votes, stored int
+	if err := db.QueryRow("select vote_num, (select coalesce(sum(voice), 0) from votes where thread = $1) "+
+		"from threads where id = $1", thread).Scan(&votes, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if votes != want || stored != want {
+		t.Fatalf("vote_num %d, votes sum %d, want %d", votes, stored, want)
+	}
+}
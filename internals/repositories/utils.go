@@ -1,7 +1,18 @@
 package repositories
 
+import (
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
 func panicIfErr(err error) {
 	if err != nil {
 		panic(err)
 	}
 }
+
+// IsUniqueViolation -- запись упёрлась в уникальный индекс, например занятый slug темы
+func IsUniqueViolation(err error) bool {
+	pgErr, ok := errors.Cause(err).(pgx.PgError)
+	return ok && pgErr.Code == "23505"
+}
@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	if !IsUniqueViolation(errors.Wrap(pgx.PgError{Code: "23505"}, "insert")) {
+		t.Error("wrapped unique violation")
+	}
+	if IsUniqueViolation(pgx.PgError{Code: "23503"}) || IsUniqueViolation(pgx.ErrNoRows) || IsUniqueViolation(nil) {
+		t.Error("other errors")
+	}
+}
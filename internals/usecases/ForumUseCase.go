@@ -2,31 +2,65 @@ package usecases
 
 import (
 	_const "github.com/ApTyp5/new_db_techno/const"
+	"github.com/ApTyp5/new_db_techno/internals/filters"
+	"github.com/ApTyp5/new_db_techno/internals/markup"
 	"github.com/ApTyp5/new_db_techno/internals/models"
 	"github.com/ApTyp5/new_db_techno/internals/repositories"
 	"github.com/jackc/pgx"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ForumUseCase interface {
 	Create(forum *models.Forum) (int, interface{})
 	CreateThread(thread *models.Thread) (int, interface{})
-	Details(slug string) (int, interface{})
-	Threads(slug string, limit int, since string, desc bool) (int, interface{})
-	Users(slug string, limit int, since string, desc bool) (int, interface{})
+	Details(slug string, viewer string) (int, interface{})
+	Children(slug string, viewer string) (int, interface{}) // /forum/{slug}/children, только видимые viewer
+	// sort=hot -- по hot_score, since при этом -- id темы; tag -- теги через запятую, tagMode=or -- любой из них;
+	// answered -- true или false, только для обычной сортировки
+	Threads(slug string, limit int, since string, desc bool, viewer string, sort string,
+		tag string, tagMode string, answered string) (int, interface{})
+	Users(slug string, limit int, since string, desc bool, role string, viewer string) (int, interface{})
+	Filters(slug string, viewer string) (int, interface{})                                      // /forum/{slug}/filters
+	SetFilters(slug string, change *models.FilterChange) (int, interface{})                     // /forum/{slug}/filters
+	GrantRole(slug string, change *models.RoleChange) (int, interface{})                        // /forum/{slug}/roles
+	RevokeRole(slug string, change *models.RoleChange) (int, interface{})                       // /forum/{slug}/roles/{user}
+	Stats(slug string, from string, to string, bucket string, viewer string) (int, interface{}) // /forum/{slug}/stats
+	Subscribe(slug string, sub *models.Subscription) (int, interface{})                         // /forum/{slug}/subscribe
+	Unsubscribe(slug string, sub *models.Subscription) (int, interface{})                       // /forum/{slug}/subscribe
+	Tags(slug string, viewer string) (int, interface{})                                         // /forum/{slug}/tags
+	SetTags(slug string, change *models.ForumTags) (int, interface{})                           // /forum/{slug}/tags
+	Invite(slug string, change *models.InviteChange) (int, interface{})                         // /forum/{slug}/invite
+	Join(slug string, change *models.InviteChange) (int, interface{})                           // /forum/{slug}/join
+	Invites(slug string, viewer string) (int, interface{})                                      // /forum/{slug}/invites
+	CancelInvite(slug string, change *models.InviteChange) (int, interface{})                   // /forum/{slug}/invites/{user}
 }
 
 type RDBForumUseCase struct {
-	fs repositories.ForumRepo
-	ts repositories.ThreadRepo
-	us repositories.UserRepo
+	fs  repositories.ForumRepo
+	ts  repositories.ThreadRepo
+	us  repositories.UserRepo
+	rs  repositories.RoleRepo
+	fls repositories.FilterRepo
+	ss  repositories.SubscriptionRepo
+	tgs repositories.TagRepo
+	is  repositories.InviteRepo
+	bs  repositories.BlockRepo
 }
 
 func CreateRDBForumUseCase(db *pgx.ConnPool) ForumUseCase {
 	return RDBForumUseCase{
-		fs: repositories.CreatePSQLForumRepo(db),
-		ts: repositories.CreatePSQLThreadRepo(db),
-		us: repositories.CreatePSQLUserRepo(db),
+		fs:  repositories.CreatePSQLForumRepo(db),
+		ts:  repositories.CreatePSQLThreadRepo(db),
+		us:  repositories.CreatePSQLUserRepo(db),
+		rs:  repositories.CreatePSQLRoleRepo(db),
+		fls: repositories.CreatePSQLFilterRepo(db),
+		ss:  repositories.CreatePSQLSubscriptionRepo(db),
+		tgs: repositories.CreatePSQLTagRepo(db),
+		is:  repositories.CreatePSQLInviteRepo(db),
+		bs:  repositories.CreatePSQLBlockRepo(db),
 	}
 }
 
@@ -47,6 +81,38 @@ func (forumUseCase RDBForumUseCase) Create(forum *models.Forum) (int, interface{
 		return http.StatusInternalServerError, wrapError(err)
 	}
 
+	switch forum.Type {
+	case "":
+		forum.Type = models.ForumDiscussion
+	case models.ForumDiscussion, models.ForumQA:
+	default:
+		return http.StatusBadRequest, wrapStrError("forum type must be discussion or qa")
+	}
+
+	switch forum.Visibility {
+	case "":
+		forum.Visibility = models.VisibilityPublic
+	case models.VisibilityPublic, models.VisibilityPrivate, models.VisibilityReadOnly:
+	default:
+		return http.StatusBadRequest, wrapStrError("forum visibility must be public, private or read_only")
+	}
+
+	// у нового форума потомков нет, так что цикл возможен только через самого себя
+	if forum.Parent != "" {
+		if strings.EqualFold(forum.Parent, forum.Slug) {
+			return http.StatusBadRequest, wrapStrError("forum cannot be its own parent")
+		}
+
+		parent := &models.Forum{Slug: forum.Parent}
+		if err = forumUseCase.fs.SelectBySlug(parent); err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("parent forum not found")
+		}
+		if err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+		forum.Parent = parent.Slug
+	}
+
 	if err = forumUseCase.fs.Insert(forum); err != nil {
 		return http.StatusInternalServerError, wrapError(err)
 	}
@@ -73,7 +139,8 @@ func (forumUseCase RDBForumUseCase) CreateThread(thread *models.Thread) (int, in
 		return http.StatusInternalServerError, wrapError(err)
 	}
 
-	if err = forumUseCase.fs.SelectBySlug(&models.Forum{Slug: thread.Forum}); err == pgx.ErrNoRows {
+	forum := &models.Forum{Slug: thread.Forum}
+	if err = forumUseCase.fs.SelectBySlug(forum); err == pgx.ErrNoRows {
 		return http.StatusNotFound, wrapStrError("forum not found")
 	}
 
@@ -81,25 +148,137 @@ func (forumUseCase RDBForumUseCase) CreateThread(thread *models.Thread) (int, in
 		return http.StatusInternalServerError, wrapError(err)
 	}
 
+	if status, resp := checkWrite(forumUseCase.rs, forum, map[string]bool{thread.Author: true}, "forum not found"); resp != nil {
+		return status, resp
+	}
+
+	if role, err := forumRole(forumUseCase.rs, thread.Forum, thread.Author); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if role == models.RoleBanned {
+		return http.StatusForbidden, wrapStrError("user is banned in this forum")
+	}
+
+	if thread.Tags == nil {
+		thread.Tags = make([]string, 0)
+	}
+	if status, resp := checkTags(forumUseCase.tgs, thread.Forum, &thread.Tags); resp != nil {
+		return status, resp
+	}
+
+	if thread.Poll != nil {
+		if err := checkPoll(thread.Poll); err != nil {
+			return http.StatusBadRequest, wrapError(err)
+		}
+	}
+
+	pipeline, err := forumPipeline(forumUseCase.fls, thread.Forum, forumUseCase.fls.RecentThread)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	content := filters.Content{Forum: thread.Forum, Author: thread.Author, Message: thread.Message}
+	result, err := pipeline.Run(&content)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if result.Verdict == filters.Reject {
+		return http.StatusBadRequest, filterRejection(result)
+	}
+	thread.Message = content.Message
+
+	if thread.MessageHTML, err = markup.Render(thread.Message); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	thread.Hidden = result.Verdict == filters.Hold
 	if err := forumUseCase.ts.Insert(thread); err != nil {
 		return http.StatusInternalServerError, wrapError(err)
 	}
 
+	// задержанная фильтром тема создаётся скрытой и закрытой, одобрить её может модератор
+	if result.Verdict == filters.Hold {
+		closed := true
+		moderation := &models.ThreadModeration{
+			Closed: &closed,
+			Reason: "held for review by filter " + result.Filter + ": " + result.Reason,
+		}
+		if err := forumUseCase.ts.Moderate(thread, moderation); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+	}
+
 	return http.StatusCreated, thread
 }
 
-func (forumUseCase RDBForumUseCase) Details(slug string) (int, interface{}) {
+func (forumUseCase RDBForumUseCase) Details(slug string, viewer string) (int, interface{}) {
 	forum := &models.Forum{Slug: slug}
-	if err := forumUseCase.fs.SelectBySlug(forum); err == nil {
-		return http.StatusOK, forum
-	} else if err == pgx.ErrNoRows {
+	if err := forumUseCase.fs.SelectBySlug(forum); err == pgx.ErrNoRows {
 		return http.StatusNotFound, wrapStrError("forum not found")
-	} else {
+	} else if err != nil {
 		return http.StatusInternalServerError, wrapError(err)
 	}
+
+	if ok, err := canRead(forumUseCase.rs, forum, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	if err := forumUseCase.fs.SelectTree(forum); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, forum
 }
 
-func (forumUseCase RDBForumUseCase) Threads(slug string, limit int, since string, desc bool) (int, interface{}) {
+func (forumUseCase RDBForumUseCase) Children(slug string, viewer string) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err == pgx.ErrNoRows {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	} else if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if ok, err := canRead(forumUseCase.rs, forum, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	children := make([]models.Forum, 0, _const.BuffSize)
+	if err := forumUseCase.fs.SelectChildren(&children, forum); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	forums := make([]models.Forum, 0, len(children))
+	for i := range children {
+		if ok, err := canRead(forumUseCase.rs, &children[i], viewer); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		} else if ok {
+			forums = append(forums, children[i])
+		}
+	}
+
+	return http.StatusOK, forums
+}
+
+func (forumUseCase RDBForumUseCase) Threads(slug string, limit int, since string, desc bool, viewer string, sort string,
+	tag string, tagMode string, answered string) (int, interface{}) {
+	tags, err := parseTags(tag)
+	if err != nil {
+		return http.StatusBadRequest, wrapError(err)
+	}
+	anyTag := tagMode == "or"
+
+	var hasAnswer *bool
+	if answered != "" {
+		value, err := strconv.ParseBool(answered)
+		if err != nil {
+			return http.StatusBadRequest, wrapStrError("answered must be true or false")
+		}
+		hasAnswer = &value
+	}
+
 	forum := &models.Forum{Slug: slug}
 	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
 		if err == pgx.ErrNoRows {
@@ -108,15 +287,93 @@ func (forumUseCase RDBForumUseCase) Threads(slug string, limit int, since string
 		return http.StatusInternalServerError, wrapError(err)
 	}
 
+	if ok, err := canRead(forumUseCase.rs, forum, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	muted, err := mutedBy(forumUseCase.bs, viewer)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
 	threads := make([]models.Thread, 0, _const.BuffSize)
-	if err := forumUseCase.ts.SelectByForum(&threads, forum, limit, since, desc); err != nil {
+	if sort == "hot" {
+		after := 0
+		if since != "" {
+			if after, err = strconv.Atoi(since); err != nil {
+				return http.StatusBadRequest, wrapStrError("since must be a thread id for sort=hot")
+			}
+		}
+
+		if err := forumUseCase.ts.SelectHot(&threads, forum.Slug, viewer, limit, after, tags, anyTag, _const.HotHalfLife); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+		collapseMutedThreads(threads, muted)
+		return http.StatusOK, &threads
+	}
+
+	// задержанные фильтром темы в списке видят только модераторы
+	held := false
+	if viewer != "" {
+		role, err := forumRole(forumUseCase.rs, forum.Slug, viewer)
+		if err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+		held = canModerate(role)
+	}
+
+	if err := forumUseCase.ts.SelectByForum(&threads, forum, limit, since, desc, viewer, tags, anyTag, hasAnswer,
+		held); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	collapseMutedThreads(threads, muted)
+
+	if err := forumUseCase.hideMovedStubs(threads, viewer); err != nil {
 		return http.StatusInternalServerError, wrapError(err)
 	}
 
 	return http.StatusOK, &threads
 }
 
-func (forumUseCase RDBForumUseCase) Users(slug string, limit int, since string, desc bool) (int, interface{}) {
+// hideMovedStubs -- у заглушки темы, перенесённой в закрытый для viewer форум, не показываем заголовок
+func (forumUseCase RDBForumUseCase) hideMovedStubs(threads []models.Thread, viewer string) error {
+	visible := make(map[string]bool)
+	for i := range threads {
+		if threads[i].MovedTo == "" {
+			continue
+		}
+
+		target := strings.ToLower(threads[i].MovedTo)
+		ok, known := visible[target]
+		if !known {
+			forum := &models.Forum{Slug: threads[i].MovedTo}
+			if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+				return err
+			}
+			var err error
+			if ok, err = canRead(forumUseCase.rs, forum, viewer); err != nil {
+				return err
+			}
+			visible[target] = ok
+		}
+
+		if !ok {
+			threads[i].Title, threads[i].Slug, threads[i].Tags = "", "", []string{}
+		}
+	}
+
+	return nil
+}
+
+func (forumUseCase RDBForumUseCase) Users(slug string, limit int, since string, desc bool, role string, viewer string) (int, interface{}) {
+	switch role {
+	case "", models.RoleOwner, models.RoleModerator, models.RoleMember, models.RoleBanned:
+	default:
+		return http.StatusBadRequest, wrapStrError("unknown role")
+	}
+
 	forum := &models.Forum{Slug: slug}
 
 	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
@@ -127,10 +384,497 @@ func (forumUseCase RDBForumUseCase) Users(slug string, limit int, since string,
 		return http.StatusInternalServerError, err
 	}
 
+	if ok, err := canRead(forumUseCase.rs, forum, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
 	users := make([]models.User, 0, _const.BuffSize)
-	if err := forumUseCase.us.SelectByForum(&users, forum, limit, since, desc); err != nil {
+	if err := forumUseCase.us.SelectByForum(&users, forum, limit, since, desc, role); err != nil {
 		return http.StatusInternalServerError, err
 	}
 
 	return http.StatusOK, &users
 }
+
+func (forumUseCase RDBForumUseCase) Filters(slug string, viewer string) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if ok, err := canRead(forumUseCase.rs, forum, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	config := models.FilterConfig{}
+	if err := forumUseCase.fls.SelectByForum(forum.Slug, &config); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, config
+}
+
+func (forumUseCase RDBForumUseCase) SetFilters(slug string, change *models.FilterChange) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if ok, err := canRead(forumUseCase.rs, forum, change.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	if role, err := forumRole(forumUseCase.rs, forum.Slug, change.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !canModerate(role) {
+		return http.StatusForbidden, wrapStrError("only forum owner or moderators can configure filters")
+	}
+
+	if _, err := filters.Build(&change.FilterConfig, nil); err != nil {
+		return http.StatusBadRequest, wrapError(err)
+	}
+
+	if err := forumUseCase.fls.Upsert(forum.Slug, &change.FilterConfig); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, change.FilterConfig
+}
+
+func (forumUseCase RDBForumUseCase) GrantRole(slug string, change *models.RoleChange) (int, interface{}) {
+	switch change.Role {
+	case models.RoleModerator, models.RoleMember, models.RoleBanned:
+	default:
+		return http.StatusBadRequest, wrapStrError("role must be moderator, member or banned")
+	}
+
+	change.Forum = slug
+	if code, msg := forumUseCase.checkRoleChange(change); msg != nil {
+		return code, msg
+	}
+
+	if err := forumUseCase.rs.Upsert(&change.ForumRole); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, change.ForumRole
+}
+
+func (forumUseCase RDBForumUseCase) RevokeRole(slug string, change *models.RoleChange) (int, interface{}) {
+	change.Forum = slug
+	if code, msg := forumUseCase.checkRoleChange(change); msg != nil {
+		return code, msg
+	}
+
+	if err := forumUseCase.rs.Delete(&change.ForumRole); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	change.Role, change.Expires = models.RoleMember, nil
+	return http.StatusOK, change.ForumRole
+}
+
+// checkRoleChange -- модераторы управляют участниками и банами, назначать модераторов может только владелец
+func (forumUseCase RDBForumUseCase) checkRoleChange(change *models.RoleChange) (int, interface{}) {
+	forum := &models.Forum{Slug: change.Forum}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	change.Forum = forum.Slug
+
+	if ok, err := canRead(forumUseCase.rs, forum, change.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	user := &models.User{NickName: change.User}
+	if err := forumUseCase.us.SelectByNickname(user); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	change.User = user.NickName
+
+	actorRole, err := forumRole(forumUseCase.rs, forum.Slug, change.NickName)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	targetRole, err := forumRole(forumUseCase.rs, forum.Slug, change.User)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if !canModerate(actorRole) {
+		return http.StatusForbidden, wrapStrError("only forum owner or moderators can change roles")
+	}
+
+	if targetRole == models.RoleOwner {
+		return http.StatusForbidden, wrapStrError("forum owner role can't be changed")
+	}
+
+	if (targetRole == models.RoleModerator || change.Role == models.RoleModerator) && actorRole != models.RoleOwner {
+		return http.StatusForbidden, wrapStrError("only forum owner can manage moderators")
+	}
+
+	return 0, nil
+}
+
+func (forumUseCase RDBForumUseCase) Subscribe(slug string, sub *models.Subscription) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if ok, err := canRead(forumUseCase.rs, forum, sub.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	sub.Forum = forum.Slug
+	return subscribe(forumUseCase.us, forumUseCase.ss, sub)
+}
+
+func (forumUseCase RDBForumUseCase) Unsubscribe(slug string, sub *models.Subscription) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	sub.Forum = forum.Slug
+	return unsubscribe(forumUseCase.ss, sub)
+}
+
+// Stats -- по умолчанию последние 7 суток по дням; from и to в RFC 3339
+func (forumUseCase RDBForumUseCase) Stats(slug string, from string, to string, bucket string, viewer string) (int, interface{}) {
+	stats := models.ForumStats{Bucket: bucket, To: time.Now()}
+	if stats.Bucket == "" {
+		stats.Bucket = "day"
+	}
+
+	step := 24 * time.Hour
+	switch stats.Bucket {
+	case "day":
+	case "hour":
+		step = time.Hour
+	default:
+		return http.StatusBadRequest, wrapStrError("bucket must be day or hour")
+	}
+
+	var err error
+	if to != "" {
+		if stats.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return http.StatusBadRequest, wrapStrError("invalid to")
+		}
+	}
+
+	stats.From = stats.To.Add(-7 * 24 * time.Hour)
+	if from != "" {
+		if stats.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return http.StatusBadRequest, wrapStrError("invalid from")
+		}
+	}
+
+	if !stats.From.Before(stats.To) {
+		return http.StatusBadRequest, wrapStrError("from must be before to")
+	}
+
+	if stats.To.Sub(stats.From)/step >= time.Duration(_const.StatsMaxBuckets) {
+		return http.StatusBadRequest, wrapStrError("range is too large for this bucket")
+	}
+
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if ok, err := canRead(forumUseCase.rs, forum, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	stats.Forum = forum.Slug
+	stats.Series = make([]models.StatsBucket, 0)
+	stats.TopPosters = make([]models.TopPoster, 0, _const.StatsTop)
+	stats.TopThreads = make([]models.Thread, 0, _const.StatsTop)
+	if err := forumUseCase.fs.SelectStats(&stats, _const.StatsTop); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, stats
+}
+
+func (forumUseCase RDBForumUseCase) Tags(slug string, viewer string) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if ok, err := canRead(forumUseCase.rs, forum, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	tags := &models.ForumTags{Tags: make([]string, 0)}
+	if err := forumUseCase.tgs.SelectAllowed(forum.Slug, &tags.Tags); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, tags
+}
+
+// SetTags -- уже проставленные темам теги не снимаются, ограничение действует на новые правки
+func (forumUseCase RDBForumUseCase) SetTags(slug string, change *models.ForumTags) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if ok, err := canRead(forumUseCase.rs, forum, change.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("forum not found")
+	}
+
+	if role, err := forumRole(forumUseCase.rs, forum.Slug, change.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !canModerate(role) {
+		return http.StatusForbidden, wrapStrError("only forum owner or moderators can configure tags")
+	}
+
+	tags, err := normalizeTags(change.Tags)
+	if err != nil {
+		return http.StatusBadRequest, wrapError(err)
+	}
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+
+	if err := forumUseCase.tgs.SetAllowed(forum.Slug, tags); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, &models.ForumTags{Tags: tags}
+}
+
+// Invite -- встречная просьба о вступлении сразу делает пользователя участником
+func (forumUseCase RDBForumUseCase) Invite(slug string, change *models.InviteChange) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if role, err := forumRole(forumUseCase.rs, forum.Slug, change.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !canModerate(role) {
+		if ok, err := canRead(forumUseCase.rs, forum, change.NickName); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		} else if !ok {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusForbidden, wrapStrError("only forum owner or moderators can invite")
+	}
+
+	user := &models.User{NickName: change.User}
+	if err := forumUseCase.us.SelectByNickname(user); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	role, err := forumRole(forumUseCase.rs, forum.Slug, user.NickName)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if role == models.RoleBanned {
+		return http.StatusForbidden, wrapStrError("user is banned in this forum")
+	}
+	if member, err := allHaveRole(forumUseCase.rs, forum.Slug, map[string]bool{user.NickName: true}, memberRoles); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if member {
+		return http.StatusConflict, wrapStrError("user is already a member")
+	}
+
+	invite := &models.ForumInvite{Forum: forum.Slug, User: user.NickName}
+	if err := forumUseCase.is.Select(invite); err == nil && invite.Kind == models.InviteRequest {
+		return forumUseCase.admit(invite)
+	} else if err != nil && err != pgx.ErrNoRows {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	invite.Kind, invite.InvitedBy = models.InviteByModerator, change.NickName
+	if err := forumUseCase.is.Upsert(invite); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusCreated, invite
+}
+
+// Join -- в публичный и read_only форум вступают сразу, в приватный -- по приглашению,
+// без приглашения остаётся просьба на рассмотрение модераторам
+func (forumUseCase RDBForumUseCase) Join(slug string, change *models.InviteChange) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	user := &models.User{NickName: change.NickName}
+	if err := forumUseCase.us.SelectByNickname(user); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	role := &models.ForumRole{Forum: forum.Slug, User: user.NickName}
+	if err := forumUseCase.rs.SelectRole(role); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if role.Role == models.RoleBanned {
+		return http.StatusForbidden, wrapStrError("user is banned in this forum")
+	}
+	if member, err := allHaveRole(forumUseCase.rs, forum.Slug, map[string]bool{user.NickName: true}, memberRoles); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if member {
+		return http.StatusOK, role
+	}
+
+	invite := &models.ForumInvite{Forum: forum.Slug, User: user.NickName}
+	if forum.Visibility != models.VisibilityPrivate {
+		return forumUseCase.admit(invite)
+	}
+
+	if err := forumUseCase.is.Select(invite); err == nil && invite.Kind == models.InviteByModerator {
+		return forumUseCase.admit(invite)
+	} else if err != nil && err != pgx.ErrNoRows {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	invite.Kind, invite.InvitedBy = models.InviteRequest, ""
+	if err := forumUseCase.is.Upsert(invite); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusAccepted, invite
+}
+
+// admit -- заявка исполнена: пользователь становится участником
+func (forumUseCase RDBForumUseCase) admit(invite *models.ForumInvite) (int, interface{}) {
+	if err := forumUseCase.rs.AddMember(invite.Forum, invite.User); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if err := forumUseCase.is.Delete(invite); err != nil && err != pgx.ErrNoRows {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	role := &models.ForumRole{Forum: invite.Forum, User: invite.User}
+	if err := forumUseCase.rs.SelectRole(role); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, role
+}
+
+func (forumUseCase RDBForumUseCase) Invites(slug string, viewer string) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if role, err := forumRole(forumUseCase.rs, forum.Slug, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !canModerate(role) {
+		if ok, err := canRead(forumUseCase.rs, forum, viewer); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		} else if !ok {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusForbidden, wrapStrError("only forum owner or moderators can see invites")
+	}
+
+	invites := make([]models.ForumInvite, 0, _const.BuffSize)
+	if err := forumUseCase.is.SelectByForum(&invites, forum.Slug); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, invites
+}
+
+// CancelInvite -- отзыв приглашения модератором, отклонение просьбы или отказ самого пользователя
+func (forumUseCase RDBForumUseCase) CancelInvite(slug string, change *models.InviteChange) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := forumUseCase.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if !strings.EqualFold(change.NickName, change.User) {
+		if role, err := forumRole(forumUseCase.rs, forum.Slug, change.NickName); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		} else if !canModerate(role) {
+			if ok, err := canRead(forumUseCase.rs, forum, change.NickName); err != nil {
+				return http.StatusInternalServerError, wrapError(err)
+			} else if !ok {
+				return http.StatusNotFound, wrapStrError("forum not found")
+			}
+			return http.StatusForbidden, wrapStrError("only forum owner or moderators can cancel invites")
+		}
+	}
+
+	invite := &models.ForumInvite{Forum: forum.Slug, User: change.User}
+	if err := forumUseCase.is.Delete(invite); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("invite not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, invite
+}
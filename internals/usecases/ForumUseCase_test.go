@@ -0,0 +1,374 @@
+package usecases
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ApTyp5/new_db_techno/internals/models"
+)
+
+// forumThreads -- id тем обычной выдачи /forum/{slug}/threads
+func (f *fixture) forumThreads(slug string, limit int, since string, desc bool, viewer string) []int {
+	f.t.Helper()
+	resp := f.expect(http.StatusOK)(f.forums.Threads(slug, limit, since, desc, viewer, "", "", "", ""))
+	threads := *resp.(*[]models.Thread)
+	result := make([]int, 0, len(threads))
+	for i := range threads {
+		result = append(result, threads[i].Id)
+	}
+	return result
+}
+
+func TestThreadModerationAndPinnedPages(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	threads := make([]*models.Thread, 0)
+	for i := 0; i < 4; i++ {
+		threads = append(threads, f.thread(models.Thread{Forum: "f", Author: "bob",
+			Created: start.Add(time.Duration(i) * time.Minute)}))
+	}
+
+	yes := true
+	f.expect(http.StatusForbidden)(f.threads.Moderate(&models.Thread{Id: threads[2].Id},
+		&models.ThreadModeration{NickName: "bob", Pinned: &yes}))
+	f.expect(http.StatusOK)(f.threads.Moderate(&models.Thread{Id: threads[2].Id},
+		&models.ThreadModeration{NickName: "alice", Pinned: &yes}))
+
+	// закреплённая тема первой, страницы по since её не повторяют
+	if got := f.forumThreads("f", 2, "", false, ""); !sameInts(got, threads[2].Id, threads[0].Id) {
+		t.Fatalf("first page %v", got)
+	}
+	if got := f.forumThreads("f", 2, threads[0].Created.Format(time.RFC3339Nano), false, ""); !sameInts(got,
+		threads[0].Id, threads[1].Id) {
+		t.Fatalf("second page %v", got)
+	}
+
+	// страница, закончившаяся на закреплённой теме, продолжается незакреплёнными
+	if got := f.forumThreads("f", 10, threads[2].Created.Format(time.RFC3339Nano), false, ""); !sameInts(got,
+		threads[2].Id, threads[0].Id, threads[1].Id, threads[3].Id) {
+		t.Fatalf("after pinned %v", got)
+	}
+
+	// since не от темы выдачи -- фильтр по времени, закреплённые подходящие темы остаются
+	if got := f.forumThreads("f", 10, start.Add(90*time.Second).Format(time.RFC3339Nano), false, ""); !sameInts(got,
+		threads[2].Id, threads[3].Id) {
+		t.Fatalf("time filter %v", got)
+	}
+
+	f.expect(http.StatusOK)(f.threads.Moderate(&models.Thread{Id: threads[1].Id},
+		&models.ThreadModeration{NickName: "alice", Locked: &yes}))
+	f.expect(http.StatusForbidden)(f.threads.AddPosts(&models.Thread{Id: threads[1].Id},
+		[]models.Post{{Author: "bob", Message: "post"}}))
+
+	f.expect(http.StatusOK)(f.threads.Moderate(&models.Thread{Id: threads[0].Id},
+		&models.ThreadModeration{NickName: "alice", Closed: &yes, Reason: "done"}))
+	f.expect(http.StatusForbidden)(f.threads.Vote(&models.Thread{Id: threads[0].Id},
+		&models.Vote{NickName: "bob", Voice: 1}))
+}
+
+func TestForumRolesAndBans(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol", "dave")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+
+	grant := func(actor string, user string, role string, expires *time.Time) (int, interface{}) {
+		return f.forums.GrantRole("f", &models.RoleChange{NickName: actor,
+			ForumRole: models.ForumRole{User: user, Role: role, Expires: expires}})
+	}
+
+	// модераторов назначает только владелец
+	f.expect(http.StatusForbidden)(grant("bob", "carol", models.RoleModerator, nil))
+	f.expect(http.StatusOK)(grant("alice", "bob", models.RoleModerator, nil))
+	f.expect(http.StatusForbidden)(grant("bob", "carol", models.RoleModerator, nil))
+	f.expect(http.StatusForbidden)(grant("bob", "alice", models.RoleBanned, nil))
+	f.expect(http.StatusBadRequest)(grant("alice", "carol", models.RoleOwner, nil))
+
+	f.expect(http.StatusOK)(grant("bob", "carol", models.RoleBanned, nil))
+	f.expect(http.StatusForbidden)(f.threads.AddPosts(&models.Thread{Id: thread.Id},
+		[]models.Post{{Author: "carol", Message: "post"}}))
+	f.expect(http.StatusForbidden)(f.threads.Vote(&models.Thread{Id: thread.Id}, &models.Vote{NickName: "carol", Voice: 1}))
+	f.expect(http.StatusForbidden)(f.forums.CreateThread(&models.Thread{Id: -1, Forum: "f", Author: "carol",
+		Title: "t", Message: "m", Created: time.Now()}))
+
+	// истёкший бан не действует
+	expired := time.Now().Add(-time.Minute)
+	f.expect(http.StatusOK)(grant("bob", "dave", models.RoleBanned, &expired))
+	f.post(thread, "dave", 0, "post")
+
+	users := func(role string) []string {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.forums.Users("f", 10, "", false, role, ""))
+		nicks := make([]string, 0)
+		for _, user := range *resp.(*[]models.User) {
+			nicks = append(nicks, user.NickName)
+		}
+		return nicks
+	}
+	if got := users(models.RoleModerator); len(got) != 1 || got[0] != "bob" {
+		t.Fatalf("moderators %v", got)
+	}
+	if got := users(models.RoleBanned); len(got) != 1 || got[0] != "carol" {
+		t.Fatalf("banned %v", got)
+	}
+
+	f.expect(http.StatusOK)(f.forums.RevokeRole("f", &models.RoleChange{NickName: "bob",
+		ForumRole: models.ForumRole{User: "carol"}}))
+	f.post(thread, "carol", 0, "post")
+}
+
+// statsTotals -- суммы почасовой статистики форума за последние сутки
+func (f *fixture) statsTotals(slug string) models.StatsBucket {
+	f.t.Helper()
+	to := time.Now().Add(time.Hour).Format(time.RFC3339)
+	from := time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
+	stats := f.expect(http.StatusOK)(f.forums.Stats(slug, from, to, "hour", "")).(models.ForumStats)
+
+	total := models.StatsBucket{}
+	for _, bucket := range stats.Series {
+		total.Posts += bucket.Posts
+		total.Threads += bucket.Threads
+		total.Participants += bucket.Participants
+	}
+	return total
+}
+
+func TestForumStatsFollowThreads(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	f.forum(models.Forum{Slug: "g", User: "alice"})
+
+	created := time.Now().Add(-3 * time.Hour)
+	thread := f.thread(models.Thread{Forum: "f", Author: "bob", Created: created})
+	first := f.post(thread, "carol", 0, "first")
+	f.post(thread, "carol", 0, "second")
+
+	// участник считается в час своей первой темы, а не в момент записи
+	stats := f.expect(http.StatusOK)(f.forums.Stats("f", created.Add(-time.Hour).Format(time.RFC3339),
+		created.Add(time.Hour).Format(time.RFC3339), "hour", "")).(models.ForumStats)
+	participants := 0
+	for _, bucket := range stats.Series {
+		participants += bucket.Participants
+	}
+	if participants != 1 {
+		t.Fatalf("participants around thread creation %+v", stats.Series)
+	}
+
+	if got := f.statsTotals("f"); got != (models.StatsBucket{Posts: 2, Threads: 1, Participants: 2}) {
+		t.Fatalf("f before move %+v", got)
+	}
+
+	f.expect(http.StatusOK)(f.threads.Move(&models.Thread{Id: thread.Id},
+		&models.ThreadMove{NickName: "alice", Forum: "g"}))
+	if got := f.statsTotals("f"); got != (models.StatsBucket{}) {
+		t.Fatalf("f after move %+v", got)
+	}
+	if got := f.statsTotals("g"); got != (models.StatsBucket{Posts: 2, Threads: 1, Participants: 2}) {
+		t.Fatalf("g after move %+v", got)
+	}
+
+	f.expect(http.StatusCreated)(f.posts.Split(&models.Post{Id: first.Id},
+		&models.ThreadSplit{NickName: "alice", Title: "split", Forum: "f"}))
+	if got := f.statsTotals("f"); got != (models.StatsBucket{Posts: 1, Threads: 1, Participants: 1}) {
+		t.Fatalf("f after split %+v", got)
+	}
+	if got := f.statsTotals("g"); got != (models.StatsBucket{Posts: 1, Threads: 1, Participants: 2}) {
+		t.Fatalf("g after split %+v", got)
+	}
+}
+
+func TestSubForumTree(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob")
+	f.forum(models.Forum{Slug: "a", User: "alice"})
+	f.forum(models.Forum{Slug: "b", User: "alice", Parent: "A"})
+	f.forum(models.Forum{Slug: "c", User: "alice", Parent: "b"})
+	f.forum(models.Forum{Slug: "d", User: "alice", Parent: "a"})
+
+	f.expect(http.StatusNotFound)(f.forums.Create(&models.Forum{Slug: "e", Title: "e", User: "alice", Parent: "none"}))
+	f.expect(http.StatusBadRequest)(f.forums.Create(&models.Forum{Slug: "e", Title: "e", User: "alice", Parent: "E"}))
+
+	// цикл через уже существующих потомков отвергает триггер
+	if _, err := f.db.Exec("update forums set parent = 'c' where slug = 'a'"); err == nil {
+		t.Fatal("cycle accepted")
+	}
+
+	inB := f.thread(models.Thread{Forum: "b", Author: "alice"})
+	f.addPosts(inB, models.Post{Author: "bob", Message: "1"}, models.Post{Author: "bob", Message: "2"})
+	inC := f.thread(models.Thread{Forum: "c", Author: "alice"})
+	f.post(inC, "bob", 0, "3")
+
+	children := f.expect(http.StatusOK)(f.forums.Children("a", "")).([]models.Forum)
+	if len(children) != 2 || children[0].Slug != "b" || children[1].Slug != "d" || children[0].Parent != "a" {
+		t.Fatalf("children %+v", children)
+	}
+
+	root := f.expect(http.StatusOK)(f.forums.Details("a", "")).(*models.Forum)
+	if root.SubtreeThreads != 2 || root.SubtreePosts != 3 || root.Threads != 0 {
+		t.Fatalf("root %+v", root)
+	}
+	leaf := f.expect(http.StatusOK)(f.forums.Details("c", "")).(*models.Forum)
+	crumbs := make([]string, 0, len(leaf.Breadcrumb))
+	for _, crumb := range leaf.Breadcrumb {
+		crumbs = append(crumbs, crumb.Slug)
+	}
+	if len(crumbs) != 3 || crumbs[0] != "a" || crumbs[1] != "b" || crumbs[2] != "c" {
+		t.Fatalf("breadcrumb %v", crumbs)
+	}
+	if leaf.SubtreeThreads != 1 || leaf.SubtreePosts != 1 {
+		t.Fatalf("leaf %+v", leaf)
+	}
+}
+
+func TestPrivateForumVisibility(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	f.forum(models.Forum{Slug: "fc", User: "alice", Parent: "f"})
+	f.forum(models.Forum{Slug: "fp", User: "alice", Parent: "f", Visibility: models.VisibilityPrivate})
+	f.forum(models.Forum{Slug: "p", User: "alice", Visibility: models.VisibilityPrivate})
+	f.expect(http.StatusOK)(f.forums.GrantRole("p", &models.RoleChange{NickName: "alice",
+		ForumRole: models.ForumRole{User: "bob", Role: models.RoleMember}}))
+
+	open := f.thread(models.Thread{Forum: "f", Author: "alice", Tags: []string{"open"}})
+	secret := f.thread(models.Thread{Forum: "p", Author: "bob", Tags: []string{"secret"},
+		Poll: &models.Poll{Question: "?", Options: []models.PollOption{{Text: "yes"}, {Text: "no"}}}})
+	post := f.post(secret, "bob", 0, "hi @carol")
+	moved := f.thread(models.Thread{Forum: "f", Author: "alice", Title: "moved"})
+	f.expect(http.StatusOK)(f.threads.Move(&models.Thread{Id: moved.Id},
+		&models.ThreadMove{NickName: "alice", Forum: "p"}))
+
+	hot := func(viewer string) map[int]bool {
+		t.Helper()
+		threads := f.expect(http.StatusOK)(f.threads.Hot(10, 0, "", "", viewer)).([]models.Thread)
+		result := make(map[int]bool)
+		for i := range threads {
+			result[threads[i].Id] = true
+		}
+		return result
+	}
+	if got := hot("carol"); !got[open.Id] || got[secret.Id] || got[moved.Id] {
+		t.Fatalf("outsider hot %v", got)
+	}
+	if got := hot("bob"); !got[secret.Id] || !got[moved.Id] {
+		t.Fatalf("member hot %v", got)
+	}
+
+	// чужой закрытый форум не отличить от несуществующего
+	f.expect(http.StatusNotFound)(f.forums.Stats("p", "", "", "", "carol"))
+	f.expect(http.StatusOK)(f.forums.Stats("p", "", "", "", "bob"))
+	f.expect(http.StatusNotFound)(f.forums.Tags("p", "carol"))
+	f.expect(http.StatusOK)(f.forums.Tags("p", "bob"))
+	f.expect(http.StatusNotFound)(f.forums.Children("p", "carol"))
+	if children := f.expect(http.StatusOK)(f.forums.Children("f", "carol")).([]models.Forum); len(children) != 1 ||
+		children[0].Slug != "fc" {
+		t.Fatalf("outsider children %+v", children)
+	}
+	if children := f.expect(http.StatusOK)(f.forums.Children("f", "alice")).([]models.Forum); len(children) != 2 {
+		t.Fatalf("owner children %+v", children)
+	}
+
+	hasTag := func(viewer string, tag string) bool {
+		t.Helper()
+		for _, count := range f.expect(http.StatusOK)(f.threads.Tags("", 10, viewer)).([]models.TagCount) {
+			if count.Tag == tag {
+				return true
+			}
+		}
+		return false
+	}
+	if hasTag("carol", "secret") || !hasTag("carol", "open") || !hasTag("bob", "secret") {
+		t.Fatal("tag counts leak private threads")
+	}
+	f.expect(http.StatusNotFound)(f.threads.Tags("p", 10, "carol"))
+
+	bob := &models.User{NickName: "bob"}
+	if posts := f.expect(http.StatusOK)(f.users.Posts(bob, "", "carol", 0, 0, false)).([]models.Post); len(posts) != 0 {
+		t.Fatalf("outsider sees posts %+v", posts)
+	}
+	if posts := f.expect(http.StatusOK)(f.users.Posts(bob, "", "bob", 0, 0, false)).([]models.Post); len(posts) != 1 {
+		t.Fatalf("member posts %+v", posts)
+	}
+	if threads := f.expect(http.StatusOK)(f.users.Threads(bob, "", "carol", 0, 0, false)).([]models.Thread); len(threads) != 0 {
+		t.Fatalf("outsider sees threads %+v", threads)
+	}
+	if stats := f.expect(http.StatusOK)(f.users.Stats(bob, "carol")).(models.UserStats); stats.Posts != 0 ||
+		stats.Threads != 0 || len(stats.Forums) != 0 {
+		t.Fatalf("outsider stats %+v", stats)
+	}
+	if stats := f.expect(http.StatusOK)(f.users.Stats(bob, "bob")).(models.UserStats); stats.Posts != 1 ||
+		stats.Threads != 1 {
+		t.Fatalf("member stats %+v", stats)
+	}
+
+	// голосовать, подписываться и смотреть голоса может только участник
+	f.expect(http.StatusNotFound)(f.threads.Votes(&models.Thread{Id: secret.Id}, 10, "", false, "carol"))
+	f.expect(http.StatusNotFound)(f.threads.Vote(&models.Thread{Id: secret.Id}, &models.Vote{NickName: "carol", Voice: 1}))
+	f.expect(http.StatusNotFound)(f.threads.GetVote(&models.Thread{Id: secret.Id}, &models.Vote{NickName: "carol"}))
+	f.expect(http.StatusNotFound)(f.threads.PollVote(&models.Thread{Id: secret.Id},
+		&models.PollVote{NickName: "carol", Options: []int{secret.Poll.Options[0].Id}}))
+	f.expect(http.StatusNotFound)(f.posts.Vote(&models.Post{Id: post.Id}, &models.Vote{NickName: "carol", Voice: 1}))
+	f.expect(http.StatusNotFound)(f.posts.Vote(&models.Post{Id: post.Id}, &models.Vote{NickName: "carol", Reaction: "+1"}))
+	f.expect(http.StatusNotFound)(f.threads.Subscribe(&models.Thread{Id: secret.Id}, &models.Subscription{NickName: "carol"}))
+	f.expect(http.StatusNotFound)(f.forums.Subscribe("p", &models.Subscription{NickName: "carol"}))
+	f.expect(http.StatusOK)(f.threads.Vote(&models.Thread{Id: secret.Id}, &models.Vote{NickName: "bob", Voice: 1}))
+	f.expect(http.StatusOK)(f.threads.Votes(&models.Thread{Id: secret.Id}, 10, "", false, "bob"))
+	f.expect(http.StatusOK)(f.posts.Vote(&models.Post{Id: post.Id}, &models.Vote{NickName: "bob", Voice: 1}))
+	f.expect(http.StatusNotFound)(f.posts.Unvote(&models.Post{Id: post.Id}, &models.Vote{NickName: "carol"}))
+	f.expect(http.StatusNotFound)(f.threads.Read(&models.Thread{Id: secret.Id},
+		&models.ThreadRead{NickName: "carol", Post: post.Id}))
+	f.expect(http.StatusNotFound)(f.threads.Accept(&models.Thread{Id: secret.Id},
+		&models.ThreadAccept{NickName: "carol", Post: post.Id}))
+	f.expect(http.StatusConflict)(f.threads.Accept(&models.Thread{Id: secret.Id},
+		&models.ThreadAccept{NickName: "bob", Post: post.Id}))
+
+	// настройки закрытого форума чужим не видны, и на правку им тоже 404, а не 403
+	f.expect(http.StatusNotFound)(f.forums.Filters("p", "carol"))
+	f.expect(http.StatusOK)(f.forums.Filters("p", "bob"))
+	f.expect(http.StatusNotFound)(f.forums.SetFilters("p", &models.FilterChange{NickName: "carol"}))
+	f.expect(http.StatusForbidden)(f.forums.SetFilters("p", &models.FilterChange{NickName: "bob"}))
+	f.expect(http.StatusNotFound)(f.forums.SetTags("p", &models.ForumTags{NickName: "carol", Tags: []string{"x"}}))
+	f.expect(http.StatusNotFound)(f.forums.GrantRole("p", &models.RoleChange{NickName: "carol",
+		ForumRole: models.ForumRole{User: "carol", Role: models.RoleMember}}))
+	f.expect(http.StatusNotFound)(f.forums.RevokeRole("p", &models.RoleChange{NickName: "carol",
+		ForumRole: models.ForumRole{User: "bob"}}))
+
+	if inbox := f.mentions("carol", 0, 0, false); len(inbox) != 0 {
+		t.Fatalf("mention from a private forum %+v", inbox)
+	}
+
+	// заглушка перенесённой в закрытый форум темы не выдаёт заголовок
+	stubTitle := func(viewer string) string {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.forums.Threads("f", 10, "", false, viewer, "", "", "", ""))
+		for _, thread := range *resp.(*[]models.Thread) {
+			if thread.Id == moved.Id {
+				return thread.Title
+			}
+		}
+		t.Fatal("no moved stub")
+		return ""
+	}
+	if title := stubTitle("carol"); title != "" {
+		t.Fatalf("outsider sees stub title %q", title)
+	}
+	if title := stubTitle("bob"); title != "moved" {
+		t.Fatalf("member stub title %q", title)
+	}
+
+	// после исключения из форума его посты пропадают из ленты
+	f.post(secret, "alice", 0, "reply")
+	if items := f.feed("bob", "", 10).Items; len(items) == 0 {
+		t.Fatal("member feed is empty")
+	}
+	f.expect(http.StatusOK)(f.forums.RevokeRole("p", &models.RoleChange{NickName: "alice",
+		ForumRole: models.ForumRole{User: "bob"}}))
+	if items := f.feed("bob", "", 10).Items; len(items) != 0 {
+		t.Fatalf("former member feed %+v", items)
+	}
+}
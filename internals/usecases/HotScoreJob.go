@@ -0,0 +1,34 @@
+package usecases
+
+import (
+	"github.com/ApTyp5/new_db_techno/internals/repositories"
+	"github.com/ApTyp5/new_db_techno/logs"
+	"github.com/jackc/pgx"
+	"time"
+)
+
+// HotScoreJob -- фоновый пересчёт hot_score тем для sort=hot
+type HotScoreJob struct {
+	ts       repositories.ThreadRepo
+	halfLife time.Duration
+}
+
+func CreateHotScoreJob(db *pgx.ConnPool, halfLife time.Duration) HotScoreJob {
+	return HotScoreJob{
+		ts:       repositories.CreatePSQLThreadRepo(db),
+		halfLife: halfLife,
+	}
+}
+
+// Run -- пересчитывает сразу и затем каждые every; ошибка одного прохода не останавливает задачу
+func (job HotScoreJob) Run(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if _, err := job.ts.RecomputeHot(job.halfLife); err != nil {
+			logs.Error(err)
+		}
+		<-ticker.C
+	}
+}
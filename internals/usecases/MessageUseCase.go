@@ -0,0 +1,216 @@
+package usecases
+
+import (
+	_const "github.com/ApTyp5/new_db_techno/const"
+	"github.com/ApTyp5/new_db_techno/internals/markup"
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/ApTyp5/new_db_techno/internals/repositories"
+	"github.com/jackc/pgx"
+	"net/http"
+	"strings"
+)
+
+type MessageUseCase interface {
+	Send(message *models.DirectMessage) (int, interface{}) // /messages
+	// /user/{nickname}/conversations, свои беседы видит только сам пользователь
+	Conversations(user *models.User, viewer string, since int, limit int) (int, interface{})
+	// /conversation/{id}/messages, viewer должен быть участником
+	Messages(conv *models.Conversation, viewer string, since int, limit int, desc bool) (int, interface{})
+	Block(block *models.UserBlock) (int, interface{})   // /user/{nickname}/block
+	Unblock(block *models.UserBlock) (int, interface{}) // /user/{nickname}/block
+}
+
+type RDBMessageUseCase struct {
+	ms repositories.MessageRepo
+	bs repositories.BlockRepo
+	us repositories.UserRepo
+}
+
+func CreateRDBMessageUseCase(db *pgx.ConnPool) MessageUseCase {
+	return RDBMessageUseCase{
+		ms: repositories.CreatePSQLMessageRepo(db),
+		bs: repositories.CreatePSQLBlockRepo(db),
+		us: repositories.CreatePSQLUserRepo(db),
+	}
+}
+
+// Send -- первое сообщение создаёт беседу по составу To, повторное с тем же составом попадает в неё же
+func (uc RDBMessageUseCase) Send(message *models.DirectMessage) (int, interface{}) {
+	if strings.TrimSpace(message.Message) == "" {
+		return http.StatusBadRequest, wrapStrError("message is required")
+	}
+
+	author := &models.User{NickName: message.Author}
+	if err := uc.us.SelectByNickname(author); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	message.Author = author.NickName
+
+	conv := &models.Conversation{Id: message.Conversation}
+	if conv.Id > 0 {
+		if err := uc.ms.SelectConversation(conv); err != nil {
+			if err == pgx.ErrNoRows {
+				return http.StatusNotFound, wrapStrError("conversation not found")
+			}
+			return http.StatusInternalServerError, wrapError(err)
+		}
+		if !isMember(conv, message.Author) {
+			return http.StatusNotFound, wrapStrError("conversation not found")
+		}
+	} else {
+		if len(message.To) == 0 {
+			return http.StatusBadRequest, wrapStrError("recipients or conversation are required")
+		}
+
+		nicks := map[string]bool{strings.ToLower(message.Author): true}
+		conv.Members = []string{message.Author}
+		for _, nick := range message.To {
+			if !nicks[strings.ToLower(nick)] {
+				nicks[strings.ToLower(nick)] = true
+				conv.Members = append(conv.Members, nick)
+			}
+		}
+
+		if len(conv.Members) < 2 {
+			return http.StatusBadRequest, wrapStrError("can't send a message to yourself")
+		}
+		if len(conv.Members) > _const.MaxConversationMembers {
+			return http.StatusBadRequest, wrapStrError("too many recipients")
+		}
+		if err := uc.us.CheckExistance(nicks); err != nil {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+
+		if err := uc.ms.FindOrCreate(conv); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+	}
+
+	var blocking string
+	if err := uc.bs.SelectBlocking(message.Author, conv.Members, &blocking); err == nil {
+		return http.StatusForbidden, wrapStrError(blocking + " doesn't accept messages from " + message.Author)
+	} else if err != pgx.ErrNoRows {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	html, err := markup.Render(message.Message)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	message.MessageHTML = html
+
+	message.Conversation, message.To = conv.Id, nil
+	if err := uc.ms.Insert(message); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusCreated, message
+}
+
+func (uc RDBMessageUseCase) Conversations(user *models.User, viewer string, since int, limit int) (int, interface{}) {
+	if !strings.EqualFold(user.NickName, viewer) {
+		return http.StatusForbidden, wrapStrError("conversations are visible only to their owner")
+	}
+
+	if err := uc.us.SelectByNickname(user); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if limit <= 0 {
+		limit = _const.MessagesPage
+	}
+
+	convs := models.Conversations{Conversations: make([]models.Conversation, 0, limit)}
+	if err := uc.ms.SelectByUser(&convs, user.NickName, since, limit); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, convs
+}
+
+// Messages -- чтение страницы отмечает её прочитанной для viewer;
+// чужому пользователю беседа не видна
+func (uc RDBMessageUseCase) Messages(conv *models.Conversation, viewer string, since int, limit int,
+	desc bool) (int, interface{}) {
+	if err := uc.ms.SelectConversation(conv); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("conversation not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if !isMember(conv, viewer) {
+		return http.StatusNotFound, wrapStrError("conversation not found")
+	}
+
+	if limit <= 0 {
+		limit = _const.MessagesPage
+	}
+
+	messages := models.DirectMessages{Messages: make([]models.DirectMessage, 0, limit)}
+	if err := uc.ms.SelectByConversation(&messages, conv.Id, since, limit, desc); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	last := 0
+	for i := range messages.Messages {
+		if messages.Messages[i].Id > last {
+			last = messages.Messages[i].Id
+		}
+	}
+	if last > 0 {
+		if err := uc.ms.MarkRead(conv.Id, viewer, last); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+	}
+
+	return http.StatusOK, messages
+}
+
+func (uc RDBMessageUseCase) Block(block *models.UserBlock) (int, interface{}) {
+	if strings.EqualFold(block.NickName, block.User) {
+		return http.StatusBadRequest, wrapStrError("can't block yourself")
+	}
+
+	switch block.Kind {
+	case "":
+		block.Kind = models.BlockFull
+	case models.BlockFull, models.BlockMute:
+	default:
+		return http.StatusBadRequest, wrapStrError("kind must be block or mute")
+	}
+
+	if err := uc.bs.Insert(block); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, block
+}
+
+func (uc RDBMessageUseCase) Unblock(block *models.UserBlock) (int, interface{}) {
+	if err := uc.bs.Delete(block); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("block not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, block
+}
+
+func isMember(conv *models.Conversation, nick string) bool {
+	for _, member := range conv.Members {
+		if strings.EqualFold(member, nick) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package usecases
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ApTyp5/new_db_techno/internals/models"
+)
+
+func TestConversationsAndReceipts(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+
+	send := func(message models.DirectMessage) *models.DirectMessage {
+		t.Helper()
+		return f.expect(http.StatusCreated)(f.msgs.Send(&message)).(*models.DirectMessage)
+	}
+	first := send(models.DirectMessage{Author: "alice", To: []string{"BOB"}, Message: "hi"})
+	// тот же состав -- та же беседа
+	if again := send(models.DirectMessage{Author: "bob", To: []string{"alice"}, Message: "hello"}); again.Conversation != first.Conversation {
+		t.Fatalf("conversation %d, want %d", again.Conversation, first.Conversation)
+	}
+
+	conversations := func(nick string, viewer string) []models.Conversation {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.msgs.Conversations(&models.User{NickName: nick}, viewer, 0, 0))
+		return resp.(models.Conversations).Conversations
+	}
+	convs := conversations("alice", "ALICE")
+	if len(convs) != 1 || convs[0].Unread != 1 || convs[0].LastMessage.Author != "bob" {
+		t.Fatalf("conversations %+v", convs)
+	}
+
+	// чужие беседы не видны ни другому пользователю, ни без viewer
+	f.expect(http.StatusForbidden)(f.msgs.Conversations(&models.User{NickName: "alice"}, "bob", 0, 0))
+	f.expect(http.StatusForbidden)(f.msgs.Conversations(&models.User{NickName: "alice"}, "", 0, 0))
+	f.expect(http.StatusNotFound)(f.msgs.Conversations(&models.User{NickName: "nobody"}, "nobody", 0, 0))
+
+	conv := &models.Conversation{Id: first.Conversation}
+	f.expect(http.StatusNotFound)(f.msgs.Messages(conv, "carol", 0, 0, false))
+	f.expect(http.StatusNotFound)(f.msgs.Send(&models.DirectMessage{Author: "carol", Conversation: first.Conversation,
+		Message: "let me in"}))
+
+	page := f.expect(http.StatusOK)(f.msgs.Messages(conv, "alice", 0, 0, false)).(models.DirectMessages)
+	if len(page.Messages) != 2 || page.Messages[0].Id != first.Id {
+		t.Fatalf("messages %+v", page.Messages)
+	}
+	if convs := conversations("alice", "alice"); convs[0].Unread != 0 {
+		t.Fatalf("unread after reading %+v", convs[0])
+	}
+	if convs := conversations("bob", "bob"); len(convs[0].LastMessage.ReadBy) != 1 || convs[0].LastMessage.ReadBy[0] != "alice" {
+		t.Fatalf("read receipts %+v", convs[0].LastMessage)
+	}
+
+	f.expect(http.StatusOK)(f.msgs.Block(&models.UserBlock{NickName: "bob", User: "alice"}))
+	f.expect(http.StatusForbidden)(f.msgs.Send(&models.DirectMessage{Author: "alice", To: []string{"bob"}, Message: "?"}))
+}
@@ -1,16 +1,29 @@
 package usecases
 
 import (
+	_const "github.com/ApTyp5/new_db_techno/const"
+	"github.com/ApTyp5/new_db_techno/internals/markup"
 	"github.com/ApTyp5/new_db_techno/internals/models"
 	"github.com/ApTyp5/new_db_techno/internals/repositories"
 	"github.com/jackc/pgx"
 	"github.com/pkg/errors"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
+// maxReactionLen -- ограничение на длину реакции в байтах (несколько составных эмодзи)
+const maxReactionLen = 32
+
 type PostUseCase interface {
-	Details(postFull *models.PostFull, related []string) (int, interface{}) // /post/{id}/details
-	Edit(post *models.Post) (int, interface{})                              // /post/{id}/details
+	// /post/{id}/details
+	Details(postFull *models.PostFull, related []string, viewer string) (int, interface{})
+	Edit(post *models.Post) (int, interface{}) // /post/{id}/details
+	// /post/{id}/replies
+	Replies(post *models.Post, cursor string, limit int, viewer string) (int, interface{})
+	Vote(post *models.Post, vote *models.Vote) (int, interface{})          // /post/{id}/vote
+	Unvote(post *models.Post, vote *models.Vote) (int, interface{})        // /post/{id}/vote
+	Split(post *models.Post, split *models.ThreadSplit) (int, interface{}) // /post/{id}/split
 }
 
 type RDBPostUseCase struct {
@@ -18,6 +31,9 @@ type RDBPostUseCase struct {
 	us repositories.UserRepo
 	fs repositories.ForumRepo
 	ts repositories.ThreadRepo
+	vs repositories.VoteRepo
+	rs repositories.RoleRepo
+	bs repositories.BlockRepo
 }
 
 func CreateRDBPostUseCase(db *pgx.ConnPool) PostUseCase {
@@ -26,15 +42,22 @@ func CreateRDBPostUseCase(db *pgx.ConnPool) PostUseCase {
 		us: repositories.CreatePSQLUserRepo(db),
 		fs: repositories.CreatePSQLForumRepo(db),
 		ts: repositories.CreatePSQLThreadRepo(db),
+		vs: repositories.CreatePSQLVoteRepo(db),
+		rs: repositories.CreatePSQLRoleRepo(db),
+		bs: repositories.CreatePSQLBlockRepo(db),
 	}
 }
 
-func (uc RDBPostUseCase) Details(postFull *models.PostFull, related []string) (int, interface{}) {
+func (uc RDBPostUseCase) Details(postFull *models.PostFull, related []string, viewer string) (int, interface{}) {
 
 	if err := uc.ps.SelectById(postFull.Post); err != nil {
 		return http.StatusNotFound, wrapStrError("post not found")
 	}
 
+	if status, resp := checkVisible(uc.fs, uc.rs, postFull.Post.Forum, viewer, "post not found"); resp != nil {
+		return status, resp
+	}
+
 	for _, str := range related {
 		switch str {
 		case "user":
@@ -58,10 +81,29 @@ func (uc RDBPostUseCase) Details(postFull *models.PostFull, related []string) (i
 		}
 	}
 
+	muted, err := mutedBy(uc.bs, viewer)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if muted[strings.ToLower(postFull.Post.Author)] {
+		collapsePost(postFull.Post)
+	}
+	if postFull.Thread != nil && muted[strings.ToLower(postFull.Thread.Author)] {
+		collapseThread(postFull.Thread)
+	}
+
 	return http.StatusOK, postFull
 }
 
 func (uc RDBPostUseCase) Edit(post *models.Post) (int, interface{}) {
+	if post.Message != "" {
+		html, err := markup.Render(post.Message)
+		if err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+		post.MessageHTML = html
+	}
+
 	if err := uc.ps.UpdateById(post); err == pgx.ErrNoRows {
 		return http.StatusNotFound, wrapStrError("post not found")
 	} else if err != nil {
@@ -70,3 +112,168 @@ func (uc RDBPostUseCase) Edit(post *models.Post) (int, interface{}) {
 
 	return http.StatusOK, post
 }
+
+func (uc RDBPostUseCase) Replies(post *models.Post, cursor string, limit int, viewer string) (int, interface{}) {
+	after := 0
+	if cursor != "" {
+		var err error
+		if after, err = strconv.Atoi(cursor); err != nil || after <= 0 {
+			return http.StatusBadRequest, wrapStrError("invalid cursor")
+		}
+	}
+
+	if err := uc.ps.SelectById(post); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("post not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, post.Forum, viewer, "post not found"); resp != nil {
+		return status, resp
+	}
+
+	if limit <= 0 {
+		limit = _const.RepliesPage
+	}
+
+	replies := models.Replies{Posts: make([]models.Post, 0, limit)}
+	if err := uc.ps.SelectReplies(&replies, post, after, limit); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	muted, err := mutedBy(uc.bs, viewer)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	collapseMuted(replies.Posts, muted)
+
+	return http.StatusOK, replies
+}
+
+func (uc RDBPostUseCase) Vote(post *models.Post, vote *models.Vote) (int, interface{}) {
+	if vote.Voice < -1 || vote.Voice > 1 {
+		return http.StatusBadRequest, wrapStrError("voice must be 1, -1 or 0 with a reaction")
+	}
+
+	if vote.Voice == 0 && vote.Reaction == "" {
+		return http.StatusBadRequest, wrapStrError("nothing to vote with")
+	}
+
+	if len(vote.Reaction) > maxReactionLen || strings.ContainsAny(vote.Reaction, " \t\n") {
+		return http.StatusBadRequest, wrapStrError("invalid reaction")
+	}
+
+	if err := uc.ps.SelectById(post); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user or post not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, post.Forum, vote.NickName, "user or post not found"); resp != nil {
+		return status, resp
+	}
+
+	if err := uc.vs.InsertOrUpdatePost(vote, post); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user or post not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, post
+}
+
+// Unvote -- снимает реакцию vote.Reaction, а без неё -- голос
+func (uc RDBPostUseCase) Unvote(post *models.Post, vote *models.Vote) (int, interface{}) {
+	if err := uc.ps.SelectById(post); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user or post not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, post.Forum, vote.NickName, "user or post not found"); resp != nil {
+		return status, resp
+	}
+
+	if err := uc.vs.DeletePost(vote, post); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user or post not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, post
+}
+
+// Split -- нужны права модератора в форуме темы и в форуме новой темы
+func (uc RDBPostUseCase) Split(post *models.Post, split *models.ThreadSplit) (int, interface{}) {
+	if split.Title == "" {
+		return http.StatusBadRequest, wrapStrError("title is required")
+	}
+
+	if err := uc.ps.SelectById(post); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("post not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	forum := &models.Forum{Slug: split.Forum}
+	if forum.Slug == "" {
+		forum.Slug = post.Forum
+	}
+	if err := uc.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	for _, slug := range []string{post.Forum, forum.Slug} {
+		if role, err := forumRole(uc.rs, slug, split.NickName); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		} else if !canModerate(role) {
+			return http.StatusForbidden, wrapStrError("only forum owner or moderators can split threads")
+		}
+	}
+
+	thread := &models.Thread{
+		Author:  post.Author,
+		Forum:   forum.Slug,
+		Title:   split.Title,
+		Slug:    split.Slug,
+		Message: split.Message,
+	}
+	if thread.Message == "" {
+		thread.Message = post.Message
+	}
+	// у скрытого поста текст не отдаётся, новой теме нужен свой
+	if thread.Message == "" {
+		return http.StatusBadRequest, wrapStrError("message is required to split a hidden post")
+	}
+
+	var err error
+	if thread.MessageHTML, err = markup.Render(thread.Message); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if err := uc.ts.Split(thread, post); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusConflict, wrapStrError("post was moved or deleted meanwhile")
+		}
+		// slug занят: отвечаем существующей темой, как при создании
+		if repositories.IsUniqueViolation(err) {
+			existing := &models.Thread{Id: -1, Slug: split.Slug}
+			if err := uc.ts.SelectBySlugOrId(existing); err != nil {
+				return http.StatusInternalServerError, wrapError(err)
+			}
+			return http.StatusConflict, existing
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusCreated, thread
+}
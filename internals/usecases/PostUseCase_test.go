@@ -0,0 +1,142 @@
+package usecases
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ApTyp5/new_db_techno/internals/models"
+)
+
+func TestRepliesCursor(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+
+	root := f.post(thread, "alice", 0, "root")
+	want := make([]int, 0)
+	for i := 0; i < 5; i++ {
+		want = append(want, f.post(thread, "bob", root.Id, "reply").Id)
+	}
+
+	got := make([]int, 0)
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("cursor does not end")
+		}
+		resp := f.expect(http.StatusOK)(f.posts.Replies(&models.Post{Id: root.Id}, cursor, 2, ""))
+		replies := resp.(models.Replies)
+		got = append(got, ids(replies.Posts)...)
+		if replies.Next == "" {
+			break
+		}
+		cursor = replies.Next
+	}
+
+	if !sameInts(got, want...) {
+		t.Fatalf("replies %v, want %v", got, want)
+	}
+
+	f.expect(http.StatusBadRequest)(f.posts.Replies(&models.Post{Id: root.Id}, "x", 2, ""))
+	f.expect(http.StatusNotFound)(f.posts.Replies(&models.Post{Id: root.Id + 100}, "", 2, ""))
+}
+
+func TestPostVotesAndReactions(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+	post := f.post(thread, "alice", 0, "post")
+
+	vote := func(nick string, voice int, reaction string) *models.Post {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.posts.Vote(&models.Post{Id: post.Id},
+			&models.Vote{NickName: nick, Voice: voice, Reaction: reaction}))
+		return resp.(*models.Post)
+	}
+	unvote := func(nick string, reaction string) *models.Post {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.posts.Unvote(&models.Post{Id: post.Id},
+			&models.Vote{NickName: nick, Reaction: reaction}))
+		return resp.(*models.Post)
+	}
+
+	vote("alice", 1, "👍")
+	if p := vote("bob", 1, "👍"); p.Votes != 2 || p.Reactions["👍"] != 2 {
+		t.Fatalf("after votes %+v", p)
+	}
+	if p := vote("bob", -1, ""); p.Votes != 0 {
+		t.Fatalf("changed vote %+v", p)
+	}
+
+	if p := unvote("bob", "👍"); p.Votes != 0 || p.Reactions["👍"] != 1 {
+		t.Fatalf("reaction removed %+v", p)
+	}
+	if p := unvote("alice", "👍"); len(p.Reactions) != 0 {
+		t.Fatalf("last reaction removed %+v", p)
+	}
+	if p := unvote("bob", ""); p.Votes != 1 {
+		t.Fatalf("vote removed %+v", p)
+	}
+	// повторное снятие ничего не меняет
+	if p := unvote("bob", ""); p.Votes != 1 {
+		t.Fatalf("vote removed twice %+v", p)
+	}
+
+	f.expect(http.StatusBadRequest)(f.posts.Vote(&models.Post{Id: post.Id}, &models.Vote{NickName: "bob", Voice: 2}))
+	f.expect(http.StatusNotFound)(f.posts.Vote(&models.Post{Id: post.Id}, &models.Vote{NickName: "nobody", Voice: 1}))
+}
+
+func TestSplitSlugConflictAndReports(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	f.forum(models.Forum{Slug: "g", User: "alice"})
+	taken := f.thread(models.Thread{Forum: "f", Author: "alice", Slug: "taken"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+	post := f.post(thread, "bob", 0, "off topic")
+	f.expect(http.StatusCreated)(f.reports.Create(&models.Report{Post: post.Id, NickName: "carol", Reason: "spam"}))
+
+	split := func(slug string) (int, interface{}) {
+		return f.posts.Split(&models.Post{Id: post.Id},
+			&models.ThreadSplit{NickName: "alice", Title: "split", Slug: slug, Forum: "g"})
+	}
+
+	// занятый slug откатывает всё деление и отдаёт существующую тему
+	if existing := f.expect(http.StatusConflict)(split("TAKEN")).(*models.Thread); existing.Id != taken.Id {
+		t.Fatalf("conflict with %+v", existing)
+	}
+	if len(f.openReports("f")) != 1 {
+		t.Fatal("report moved by a rolled back split")
+	}
+
+	created := f.expect(http.StatusCreated)(split("fresh")).(*models.Thread)
+	if created.Forum != "g" || len(f.openReports("f")) != 0 {
+		t.Fatalf("split %+v", created)
+	}
+	if reports := f.openReports("g"); len(reports) != 1 || reports[0].Post != post.Id {
+		t.Fatalf("reports %+v", reports)
+	}
+}
+
+func TestSplitHiddenPostNeedsMessage(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+	post := f.post(thread, "bob", 0, "off topic")
+	report := f.expect(http.StatusCreated)(f.reports.Create(&models.Report{Post: post.Id, NickName: "carol",
+		Reason: "spam"})).(*models.Report)
+	f.expect(http.StatusOK)(f.reports.Resolve(&models.Report{Id: report.Id},
+		&models.ReportResolution{NickName: "alice", Action: "hide"}))
+
+	split := func(message string) (int, interface{}) {
+		return f.posts.Split(&models.Post{Id: post.Id},
+			&models.ThreadSplit{NickName: "alice", Title: "split", Message: message})
+	}
+	f.expect(http.StatusBadRequest)(split(""))
+	if created := f.expect(http.StatusCreated)(split("moved here")).(*models.Thread); created.Message != "moved here" {
+		t.Fatalf("split %+v", created)
+	}
+}
@@ -0,0 +1,141 @@
+package usecases
+
+import (
+	_const "github.com/ApTyp5/new_db_techno/const"
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/ApTyp5/new_db_techno/internals/repositories"
+	"github.com/jackc/pgx"
+	"net/http"
+	"strings"
+)
+
+type ReportUseCase interface {
+	Create(report *models.Report) (int, interface{}) // /post/{id}/report
+	// /forum/{slug}/reports
+	ByForum(slug string, viewer string, status string, limit int, since int, desc bool) (int, interface{})
+	Resolve(report *models.Report, resolution *models.ReportResolution) (int, interface{}) // /report/{id}/resolve
+}
+
+type RDBReportUseCase struct {
+	rps repositories.ReportRepo
+	ps  repositories.PostRepo
+	us  repositories.UserRepo
+	fs  repositories.ForumRepo
+	rs  repositories.RoleRepo
+}
+
+func CreateRDBReportUseCase(db *pgx.ConnPool) ReportUseCase {
+	return RDBReportUseCase{
+		rps: repositories.CreatePSQLReportRepo(db),
+		ps:  repositories.CreatePSQLPostRepo(db),
+		us:  repositories.CreatePSQLUserRepo(db),
+		fs:  repositories.CreatePSQLForumRepo(db),
+		rs:  repositories.CreatePSQLRoleRepo(db),
+	}
+}
+
+func (uc RDBReportUseCase) Create(report *models.Report) (int, interface{}) {
+	if strings.TrimSpace(report.Reason) == "" {
+		return http.StatusBadRequest, wrapStrError("reason is required")
+	}
+
+	if err := uc.ps.SelectById(&models.Post{Id: report.Post}); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("post not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if err := uc.us.SelectByNickname(&models.User{NickName: report.NickName}); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	created := false
+	if err := uc.rps.Insert(report, &created); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if created {
+		return http.StatusCreated, report
+	}
+	return http.StatusOK, report
+}
+
+func (uc RDBReportUseCase) ByForum(slug string, viewer string, status string, limit int, since int, desc bool) (int, interface{}) {
+	if status == "" {
+		status = models.ReportOpen
+	}
+	if status != models.ReportOpen && status != "resolved" {
+		return http.StatusBadRequest, wrapStrError("status must be open or resolved")
+	}
+
+	forum := &models.Forum{Slug: slug}
+	if err := uc.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if role, err := forumRole(uc.rs, forum.Slug, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !canModerate(role) {
+		return http.StatusForbidden, wrapStrError("only forum owner or moderators can see reports")
+	}
+
+	reports := make([]models.Report, 0, _const.BuffSize)
+	if err := uc.rps.SelectByForum(&reports, forum, status, limit, since, desc); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, reports
+}
+
+func (uc RDBReportUseCase) Resolve(report *models.Report, resolution *models.ReportResolution) (int, interface{}) {
+	switch resolution.Action {
+	case "dismiss":
+		report.Status = models.ReportDismissed
+	case "hide":
+		report.Status = models.ReportHidden
+	case "ban":
+		report.Status = models.ReportBanned
+	default:
+		return http.StatusBadRequest, wrapStrError("action must be dismiss, hide or ban")
+	}
+	status := report.Status
+
+	if err := uc.rps.SelectById(report); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("report not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	report.Status = status
+
+	actorRole, err := forumRole(uc.rs, report.Forum, resolution.NickName)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if !canModerate(actorRole) {
+		return http.StatusForbidden, wrapStrError("only forum owner or moderators can resolve reports")
+	}
+
+	if report.Status == models.ReportBanned {
+		authorRole, err := forumRole(uc.rs, report.Forum, report.Author)
+		if err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+		if authorRole == models.RoleOwner || (authorRole == models.RoleModerator && actorRole != models.RoleOwner) {
+			return http.StatusForbidden, wrapStrError("post author can't be banned by you")
+		}
+	}
+
+	if err := uc.rps.Resolve(report, resolution); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, report
+}
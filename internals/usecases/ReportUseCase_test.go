@@ -0,0 +1,123 @@
+package usecases
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ApTyp5/new_db_techno/internals/models"
+)
+
+func (f *fixture) openReports(slug string) []models.Report {
+	f.t.Helper()
+	resp := f.expect(http.StatusOK)(f.reports.ByForum(slug, "alice", models.ReportOpen, 10, 0, false))
+	return resp.([]models.Report)
+}
+
+func TestReportLifecycle(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+	post := f.post(thread, "bob", 0, "spam")
+
+	report := func(reason string) (int, interface{}) {
+		return f.reports.Create(&models.Report{Post: post.Id, NickName: "carol", Reason: reason})
+	}
+
+	created := f.expect(http.StatusCreated)(report("spam")).(*models.Report)
+	f.expect(http.StatusOK)(report("still spam"))
+	if reports := f.openReports("f"); len(reports) != 1 || reports[0].Reason != "still spam" {
+		t.Fatalf("open reports %+v", reports)
+	}
+
+	f.expect(http.StatusForbidden)(f.reports.ByForum("f", "carol", models.ReportOpen, 10, 0, false))
+	f.expect(http.StatusForbidden)(f.reports.Resolve(&models.Report{Id: created.Id},
+		&models.ReportResolution{NickName: "carol", Action: "hide"}))
+
+	resolved := f.expect(http.StatusOK)(f.reports.Resolve(&models.Report{Id: created.Id},
+		&models.ReportResolution{NickName: "alice", Action: "hide"})).(*models.Report)
+	if resolved.Status != models.ReportHidden || resolved.ResolvedBy != "alice" || len(f.openReports("f")) != 0 {
+		t.Fatalf("resolved %+v", resolved)
+	}
+
+	// правка скрытого поста не возвращает его текст
+	edited := f.expect(http.StatusOK)(f.posts.Edit(&models.Post{Id: post.Id, Message: "new spam"})).(*models.Post)
+	if !edited.Hidden || edited.Message != "" || edited.MessageHTML != "" {
+		t.Fatalf("edited hidden post %+v", edited)
+	}
+
+	// повторная жалоба после решения снова открыта
+	reopened := f.expect(http.StatusOK)(report("back again")).(*models.Report)
+	if reopened.Id != created.Id || reopened.Status != models.ReportOpen || reopened.ResolvedBy != "" {
+		t.Fatalf("reopened %+v", reopened)
+	}
+	if reports := f.openReports("f"); len(reports) != 1 {
+		t.Fatalf("open after re-report %+v", reports)
+	}
+
+	f.expect(http.StatusOK)(f.reports.Resolve(&models.Report{Id: created.Id},
+		&models.ReportResolution{NickName: "alice", Action: "ban"}))
+	f.expect(http.StatusForbidden)(f.threads.AddPosts(&models.Thread{Id: thread.Id},
+		[]models.Post{{Author: "bob", Message: "post"}}))
+}
+
+func TestHeldContentApproval(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	f.expect(http.StatusOK)(f.forums.SetFilters("f", &models.FilterChange{NickName: "alice",
+		FilterConfig: models.FilterConfig{BannedWords: []string{"buy now"}, BannedWordsMode: "hold"}}))
+
+	held := f.thread(models.Thread{Forum: "f", Author: "bob", Message: "Buy  now, cheap"})
+	if !held.Hidden || !held.Closed {
+		t.Fatalf("held thread %+v", held)
+	}
+
+	// задержанная тема видна автору и модераторам, но не остальным
+	f.expect(http.StatusNotFound)(f.threads.Details(&models.Thread{Id: held.Id}, "carol"))
+	f.expect(http.StatusOK)(f.threads.Details(&models.Thread{Id: held.Id}, "bob"))
+	if got := f.forumThreads("f", 10, "", false, "carol"); len(got) != 0 {
+		t.Fatalf("public list %v", got)
+	}
+	if got := f.forumThreads("f", 10, "", false, "alice"); !sameInts(got, held.Id) {
+		t.Fatalf("moderator list %v", got)
+	}
+	if hot := f.expect(http.StatusOK)(f.threads.Hot(10, 0, "", "", "")).([]models.Thread); len(hot) != 0 {
+		t.Fatalf("hot %+v", hot)
+	}
+
+	// писать в задержанную тему могут тоже только автор и модераторы
+	no := false
+	f.expect(http.StatusOK)(f.threads.Moderate(&models.Thread{Id: held.Id},
+		&models.ThreadModeration{NickName: "alice", Closed: &no}))
+	f.expect(http.StatusNotFound)(f.threads.AddPosts(&models.Thread{Id: held.Id},
+		[]models.Post{{Author: "carol", Message: "reply"}}))
+	f.expect(http.StatusNotFound)(f.threads.AddPosts(&models.Thread{Id: held.Id},
+		[]models.Post{{Author: "bob", Message: "reply"}, {Author: "carol", Message: "reply"}}))
+	f.post(held, "bob", 0, "reply")
+	f.post(held, "alice", 0, "reply")
+
+	f.expect(http.StatusOK)(f.threads.Moderate(&models.Thread{Id: held.Id},
+		&models.ThreadModeration{NickName: "alice", Hidden: &no}))
+	if got := f.forumThreads("f", 10, "", false, "carol"); !sameInts(got, held.Id) {
+		t.Fatalf("approved list %v", got)
+	}
+
+	// задержанные посты одной пачки: оба скрыты, отклонение жалобы их одобряет
+	posts := f.addPosts(held, models.Post{Author: "carol", Message: "buy now"}, models.Post{Author: "bob", Message: "ok"})
+	if !posts[0].Hidden || posts[1].Hidden {
+		t.Fatalf("held posts %+v", posts)
+	}
+
+	reports := f.openReports("f")
+	if len(reports) != 1 || reports[0].Post != posts[0].Id {
+		t.Fatalf("held reports %+v", reports)
+	}
+	f.expect(http.StatusOK)(f.reports.Resolve(&models.Report{Id: reports[0].Id},
+		&models.ReportResolution{NickName: "alice", Action: "dismiss"}))
+
+	approved := f.expect(http.StatusOK)(f.posts.Details(&models.PostFull{Post: &models.Post{Id: posts[0].Id}}, nil, "")).(*models.PostFull)
+	if approved.Post.Hidden || approved.Post.Message != "buy now" {
+		t.Fatalf("approved post %+v", approved.Post)
+	}
+}
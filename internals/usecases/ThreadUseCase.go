@@ -1,36 +1,72 @@
 package usecases
 
 import (
+	_const "github.com/ApTyp5/new_db_techno/const"
+	"github.com/ApTyp5/new_db_techno/internals/filters"
+	"github.com/ApTyp5/new_db_techno/internals/markup"
 	"github.com/ApTyp5/new_db_techno/internals/models"
 	"github.com/ApTyp5/new_db_techno/internals/repositories"
 	"github.com/jackc/pgx"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 type ThreadUseCase interface {
 	// /thread/{slug_or_id}/create
 	AddPosts(thread *models.Thread, posts []models.Post) (int, interface{})
-	Details(thread *models.Thread) (int, interface{}) // /thread/{slug_or_id}/details
-	Edit(thread *models.Thread) (int, interface{})    // /thread/{slug_or_id}/details
+	Details(thread *models.Thread, viewer string) (int, interface{})                        // /thread/{slug_or_id}/details
+	Read(thread *models.Thread, read *models.ThreadRead) (int, interface{})                 // /thread/{slug_or_id}/read
+	Hot(limit int, since int, tag string, tagMode string, viewer string) (int, interface{}) // /threads/hot
+	Tags(forum string, limit int, viewer string) (int, interface{})                         // /tags
+	PollVote(thread *models.Thread, vote *models.PollVote) (int, interface{})               // /thread/{slug_or_id}/poll/vote
+	Accept(thread *models.Thread, accept *models.ThreadAccept) (int, interface{})           // /thread/{slug_or_id}/accept
+	Edit(thread *models.Thread) (int, interface{})                                          // /thread/{slug_or_id}/details
 	// /thread/{slug_or_id}/posts
-	Posts(posts *[]models.Post, thread *models.Thread, limit int, since int, sort string, desc bool) (int, interface{})
-	Vote(thread *models.Thread, vote *models.Vote) (int, interface{}) // /thread/{slug_or_id}/vote
+	// sort=top -- плоский список по рейтингу, sort=parent_tree_top -- parent_tree с корнями по рейтингу
+	Posts(posts *[]models.Post, thread *models.Thread, limit int, since int, sort string, desc bool,
+		viewer string) (int, interface{})
+	// /thread/{slug_or_id}/posts?sort=threaded
+	ThreadedPosts(thread *models.Thread, limit int, since int, replies int, desc bool, viewer string) (int, interface{})
+	Vote(thread *models.Thread, vote *models.Vote) (int, interface{})    // /thread/{slug_or_id}/vote
+	GetVote(thread *models.Thread, vote *models.Vote) (int, interface{}) // /thread/{slug_or_id}/vote
+	// /thread/{slug_or_id}/votes
+	Votes(thread *models.Thread, limit int, since string, desc bool, viewer string) (int, interface{})
+	// /thread/{slug_or_id}/moderation
+	Moderate(thread *models.Thread, moderation *models.ThreadModeration) (int, interface{})
+	Move(thread *models.Thread, move *models.ThreadMove) (int, interface{})         // /thread/{slug_or_id}/move
+	Merge(thread *models.Thread, merge *models.ThreadMerge) (int, interface{})      // /thread/{slug_or_id}/merge
+	Subscribe(thread *models.Thread, sub *models.Subscription) (int, interface{})   // /thread/{slug_or_id}/subscribe
+	Unsubscribe(thread *models.Thread, sub *models.Subscription) (int, interface{}) // /thread/{slug_or_id}/subscribe
 }
 
 type RDBThreadUseCase struct {
-	ts repositories.ThreadRepo
-	ps repositories.PostRepo
-	vs repositories.VoteRepo
-	us repositories.UserRepo
+	ts  repositories.ThreadRepo
+	ps  repositories.PostRepo
+	vs  repositories.VoteRepo
+	us  repositories.UserRepo
+	fs  repositories.ForumRepo
+	rs  repositories.RoleRepo
+	fls repositories.FilterRepo
+	ss  repositories.SubscriptionRepo
+	tgs repositories.TagRepo
+	pls repositories.PollRepo
+	bs  repositories.BlockRepo
 }
 
 func CreateRDBThreadUseCase(db *pgx.ConnPool) ThreadUseCase {
 	return RDBThreadUseCase{
-		ts: repositories.CreatePSQLThreadRepo(db),
-		ps: repositories.CreatePSQLPostRepo(db),
-		vs: repositories.CreatePSQLVoteRepo(db),
-		us: repositories.CreatePSQLUserRepo(db),
+		ts:  repositories.CreatePSQLThreadRepo(db),
+		ps:  repositories.CreatePSQLPostRepo(db),
+		vs:  repositories.CreatePSQLVoteRepo(db),
+		us:  repositories.CreatePSQLUserRepo(db),
+		fs:  repositories.CreatePSQLForumRepo(db),
+		rs:  repositories.CreatePSQLRoleRepo(db),
+		fls: repositories.CreatePSQLFilterRepo(db),
+		ss:  repositories.CreatePSQLSubscriptionRepo(db),
+		tgs: repositories.CreatePSQLTagRepo(db),
+		pls: repositories.CreatePSQLPollRepo(db),
+		bs:  repositories.CreatePSQLBlockRepo(db),
 	}
 }
 
@@ -42,6 +78,21 @@ func (uc RDBThreadUseCase) AddPosts(thread *models.Thread, posts []models.Post)
 		return http.StatusInternalServerError, wrapError(err)
 	}
 
+	// в задержанную тему пишут только те, кому она видна
+	for i := range posts {
+		if status, resp := checkHeld(uc.rs, thread, posts[i].Author); resp != nil {
+			return status, resp
+		}
+	}
+
+	if thread.Closed {
+		return http.StatusForbidden, wrapStrError("thread is closed")
+	}
+
+	if thread.Locked {
+		return http.StatusForbidden, wrapStrError("thread is locked")
+	}
+
 	nicks := make(map[string]bool)
 	for i := range posts {
 		if !nicks[posts[i].Author] {
@@ -52,6 +103,46 @@ func (uc RDBThreadUseCase) AddPosts(thread *models.Thread, posts []models.Post)
 		return http.StatusNotFound, wrapError(err)
 	}
 
+	var banned string
+	if err := uc.rs.SelectBanned(thread.Forum, nicks, &banned); err == nil {
+		return http.StatusForbidden, wrapStrError(banned + " is banned in this forum")
+	} else if err != pgx.ErrNoRows {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	forum := &models.Forum{Slug: thread.Forum}
+	if err := uc.fs.SelectBySlug(forum); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if status, resp := checkWrite(uc.rs, forum, nicks, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	pipeline, err := forumPipeline(uc.fls, thread.Forum, uc.fls.RecentPost)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	for i := range posts {
+		content := filters.Content{Forum: thread.Forum, Author: posts[i].Author, Message: posts[i].Message}
+		result, err := pipeline.Run(&content)
+		if err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+
+		switch result.Verdict {
+		case filters.Reject:
+			return http.StatusBadRequest, filterRejection(result)
+		case filters.Hold:
+			posts[i].Held = "held by filter " + result.Filter + ": " + result.Reason
+		}
+		posts[i].Message = content.Message
+	}
+
+	if err := renderPosts(posts); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
 	if err := uc.ps.InsertPostsByThread(thread, posts, nicks); err != nil {
 		if strings.Index(err.Error(), "posts_parent") >= 0 ||
 			strings.Index(err.Error(), "another") >= 0 {
@@ -64,27 +155,81 @@ func (uc RDBThreadUseCase) AddPosts(thread *models.Thread, posts []models.Post)
 	return http.StatusCreated, posts
 }
 
-func (uc RDBThreadUseCase) Details(thread *models.Thread) (int, interface{}) {
+func (uc RDBThreadUseCase) Details(thread *models.Thread, viewer string) (int, interface{}) {
 	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
 		if err == pgx.ErrNoRows {
 			return http.StatusNotFound, wrapStrError("thread not found")
 		}
 		return http.StatusInternalServerError, wrapError(err)
 	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, thread.Forum, viewer, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	if status, resp := checkHeld(uc.rs, thread, viewer); resp != nil {
+		return status, resp
+	}
+
+	if viewer != "" {
+		if err := uc.ts.SelectUnread(thread, viewer); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+	}
+
+	poll := &models.Poll{}
+	if err := uc.pls.SelectByThread(thread.Id, poll, viewer); err == nil {
+		thread.Poll = poll
+	} else if err != pgx.ErrNoRows {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	muted, err := mutedBy(uc.bs, viewer)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if muted[strings.ToLower(thread.Author)] {
+		collapseThread(thread)
+	}
+
 	return http.StatusOK, thread
 }
 
 func (uc RDBThreadUseCase) Edit(thread *models.Thread) (int, interface{}) {
+	if thread.Message != "" {
+		html, err := markup.Render(thread.Message)
+		if err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+		thread.MessageHTML = html
+	}
+
+	if thread.Tags != nil {
+		current := &models.Thread{Id: thread.Id, Slug: thread.Slug}
+		if err := uc.ts.SelectBySlugOrId(current); err != nil {
+			if err == pgx.ErrNoRows {
+				return http.StatusNotFound, wrapStrError("thread not found")
+			}
+			return http.StatusInternalServerError, wrapError(err)
+		}
+
+		if status, resp := checkTags(uc.tgs, current.Forum, &thread.Tags); resp != nil {
+			return status, resp
+		}
+	}
+
 	if err := uc.ts.Update(thread); err != nil {
 		if err == pgx.ErrNoRows {
 			return http.StatusNotFound, wrapStrError("thread not found")
 		}
 		return http.StatusInternalServerError, wrapError(err)
 	}
+
 	return http.StatusOK, thread
 }
 
-func (uc RDBThreadUseCase) Posts(posts *[]models.Post, thread *models.Thread, limit int, since int, sort string, desc bool) (int, interface{}) {
+func (uc RDBThreadUseCase) Posts(posts *[]models.Post, thread *models.Thread, limit int, since int, sort string, desc bool,
+	viewer string) (int, interface{}) {
 	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
 		if err == pgx.ErrNoRows {
 			return http.StatusNotFound, wrapStrError("thread not found")
@@ -92,16 +237,102 @@ func (uc RDBThreadUseCase) Posts(posts *[]models.Post, thread *models.Thread, li
 		return http.StatusInternalServerError, wrapError(err)
 	}
 
-	if err := uc.ps.SelectByThread(posts, thread, limit, since, desc, sort); err != nil {
+	if status, resp := checkVisible(uc.fs, uc.rs, thread.Forum, viewer, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	if status, resp := checkHeld(uc.rs, thread, viewer); resp != nil {
+		return status, resp
+	}
+
+	top := false
+	switch sort {
+	case "top":
+		sort, top = "flat", true
+	case "parent_tree_top":
+		sort, top = "parent_tree", true
+	}
+
+	if err := uc.ps.SelectByThread(posts, thread, limit, since, desc, sort, top, thread.AcceptedPost); err != nil {
 		if err != pgx.ErrNoRows {
 			return http.StatusInternalServerError, wrapError(err)
 		}
 	}
 
+	muted, err := mutedBy(uc.bs, viewer)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	collapseMuted(*posts, muted)
+
+	return http.StatusOK, posts
+}
+
+func (uc RDBThreadUseCase) ThreadedPosts(thread *models.Thread, limit int, since int, replies int, desc bool, viewer string) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, thread.Forum, viewer, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	if status, resp := checkHeld(uc.rs, thread, viewer); resp != nil {
+		return status, resp
+	}
+
+	if replies <= 0 {
+		replies = _const.RepliesPreview
+	}
+
+	posts := make([]models.ThreadedPost, 0, _const.BuffSize)
+	if err := uc.ps.SelectThreaded(&posts, thread, limit, since, replies, desc); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	muted, err := mutedBy(uc.bs, viewer)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	for i := range posts {
+		if muted[strings.ToLower(posts[i].Author)] {
+			collapsePost(&posts[i].Post)
+		}
+		collapseMuted(posts[i].Replies.Posts, muted)
+	}
+
 	return http.StatusOK, posts
 }
 
 func (uc RDBThreadUseCase) Vote(thread *models.Thread, vote *models.Vote) (int, interface{}) {
+	if vote.Voice < -1 || vote.Voice > 1 {
+		return http.StatusBadRequest, wrapStrError("voice must be 1, -1 or 0")
+	}
+
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user or thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, thread.Forum, vote.NickName, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	if thread.Closed {
+		return http.StatusForbidden, wrapStrError("thread is closed")
+	}
+
+	if role, err := forumRole(uc.rs, thread.Forum, vote.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if role == models.RoleBanned {
+		return http.StatusForbidden, wrapStrError("user is banned in this forum")
+	}
+
 	if err := uc.vs.InsertOrUpdate(vote, thread); err != nil {
 		if err == pgx.ErrNoRows {
 			return http.StatusNotFound, wrapStrError("user or thread not found")
@@ -111,3 +342,377 @@ func (uc RDBThreadUseCase) Vote(thread *models.Thread, vote *models.Vote) (int,
 
 	return http.StatusOK, thread
 }
+
+func (uc RDBThreadUseCase) GetVote(thread *models.Thread, vote *models.Vote) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, thread.Forum, vote.NickName, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	if err := uc.vs.SelectByThreadAndNickname(vote, thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, vote
+}
+
+func (uc RDBThreadUseCase) Votes(thread *models.Thread, limit int, since string, desc bool, viewer string) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, thread.Forum, viewer, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	votes := make([]models.Vote, 0, _const.BuffSize)
+	if err := uc.vs.SelectByThread(&votes, thread, limit, since, desc); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, votes
+}
+
+func (uc RDBThreadUseCase) Moderate(thread *models.Thread, moderation *models.ThreadModeration) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if role, err := forumRole(uc.rs, thread.Forum, moderation.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !canModerate(role) {
+		return http.StatusForbidden, wrapStrError("only forum owner or moderators can moderate threads")
+	}
+
+	if err := uc.ts.Moderate(thread, moderation); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, thread
+}
+
+// Move -- переносить может владелец или модератор форума, в котором тема сейчас,
+// если он может писать и в целевом форуме
+func (uc RDBThreadUseCase) Move(thread *models.Thread, move *models.ThreadMove) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	forum := &models.Forum{Slug: move.Forum}
+	if err := uc.fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("forum not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	move.Forum = forum.Slug
+
+	if strings.EqualFold(thread.Forum, forum.Slug) {
+		return http.StatusConflict, wrapStrError("thread is already in this forum")
+	}
+
+	if role, err := forumRole(uc.rs, thread.Forum, move.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !canModerate(role) {
+		return http.StatusForbidden, wrapStrError("only forum owner or moderators can move threads")
+	}
+
+	// в закрытый или только для чтения форум переносит только тот, кто может в нём писать
+	if status, resp := checkWrite(uc.rs, forum, map[string]bool{move.NickName: true}, "forum not found"); status != 0 {
+		return status, resp
+	}
+
+	if err := uc.ts.Move(thread, move); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusConflict, wrapStrError("thread was moved or deleted meanwhile")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, thread
+}
+
+// Merge -- нужны права модератора в форумах обеих тем
+func (uc RDBThreadUseCase) Merge(thread *models.Thread, merge *models.ThreadMerge) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	source := &models.Thread{Id: -1, Slug: merge.Source}
+	if id, err := strconv.Atoi(merge.Source); err == nil {
+		source.Id = id
+	}
+	if err := uc.ts.SelectBySlugOrId(source); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("source thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if source.Id == thread.Id {
+		return http.StatusConflict, wrapStrError("cannot merge thread into itself")
+	}
+
+	for _, forum := range []string{thread.Forum, source.Forum} {
+		if role, err := forumRole(uc.rs, forum, merge.NickName); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		} else if !canModerate(role) {
+			return http.StatusForbidden, wrapStrError("only forum owner or moderators can merge threads")
+		}
+	}
+
+	// опрос у темы может быть только один
+	polls := 0
+	for _, id := range []int{thread.Id, source.Id} {
+		if err := uc.pls.SelectByThread(id, &models.Poll{}, ""); err == nil {
+			polls++
+		} else if err != pgx.ErrNoRows {
+			return http.StatusInternalServerError, wrapError(err)
+		}
+	}
+	if polls == 2 {
+		return http.StatusConflict, wrapStrError("both threads have polls")
+	}
+
+	// теги source добавляются, если разрешены в форуме thread и ещё есть место
+	allowed := make([]string, 0)
+	if err := uc.tgs.SelectAllowed(thread.Forum, &allowed); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	known := make(map[string]bool, len(allowed))
+	for _, tag := range allowed {
+		known[tag] = true
+	}
+	has := make(map[string]bool, len(thread.Tags))
+	for _, tag := range thread.Tags {
+		has[tag] = true
+	}
+	for _, tag := range source.Tags {
+		if len(thread.Tags) < _const.MaxThreadTags && !has[tag] && (len(allowed) == 0 || known[tag]) {
+			has[tag] = true
+			thread.Tags = append(thread.Tags, tag)
+		}
+	}
+
+	if err := uc.ts.Merge(thread, source); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusConflict, wrapStrError("thread was moved or deleted meanwhile")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, thread
+}
+
+func (uc RDBThreadUseCase) Subscribe(thread *models.Thread, sub *models.Subscription) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, thread.Forum, sub.NickName, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	sub.Thread = thread.Id
+	return subscribe(uc.us, uc.ss, sub)
+}
+
+func (uc RDBThreadUseCase) Unsubscribe(thread *models.Thread, sub *models.Subscription) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	sub.Thread = thread.Id
+	return unsubscribe(uc.ss, sub)
+}
+
+func (uc RDBThreadUseCase) Read(thread *models.Thread, read *models.ThreadRead) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, thread.Forum, read.NickName, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	if err := uc.us.SelectByNickname(&models.User{NickName: read.NickName}); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	read.Thread = thread.Id
+	if err := uc.ts.MarkRead(read); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("post not found in this thread")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, read
+}
+
+func (uc RDBThreadUseCase) Hot(limit int, since int, tag string, tagMode string, viewer string) (int, interface{}) {
+	tags, err := parseTags(tag)
+	if err != nil {
+		return http.StatusBadRequest, wrapError(err)
+	}
+
+	muted, err := mutedBy(uc.bs, viewer)
+	if err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	threads := make([]models.Thread, 0, _const.BuffSize)
+	if err := uc.ts.SelectHot(&threads, "", viewer, limit, since, tags, tagMode == "or", _const.HotHalfLife); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	collapseMutedThreads(threads, muted)
+
+	return http.StatusOK, threads
+}
+
+func (uc RDBThreadUseCase) Tags(forum string, limit int, viewer string) (int, interface{}) {
+	if forum != "" {
+		if status, resp := checkVisible(uc.fs, uc.rs, forum, viewer, "forum not found"); resp != nil {
+			return status, resp
+		}
+	}
+
+	counts := make([]models.TagCount, 0, _const.BuffSize)
+	if err := uc.tgs.SelectCounts(&counts, forum, viewer, limit); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, counts
+}
+
+// PollVote -- голосовать можно до закрытия опроса, новый бюллетень заменяет старый
+func (uc RDBThreadUseCase) PollVote(thread *models.Thread, vote *models.PollVote) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if err := uc.us.SelectByNickname(&models.User{NickName: vote.NickName}); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if status, resp := checkVisible(uc.fs, uc.rs, thread.Forum, vote.NickName, "thread not found"); resp != nil {
+		return status, resp
+	}
+
+	if role, err := forumRole(uc.rs, thread.Forum, vote.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if role == models.RoleBanned {
+		return http.StatusForbidden, wrapStrError("user is banned in this forum")
+	}
+
+	poll := &models.Poll{}
+	if err := uc.pls.SelectByThread(thread.Id, poll, vote.NickName); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread has no poll")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if poll.Closed {
+		return http.StatusConflict, wrapStrError("poll is closed")
+	}
+
+	if len(vote.Options) == 0 || (!poll.Multiple && len(vote.Options) > 1) {
+		return http.StatusBadRequest, wrapStrError("choose one option, or several in a multiple choice poll")
+	}
+
+	known := make(map[int]bool, len(poll.Options))
+	for _, option := range poll.Options {
+		known[option.Id] = true
+	}
+	for _, option := range vote.Options {
+		if !known[option] {
+			return http.StatusBadRequest, wrapStrError("unknown poll option " + strconv.Itoa(option))
+		}
+	}
+
+	if err := uc.pls.Vote(thread.Id, vote); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if err := uc.pls.SelectByThread(thread.Id, poll, vote.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, poll
+}
+
+// Accept -- только в qa-форуме и только автор темы
+func (uc RDBThreadUseCase) Accept(thread *models.Thread, accept *models.ThreadAccept) (int, interface{}) {
+	if err := uc.ts.SelectBySlugOrId(thread); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("thread not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	forum := &models.Forum{Slug: thread.Forum}
+	if err := uc.fs.SelectBySlug(forum); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if ok, err := canRead(uc.rs, forum, accept.NickName); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError("thread not found")
+	}
+	if forum.Type != models.ForumQA {
+		return http.StatusConflict, wrapStrError("answers can be accepted only in qa forums")
+	}
+
+	if !strings.EqualFold(thread.Author, accept.NickName) {
+		return http.StatusForbidden, wrapStrError("only thread author can accept an answer")
+	}
+
+	if err := uc.ts.Accept(thread, accept.Post); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusBadRequest, wrapStrError("accepted answer must be a visible root post of this thread")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, thread
+}
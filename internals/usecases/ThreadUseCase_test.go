@@ -0,0 +1,534 @@
+package usecases
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	_const "github.com/ApTyp5/new_db_techno/const"
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/ApTyp5/new_db_techno/internals/repositories"
+)
+
+func TestThreadedPostsPreviewAndContinuation(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+
+	first := f.post(thread, "alice", 0, "first root")
+	second := f.post(thread, "bob", 0, "second root")
+	replies := make([]int, 0)
+	for i := 0; i < 3; i++ {
+		replies = append(replies, f.post(thread, "bob", first.Id, "reply").Id)
+	}
+	nested := f.post(thread, "alice", replies[0], "nested")
+
+	resp := f.expect(http.StatusOK)(f.threads.ThreadedPosts(&models.Thread{Id: thread.Id}, 10, 0, 2, false, ""))
+	roots := resp.([]models.ThreadedPost)
+	if len(roots) != 2 || roots[0].Id != first.Id || roots[1].Id != second.Id {
+		t.Fatalf("roots %+v", roots)
+	}
+
+	// ответы идут в порядке path: вложенный ответ -- сразу за своим родителем
+	if got := ids(roots[0].Replies.Posts); !sameInts(got, replies[0], nested.Id) {
+		t.Fatalf("preview %v", got)
+	}
+	if roots[0].Replies.Next != itoa(nested.Id) {
+		t.Fatalf("next %q, want %d", roots[0].Replies.Next, nested.Id)
+	}
+	if len(roots[1].Replies.Posts) != 0 || roots[1].Replies.Next != "" {
+		t.Fatalf("second root replies %+v", roots[1].Replies)
+	}
+
+	// продолжение по since -- следующий корень
+	resp = f.expect(http.StatusOK)(f.threads.ThreadedPosts(&models.Thread{Id: thread.Id}, 10, first.Id, 2, false, ""))
+	if roots := resp.([]models.ThreadedPost); len(roots) != 1 || roots[0].Id != second.Id {
+		t.Fatalf("since page %+v", roots)
+	}
+}
+
+func TestPostsTopSort(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+
+	low := f.post(thread, "alice", 0, "low")
+	high := f.post(thread, "bob", 0, "high")
+	lowReply := f.post(thread, "bob", low.Id, "low reply")
+	highReply := f.post(thread, "alice", high.Id, "high reply")
+	liked := f.post(thread, "carol", high.Id, "liked reply")
+
+	for _, nick := range []string{"alice", "carol"} {
+		f.expect(http.StatusOK)(f.posts.Vote(&models.Post{Id: high.Id}, &models.Vote{NickName: nick, Voice: 1}))
+		f.expect(http.StatusOK)(f.posts.Vote(&models.Post{Id: liked.Id}, &models.Vote{NickName: nick, Voice: 1}))
+	}
+	f.expect(http.StatusOK)(f.posts.Vote(&models.Post{Id: low.Id}, &models.Vote{NickName: "carol", Voice: -1}))
+
+	list := func(sort string, limit int, since int) []int {
+		t.Helper()
+		posts := make([]models.Post, 0)
+		f.expect(http.StatusOK)(f.threads.Posts(&posts, &models.Thread{Id: thread.Id}, limit, since, sort, false, ""))
+		return ids(posts)
+	}
+
+	if got := list("top", 2, 0); !sameInts(got, high.Id, liked.Id) {
+		t.Fatalf("top %v", got)
+	}
+	if got := list("top", 10, liked.Id); !sameInts(got, lowReply.Id, highReply.Id, low.Id) {
+		t.Fatalf("top since %v", got)
+	}
+
+	// по рейтингу сортируются только корни, ответы -- в порядке path
+	if got := list("parent_tree_top", 10, 0); !sameInts(got, high.Id, highReply.Id, liked.Id, low.Id, lowReply.Id) {
+		t.Fatalf("parent_tree_top %v", got)
+	}
+	if got := list("parent_tree_top", 1, highReply.Id); !sameInts(got, low.Id, lowReply.Id) {
+		t.Fatalf("parent_tree_top since %v", got)
+	}
+}
+
+func TestThreadVoteRetractionAndVoters(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+
+	vote := func(nick string, voice int) int {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.threads.Vote(&models.Thread{Id: thread.Id}, &models.Vote{NickName: nick, Voice: voice}))
+		return resp.(*models.Thread).Votes
+	}
+
+	vote("alice", 1)
+	vote("bob", -1)
+	if votes := vote("carol", 1); votes != 1 {
+		t.Fatalf("votes %d", votes)
+	}
+	if votes := vote("bob", 0); votes != 2 {
+		t.Fatalf("after retraction %d", votes)
+	}
+	if votes := vote("bob", 0); votes != 2 {
+		t.Fatalf("after second retraction %d", votes)
+	}
+
+	current := func(nick string) int {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.threads.GetVote(&models.Thread{Id: thread.Id}, &models.Vote{NickName: nick}))
+		return resp.(*models.Vote).Voice
+	}
+	if current("alice") != 1 || current("bob") != 0 {
+		t.Fatal("current votes")
+	}
+	f.expect(http.StatusNotFound)(f.threads.GetVote(&models.Thread{Id: thread.Id}, &models.Vote{NickName: "nobody"}))
+
+	resp := f.expect(http.StatusOK)(f.threads.Votes(&models.Thread{Id: thread.Id}, 1, "", false, ""))
+	if votes := resp.([]models.Vote); len(votes) != 1 || votes[0].NickName != "alice" {
+		t.Fatalf("first page %+v", votes)
+	}
+	resp = f.expect(http.StatusOK)(f.threads.Votes(&models.Thread{Id: thread.Id}, 10, "alice", false, ""))
+	if votes := resp.([]models.Vote); len(votes) != 1 || votes[0].NickName != "carol" || votes[0].Voice != 1 {
+		t.Fatalf("second page %+v", votes)
+	}
+
+	f.expect(http.StatusBadRequest)(f.threads.Vote(&models.Thread{Id: thread.Id}, &models.Vote{NickName: "bob", Voice: 2}))
+	f.expect(http.StatusNotFound)(f.threads.Vote(&models.Thread{Id: thread.Id}, &models.Vote{NickName: "nobody", Voice: 1}))
+}
+
+func TestUnreadSkipsHiddenAndMuted(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol", "dave")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+
+	unread := func() (int, int) {
+		t.Helper()
+		details := f.expect(http.StatusOK)(f.threads.Details(&models.Thread{Id: thread.Id}, "bob")).(*models.Thread)
+		return *details.UnreadCount, details.FirstUnreadPostId
+	}
+
+	posts := f.addPosts(thread,
+		models.Post{Author: "carol", Message: "1"},
+		models.Post{Author: "dave", Message: "2"},
+		models.Post{Author: "carol", Message: "3"})
+	more := f.addPosts(thread, models.Post{Author: "dave", Message: "4"}, models.Post{Author: "carol", Message: "5"})
+
+	if count, first := unread(); count != 5 || first != posts[0].Id {
+		t.Fatalf("unread %d, first %d", count, first)
+	}
+
+	read := f.expect(http.StatusOK)(f.threads.Read(&models.Thread{Id: thread.Id},
+		&models.ThreadRead{NickName: "bob", Post: posts[0].Id})).(*models.ThreadRead)
+	if read.UnreadCount != 4 {
+		t.Fatalf("after read %+v", read)
+	}
+
+	f.expect(http.StatusOK)(f.msgs.Block(&models.UserBlock{NickName: "bob", User: "dave", Kind: models.BlockMute}))
+	if count, first := unread(); count != 2 || first != posts[2].Id {
+		t.Fatalf("muted unread %d, first %d", count, first)
+	}
+
+	created := f.expect(http.StatusCreated)(f.reports.Create(&models.Report{Post: posts[2].Id, NickName: "alice",
+		Reason: "spam"})).(*models.Report)
+	f.expect(http.StatusOK)(f.reports.Resolve(&models.Report{Id: created.Id},
+		&models.ReportResolution{NickName: "alice", Action: "hide"}))
+	if count, first := unread(); count != 1 || first != more[1].Id {
+		t.Fatalf("hidden unread %d, first %d", count, first)
+	}
+
+	// пачки нумеруются подряд, без дыр между ними
+	var nums []int
+	rows, err := f.db.Query("select num from posts where thread = $1 order by id", thread.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var num int
+		if err := rows.Scan(&num); err != nil {
+			t.Fatal(err)
+		}
+		nums = append(nums, num)
+	}
+	if !sameInts(nums, 1, 2, 3, 4, 5) {
+		t.Fatalf("nums %v", nums)
+	}
+}
+
+func TestHotRankingIsStableBetweenRecomputes(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	halfLife := _const.HotHalfLife
+	recompute := func() {
+		t.Helper()
+		if _, err := repositories.CreatePSQLThreadRepo(f.db).RecomputeHot(halfLife); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// один голос сдвигает тему ровно на период полураспада: old с голосом уступает
+	// свежей теме без голосов, а новая тема без пересчёта встаёт по времени создания
+	old := f.thread(models.Thread{Forum: "f", Author: "alice", Created: time.Now().Add(-2 * halfLife)})
+	plain := f.thread(models.Thread{Forum: "f", Author: "alice"})
+	voted := f.thread(models.Thread{Forum: "f", Author: "alice"})
+	for _, thread := range []*models.Thread{old, voted} {
+		f.expect(http.StatusOK)(f.threads.Vote(&models.Thread{Id: thread.Id}, &models.Vote{NickName: "bob", Voice: 1}))
+	}
+	recompute()
+	fresh := f.thread(models.Thread{Forum: "f", Author: "alice"})
+
+	hot := f.expect(http.StatusOK)(f.threads.Hot(10, 0, "", "", "")).([]models.Thread)
+	got := make([]int, 0, len(hot))
+	for _, thread := range hot {
+		got = append(got, thread.Id)
+	}
+	if !sameInts(got, voted.Id, fresh.Id, plain.Id, old.Id) {
+		t.Fatalf("order %v", got)
+	}
+	if math.Abs(hot[0].HotScore-math.Ln2) > 0.01 || math.Abs(hot[3].HotScore+math.Ln2) > 0.01 {
+		t.Fatalf("decayed scores %+v", hot)
+	}
+
+	// пересчёт между страницами не сдвигает курсор
+	page := f.expect(http.StatusOK)(f.threads.Hot(2, 0, "", "", "")).([]models.Thread)
+	recompute()
+	next := f.expect(http.StatusOK)(f.threads.Hot(2, page[1].Id, "", "", "")).([]models.Thread)
+	if len(next) != 2 || next[0].Id != plain.Id || next[1].Id != old.Id {
+		t.Fatalf("next page %+v", next)
+	}
+}
+
+func TestMoveThreadChecksTargetAndMovesReports(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	f.forum(models.Forum{Slug: "g", User: "bob", Visibility: models.VisibilityPrivate})
+	f.forum(models.Forum{Slug: "h", User: "bob", Visibility: models.VisibilityReadOnly})
+	f.forum(models.Forum{Slug: "k", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+	post := f.post(thread, "bob", 0, "spam")
+	f.expect(http.StatusCreated)(f.reports.Create(&models.Report{Post: post.Id, NickName: "carol", Reason: "spam"}))
+
+	move := func(forum string) (int, interface{}) {
+		return f.threads.Move(&models.Thread{Id: thread.Id}, &models.ThreadMove{NickName: "alice", Forum: forum})
+	}
+
+	// в чужой закрытый форум перенос не виден, в форум только для чтения -- запрещён
+	f.expect(http.StatusNotFound)(move("g"))
+	f.expect(http.StatusForbidden)(move("h"))
+
+	moved := f.expect(http.StatusOK)(move("k")).(*models.Thread)
+	if moved.Forum != "k" {
+		t.Fatalf("moved %+v", moved)
+	}
+	if len(f.openReports("f")) != 0 {
+		t.Fatal("report left in the old forum")
+	}
+	if reports := f.openReports("k"); len(reports) != 1 || reports[0].Post != post.Id {
+		t.Fatalf("reports %+v", reports)
+	}
+
+	// не модератор нового форума тему обратно не перенесёт
+	f.expect(http.StatusForbidden)(f.threads.Move(&models.Thread{Id: thread.Id},
+		&models.ThreadMove{NickName: "carol", Forum: "f"}))
+}
+
+func TestMergeKeepsTagsAndTargetAnswer(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "q", User: "alice", Type: models.ForumQA})
+	f.forum(models.Forum{Slug: "r", User: "alice", Type: models.ForumQA})
+	target := f.thread(models.Thread{Forum: "q", Author: "alice", Tags: []string{"b", "c"}})
+	source := f.thread(models.Thread{Forum: "r", Author: "alice", Tags: []string{"a", "b"}})
+	accept := func(thread *models.Thread, post int) {
+		t.Helper()
+		f.expect(http.StatusOK)(f.threads.Accept(&models.Thread{Id: thread.Id},
+			&models.ThreadAccept{NickName: "alice", Post: post}))
+	}
+	answer := f.post(source, "bob", 0, "answer")
+	accept(source, answer.Id)
+	f.expect(http.StatusCreated)(f.reports.Create(&models.Report{Post: answer.Id, NickName: "carol", Reason: "spam"}))
+
+	merge := func(source *models.Thread) *models.Thread {
+		t.Helper()
+		return f.expect(http.StatusOK)(f.threads.Merge(&models.Thread{Id: target.Id},
+			&models.ThreadMerge{NickName: "alice", Source: itoa(source.Id)})).(*models.Thread)
+	}
+	// ответ source после слияния уже не корневой пост и принятым не остаётся
+	merged := merge(source)
+	if len(merged.Tags) != 3 || merged.Tags[0] != "b" || merged.Tags[1] != "c" || merged.Tags[2] != "a" {
+		t.Fatalf("tags %v", merged.Tags)
+	}
+	if merged.AcceptedPost != 0 {
+		t.Fatalf("accepted post %d kept from source", merged.AcceptedPost)
+	}
+
+	// жалобы на посты source переезжают в очередь форума target
+	if len(f.openReports("r")) != 0 {
+		t.Fatal("report left in the source forum")
+	}
+	if reports := f.openReports("q"); len(reports) != 1 || reports[0].Post != answer.Id {
+		t.Fatalf("reports %+v", reports)
+	}
+
+	own := f.post(target, "bob", 0, "own answer")
+	accept(target, own.Id)
+	other := f.thread(models.Thread{Forum: "q", Author: "alice"})
+	accept(other, f.post(other, "bob", 0, "other answer").Id)
+	if merged := merge(other); merged.AcceptedPost != own.Id {
+		t.Fatalf("accepted post %d, want %d", merged.AcceptedPost, own.Id)
+	}
+
+	// старый id source ведёт редиректом в target
+	f.expect(http.StatusConflict)(f.threads.Merge(&models.Thread{Id: target.Id},
+		&models.ThreadMerge{NickName: "alice", Source: itoa(source.Id)}))
+}
+
+func TestThreadTagsAndBrowsing(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	f.forum(models.Forum{Slug: "g", User: "alice"})
+
+	f.expect(http.StatusForbidden)(f.forums.SetTags("f", &models.ForumTags{NickName: "bob", Tags: []string{"go"}}))
+	allowed := f.expect(http.StatusOK)(f.forums.SetTags("f",
+		&models.ForumTags{NickName: "alice", Tags: []string{"Go", "SQL", " go "}})).(*models.ForumTags)
+	if len(allowed.Tags) != 2 || allowed.Tags[0] != "go" || allowed.Tags[1] != "sql" {
+		t.Fatalf("allowed %v", allowed.Tags)
+	}
+
+	f.expect(http.StatusBadRequest)(f.forums.CreateThread(&models.Thread{Id: -1, Forum: "f", Author: "alice",
+		Title: "t", Message: "m", Created: time.Now(), Tags: []string{"rust"}}))
+	goOnly := f.thread(models.Thread{Forum: "f", Author: "alice", Tags: []string{"GO"}})
+	both := f.thread(models.Thread{Forum: "f", Author: "alice", Tags: []string{"go", "sql"}})
+	sqlOnly := f.thread(models.Thread{Forum: "f", Author: "alice", Tags: []string{"sql"}})
+	f.thread(models.Thread{Forum: "g", Author: "alice", Tags: []string{"rust"}})
+	if len(goOnly.Tags) != 1 || goOnly.Tags[0] != "go" {
+		t.Fatalf("normalized tags %v", goOnly.Tags)
+	}
+
+	tagged := func(tag string, mode string) []int {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.forums.Threads("f", 10, "", false, "", "", tag, mode, ""))
+		threads := *resp.(*[]models.Thread)
+		result := make([]int, 0, len(threads))
+		for i := range threads {
+			result = append(result, threads[i].Id)
+		}
+		return result
+	}
+	if got := tagged("go,sql", ""); !sameInts(got, both.Id) {
+		t.Fatalf("and %v", got)
+	}
+	if got := tagged("go,sql", "or"); !sameInts(got, goOnly.Id, both.Id, sqlOnly.Id) {
+		t.Fatalf("or %v", got)
+	}
+
+	f.expect(http.StatusBadRequest)(f.threads.Edit(&models.Thread{Id: sqlOnly.Id, Tags: []string{"rust"}}))
+	f.expect(http.StatusOK)(f.threads.Edit(&models.Thread{Id: sqlOnly.Id, Tags: []string{"go"}}))
+
+	counts := f.expect(http.StatusOK)(f.threads.Tags("f", 10, "")).([]models.TagCount)
+	if len(counts) != 2 || counts[0] != (models.TagCount{Tag: "go", Threads: 3}) ||
+		counts[1] != (models.TagCount{Tag: "sql", Threads: 1}) {
+		t.Fatalf("counts %+v", counts)
+	}
+	if all := f.expect(http.StatusOK)(f.threads.Tags("", 10, "")).([]models.TagCount); len(all) != 3 {
+		t.Fatalf("all counts %+v", all)
+	}
+}
+
+func TestPollVotingAndMerge(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	poll := func() *models.Poll {
+		return &models.Poll{Question: "?", Options: []models.PollOption{{Text: "yes"}, {Text: "no"}}}
+	}
+	target := f.thread(models.Thread{Forum: "f", Author: "alice"})
+	withPoll := f.thread(models.Thread{Forum: "f", Author: "alice", Poll: poll()})
+	other := f.thread(models.Thread{Forum: "f", Author: "alice", Poll: poll()})
+	yes, no := withPoll.Poll.Options[0].Id, withPoll.Poll.Options[1].Id
+
+	vote := func(options ...int) (int, interface{}) {
+		return f.threads.PollVote(&models.Thread{Id: withPoll.Id}, &models.PollVote{NickName: "bob", Options: options})
+	}
+	f.expect(http.StatusBadRequest)(vote(yes, no))
+	f.expect(http.StatusBadRequest)(vote(other.Poll.Options[0].Id))
+	f.expect(http.StatusOK)(vote(yes))
+	result := f.expect(http.StatusOK)(vote(no)).(*models.Poll)
+	if result.Voters != 1 || result.Options[0].Votes != 0 || result.Options[1].Votes != 1 ||
+		len(result.Choice) != 1 || result.Choice[0] != no {
+		t.Fatalf("revote %+v", result)
+	}
+
+	merge := func(into *models.Thread, source *models.Thread) (int, interface{}) {
+		return f.threads.Merge(&models.Thread{Id: into.Id}, &models.ThreadMerge{NickName: "alice", Source: itoa(source.Id)})
+	}
+	// у темы может быть только один опрос
+	f.expect(http.StatusConflict)(merge(other, withPoll))
+
+	f.expect(http.StatusOK)(merge(target, withPoll))
+	details := f.expect(http.StatusOK)(f.threads.Details(&models.Thread{Id: target.Id}, "bob")).(*models.Thread)
+	if details.Poll == nil || details.Poll.Voters != 1 || len(details.Poll.Choice) != 1 || details.Poll.Choice[0] != no {
+		t.Fatalf("merged poll %+v", details.Poll)
+	}
+}
+
+func TestAcceptedAnswerFirstAndCleared(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "q", User: "alice", Type: models.ForumQA})
+	f.forum(models.Forum{Slug: "d", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "q", Author: "alice"})
+	first := f.post(thread, "bob", 0, "first")
+	reply := f.post(thread, "carol", first.Id, "reply")
+	second := f.post(thread, "bob", 0, "second")
+	answer := f.post(thread, "carol", 0, "answer")
+	accept := func(id int) {
+		t.Helper()
+		f.expect(http.StatusOK)(f.threads.Accept(&models.Thread{Id: thread.Id},
+			&models.ThreadAccept{NickName: "alice", Post: id}))
+	}
+	accept(answer.Id)
+
+	list := func(sort string, limit int, since int) []int {
+		t.Helper()
+		posts := make([]models.Post, 0)
+		f.expect(http.StatusOK)(f.threads.Posts(&posts, &models.Thread{Id: thread.Id}, limit, since, sort, false, ""))
+		return ids(posts)
+	}
+
+	// принятый ответ занимает место на первой странице и не повторяется дальше
+	if got := list("flat", 2, 0); !sameInts(got, answer.Id, first.Id) {
+		t.Fatalf("flat first page %v", got)
+	}
+	if got := list("flat", 1, 0); !sameInts(got, answer.Id) {
+		t.Fatalf("flat limit 1 %v", got)
+	}
+	if got := list("flat", 10, first.Id); !sameInts(got, reply.Id, second.Id) {
+		t.Fatalf("flat next page %v", got)
+	}
+	if got := list("parent_tree", 2, 0); !sameInts(got, answer.Id, first.Id, reply.Id) {
+		t.Fatalf("parent_tree first page %v", got)
+	}
+
+	// скрытый ответ перестаёт быть принятым
+	report := f.expect(http.StatusCreated)(f.reports.Create(
+		&models.Report{Post: answer.Id, NickName: "bob", Reason: "spam"})).(*models.Report)
+	f.expect(http.StatusOK)(f.reports.Resolve(&models.Report{Id: report.Id},
+		&models.ReportResolution{NickName: "alice", Action: "hide"}))
+	details := f.expect(http.StatusOK)(f.threads.Details(&models.Thread{Id: thread.Id}, "")).(*models.Thread)
+	if details.AcceptedPost != 0 {
+		t.Fatalf("hidden answer still accepted %+v", details)
+	}
+
+	// и в обычном форуме принятого ответа нет
+	accept(second.Id)
+	moved := f.expect(http.StatusOK)(f.threads.Move(&models.Thread{Id: thread.Id},
+		&models.ThreadMove{NickName: "alice", Forum: "d"})).(*models.Thread)
+	if moved.AcceptedPost != 0 {
+		t.Fatalf("moved %+v", moved)
+	}
+}
+
+func TestMutedAuthorsCollapsed(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol", "dave")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "dave", Message: "muted thread"})
+	root := f.post(thread, "carol", 0, "root")
+	reply := f.post(thread, "dave", root.Id, "muted reply")
+	child := f.post(thread, "carol", reply.Id, "child")
+	second := f.post(thread, "dave", 0, "muted root")
+	f.expect(http.StatusOK)(f.msgs.Block(&models.UserBlock{NickName: "bob", User: "dave", Kind: models.BlockMute}))
+
+	// в parent_tree заглушки сохраняют id, parent и порядок, дерево не рвётся
+	tree := func(viewer string) []models.Post {
+		t.Helper()
+		posts := make([]models.Post, 0)
+		f.expect(http.StatusOK)(f.threads.Posts(&posts, &models.Thread{Id: thread.Id}, 10, 0, "parent_tree", false, viewer))
+		return posts
+	}
+	posts := tree("bob")
+	if !sameInts(ids(posts), ids(tree(""))...) || !sameInts(ids(posts), root.Id, reply.Id, child.Id, second.Id) {
+		t.Fatalf("tree %v", ids(posts))
+	}
+	for _, post := range posts {
+		muted := post.Author == "dave"
+		if post.Muted != muted || (post.Message == "") != muted {
+			t.Fatalf("post %+v", post)
+		}
+	}
+	if posts[1].Parent != root.Id || posts[2].Parent != reply.Id {
+		t.Fatalf("parents %+v", posts)
+	}
+
+	hot := f.expect(http.StatusOK)(f.threads.Hot(10, 0, "", "", "bob")).([]models.Thread)
+	if len(hot) != 1 || !hot[0].Muted || hot[0].Message != "" {
+		t.Fatalf("hot %+v", hot)
+	}
+
+	details := func(viewer string) *models.Thread {
+		t.Helper()
+		return f.expect(http.StatusOK)(f.threads.Details(&models.Thread{Id: thread.Id}, viewer)).(*models.Thread)
+	}
+	if got := details("bob"); !got.Muted || got.Message != "" {
+		t.Fatalf("details %+v", got)
+	}
+	if got := details("carol"); got.Muted || got.Message != "muted thread" {
+		t.Fatalf("details for carol %+v", got)
+	}
+
+	full := f.expect(http.StatusOK)(f.posts.Details(&models.PostFull{Post: &models.Post{Id: reply.Id}},
+		[]string{"thread"}, "bob")).(*models.PostFull)
+	if !full.Post.Muted || full.Post.Message != "" || !full.Thread.Muted || full.Thread.Message != "" {
+		t.Fatalf("post details %+v %+v", full.Post, full.Thread)
+	}
+
+	f.expect(http.StatusOK)(f.msgs.Unblock(&models.UserBlock{NickName: "bob", User: "dave"}))
+	if got := details("bob"); got.Muted || got.Message != "muted thread" {
+		t.Fatalf("details after unmute %+v", got)
+	}
+}
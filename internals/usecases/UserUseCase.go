@@ -1,25 +1,44 @@
 package usecases
 
 import (
+	_const "github.com/ApTyp5/new_db_techno/const"
 	"github.com/ApTyp5/new_db_techno/internals/models"
 	"github.com/ApTyp5/new_db_techno/internals/repositories"
 	"github.com/jackc/pgx"
 	"net/http"
+	"time"
 )
 
 type UserUseCase interface {
 	Create(users []models.User, user *models.User) (int, interface{}) // /user/{nickname}/create
 	Update(user *models.User) (int, interface{})                      // /user/{nickname}/profile
 	Get(user *models.User) (int, interface{})                         // /user/{nickname}/profile
+	// /user/{nickname}/mentions
+	Mentions(user *models.User, limit int, since int, desc bool, unread bool) (int, interface{})
+	ReadMentions(user *models.User, read *models.MentionsRead) (int, interface{}) // /user/{nickname}/mentions/read
+	Feed(user *models.User, cursor string, limit int) (int, interface{})          // /user/{nickname}/feed
+	// /user/{nickname}/posts, только из форумов, видимых viewer
+	Posts(user *models.User, forum string, viewer string, limit int, since int, desc bool) (int, interface{})
+	// /user/{nickname}/threads
+	Threads(user *models.User, forum string, viewer string, limit int, since int, desc bool) (int, interface{})
+	Stats(user *models.User, viewer string) (int, interface{}) // /user/{nickname}/stats
 }
 
 type RDBUserUseCase struct {
 	us repositories.UserRepo
+	ms repositories.MentionRepo
+	ss repositories.SubscriptionRepo
+	ps repositories.PostRepo
+	ts repositories.ThreadRepo
 }
 
 func CreateRDBUserUseCase(db *pgx.ConnPool) UserUseCase {
 	return RDBUserUseCase{
 		us: repositories.CreatePSQLUserRepo(db),
+		ms: repositories.CreatePSQLMentionRepo(db),
+		ss: repositories.CreatePSQLSubscriptionRepo(db),
+		ps: repositories.CreatePSQLPostRepo(db),
+		ts: repositories.CreatePSQLThreadRepo(db),
 	}
 }
 
@@ -73,3 +92,113 @@ func (uc RDBUserUseCase) Get(user *models.User) (int, interface{}) {
 
 	return http.StatusOK, user
 }
+
+func (uc RDBUserUseCase) Mentions(user *models.User, limit int, since int, desc bool, unread bool) (int, interface{}) {
+	if err := uc.us.SelectByNickname(user); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user with such nick not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	mentions := make([]models.Mention, 0, _const.BuffSize)
+	if err := uc.ms.SelectByUser(&mentions, user, limit, since, desc, unread); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, mentions
+}
+
+func (uc RDBUserUseCase) ReadMentions(user *models.User, read *models.MentionsRead) (int, interface{}) {
+	if err := uc.us.SelectByNickname(user); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user with such nick not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	unread := models.MentionsUnread{}
+	if err := uc.ms.MarkRead(user, read.Ids, &unread.Unread); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, unread
+}
+
+func (uc RDBUserUseCase) Feed(user *models.User, cursor string, limit int) (int, interface{}) {
+	var (
+		since *time.Time
+		kind  string
+		after int
+	)
+	if cursor != "" {
+		var err error
+		if since, kind, after, err = parseFeedCursor(cursor); err != nil {
+			return http.StatusBadRequest, wrapError(err)
+		}
+	}
+
+	if err := uc.us.SelectByNickname(user); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user with such nick not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if limit <= 0 {
+		limit = _const.FeedPage
+	}
+
+	feed := models.Feed{Items: make([]models.FeedItem, 0, limit)}
+	if err := uc.ss.SelectFeed(&feed, user, since, kind, after, limit); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, feed
+}
+
+func (uc RDBUserUseCase) Posts(user *models.User, forum string, viewer string, limit int, since int,
+	desc bool) (int, interface{}) {
+	if err := uc.us.SelectByNickname(user); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user with such nick not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	posts := make([]models.Post, 0, _const.BuffSize)
+	if err := uc.ps.SelectByAuthor(&posts, user, forum, viewer, limit, since, desc); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, posts
+}
+
+func (uc RDBUserUseCase) Threads(user *models.User, forum string, viewer string, limit int, since int,
+	desc bool) (int, interface{}) {
+	if err := uc.us.SelectByNickname(user); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user with such nick not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	threads := make([]models.Thread, 0, _const.BuffSize)
+	if err := uc.ts.SelectByAuthor(&threads, user, forum, viewer, limit, since, desc); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, threads
+}
+
+func (uc RDBUserUseCase) Stats(user *models.User, viewer string) (int, interface{}) {
+	stats := models.UserStats{NickName: user.NickName}
+	if err := uc.us.SelectStats(&stats, viewer); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user with such nick not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, stats
+}
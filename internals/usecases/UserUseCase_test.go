@@ -0,0 +1,169 @@
+package usecases
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ApTyp5/new_db_techno/internals/models"
+)
+
+func (f *fixture) mentions(nick string, limit int, since int, unread bool) []models.Mention {
+	f.t.Helper()
+	resp := f.expect(http.StatusOK)(f.users.Mentions(&models.User{NickName: nick}, limit, since, false, unread))
+	return resp.([]models.Mention)
+}
+
+func TestMentionsInbox(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	thread := f.thread(models.Thread{Forum: "f", Author: "alice"})
+
+	// неизвестный ник не мешает пачке, упоминание себя не создаётся
+	posts := f.addPosts(thread,
+		models.Post{Author: "bob", Message: "hi @ALICE and @nobody"},
+		models.Post{Author: "alice", Message: "self @alice"},
+		models.Post{Author: "carol", Message: "@alice @alice @bob"})
+
+	inbox := f.mentions("alice", 0, 0, false)
+	if len(inbox) != 2 || inbox[0].Post != posts[0].Id || inbox[1].Post != posts[2].Id || inbox[0].Read {
+		t.Fatalf("inbox %+v", inbox)
+	}
+	if bob := f.mentions("bob", 0, 0, false); len(bob) != 1 || bob[0].Author != "carol" {
+		t.Fatalf("bob inbox %+v", bob)
+	}
+
+	if page := f.mentions("alice", 1, inbox[0].Id, false); len(page) != 1 || page[0].Id != inbox[1].Id {
+		t.Fatalf("second page %+v", page)
+	}
+
+	unread := f.expect(http.StatusOK)(f.users.ReadMentions(&models.User{NickName: "alice"},
+		&models.MentionsRead{Ids: []int{inbox[0].Id}})).(models.MentionsUnread)
+	if unread.Unread != 1 {
+		t.Fatalf("unread %+v", unread)
+	}
+	if left := f.mentions("alice", 0, 0, true); len(left) != 1 || left[0].Id != inbox[1].Id {
+		t.Fatalf("unread inbox %+v", left)
+	}
+
+	f.expect(http.StatusNotFound)(f.users.Mentions(&models.User{NickName: "nobody"}, 0, 0, false, false))
+}
+
+func (f *fixture) feed(nick string, cursor string, limit int) models.Feed {
+	f.t.Helper()
+	return f.expect(http.StatusOK)(f.users.Feed(&models.User{NickName: nick}, cursor, limit)).(models.Feed)
+}
+
+func TestFeedSubscriptions(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob", "carol", "dave")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	f.expect(http.StatusOK)(f.forums.SetFilters("f", &models.FilterChange{NickName: "alice",
+		FilterConfig: models.FilterConfig{BannedWords: []string{"spam"}, BannedWordsMode: "hold"}}))
+
+	f.expect(http.StatusCreated)(f.forums.Subscribe("f", &models.Subscription{NickName: "carol"}))
+	f.expect(http.StatusOK)(f.forums.Subscribe("f", &models.Subscription{NickName: "carol"}))
+
+	thread := f.thread(models.Thread{Forum: "f", Author: "bob", Created: time.Now().Add(-time.Minute)})
+	// автор задержанного поста на тему не подписывается
+	held := f.post(thread, "dave", 0, "spam")
+	first := f.post(thread, "carol", 0, "first")
+	second := f.post(thread, "alice", 0, "second")
+
+	if items := f.feed("dave", "", 10).Items; len(items) != 0 {
+		t.Fatalf("held author feed %+v", items)
+	}
+
+	// bob подписан как автор темы, свои посты и темы в ленту не попадают
+	bob := f.feed("bob", "", 10).Items
+	if len(bob) != 2 || bob[0].Post.Id != second.Id || bob[1].Post.Id != first.Id {
+		t.Fatalf("bob feed %+v", bob)
+	}
+
+	// carol подписана на форум и на тему как автор поста
+	page := f.feed("carol", "", 1)
+	if len(page.Items) != 1 || page.Items[0].Post.Id != second.Id || page.Next == "" {
+		t.Fatalf("carol first page %+v", page)
+	}
+	page = f.feed("carol", page.Next, 10)
+	if len(page.Items) != 1 || page.Items[0].Kind != models.FeedThread || page.Items[0].Thread.Id != thread.Id ||
+		page.Next != "" {
+		t.Fatalf("carol second page %+v", page)
+	}
+	f.expect(http.StatusBadRequest)(f.users.Feed(&models.User{NickName: "carol"}, "1-post-2", 10))
+
+	// одобренный пост подписывает автора
+	report := f.openReports("f")[0]
+	f.expect(http.StatusOK)(f.reports.Resolve(&models.Report{Id: report.Id},
+		&models.ReportResolution{NickName: "alice", Action: "dismiss"}))
+	if items := f.feed("dave", "", 10).Items; len(items) != 2 || items[1].Post.Id != first.Id {
+		t.Fatalf("approved author feed %+v", items)
+	}
+	if report.Post != held.Id {
+		t.Fatalf("report %+v", report)
+	}
+}
+
+func TestUserActivity(t *testing.T) {
+	f := newFixture(t)
+	f.user("alice", "bob")
+	f.forum(models.Forum{Slug: "f", User: "alice"})
+	f.forum(models.Forum{Slug: "g", User: "bob"})
+
+	start := time.Now().Add(-time.Hour)
+	first := f.thread(models.Thread{Forum: "f", Author: "alice", Created: start})
+	second := f.thread(models.Thread{Forum: "g", Author: "alice", Created: start.Add(time.Minute)})
+	f.thread(models.Thread{Forum: "g", Author: "bob"})
+	f.expect(http.StatusOK)(f.threads.Vote(&models.Thread{Id: first.Id}, &models.Vote{NickName: "bob", Voice: 1}))
+	f.expect(http.StatusOK)(f.threads.Vote(&models.Thread{Id: second.Id}, &models.Vote{NickName: "bob", Voice: 1}))
+
+	posts := []models.Post{
+		f.post(first, "alice", 0, "1"),
+		f.post(second, "alice", 0, "2"),
+		f.post(first, "bob", 0, "3"),
+		f.post(second, "alice", 0, "4"),
+	}
+
+	userPosts := func(forum string, limit int, since int, desc bool) []int {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.users.Posts(&models.User{NickName: "alice"}, forum, "", limit, since, desc))
+		return ids(resp.([]models.Post))
+	}
+	if got := userPosts("", 2, 0, false); !sameInts(got, posts[0].Id, posts[1].Id) {
+		t.Fatalf("first page %v", got)
+	}
+	if got := userPosts("", 2, posts[1].Id, false); !sameInts(got, posts[3].Id) {
+		t.Fatalf("second page %v", got)
+	}
+	if got := userPosts("G", 0, 0, true); !sameInts(got, posts[3].Id, posts[1].Id) {
+		t.Fatalf("forum desc %v", got)
+	}
+
+	userThreads := func(forum string, since int, desc bool) []int {
+		t.Helper()
+		resp := f.expect(http.StatusOK)(f.users.Threads(&models.User{NickName: "alice"}, forum, "", 0, since, desc))
+		threads := resp.([]models.Thread)
+		result := make([]int, 0, len(threads))
+		for i := range threads {
+			result = append(result, threads[i].Id)
+		}
+		return result
+	}
+	if got := userThreads("", 0, true); !sameInts(got, second.Id, first.Id) {
+		t.Fatalf("threads desc %v", got)
+	}
+	if got := userThreads("", first.Id, false); !sameInts(got, second.Id) {
+		t.Fatalf("threads after first %v", got)
+	}
+	if got := userThreads("f", 0, false); !sameInts(got, first.Id) {
+		t.Fatalf("threads in f %v", got)
+	}
+
+	stats := f.expect(http.StatusOK)(f.users.Stats(&models.User{NickName: "alice"}, "")).(models.UserStats)
+	if stats.Posts != 3 || stats.Threads != 2 || stats.Votes != 2 || len(stats.Forums) != 2 {
+		t.Fatalf("stats %+v", stats)
+	}
+	f.expect(http.StatusNotFound)(f.users.Stats(&models.User{NickName: "nobody"}, ""))
+	f.expect(http.StatusNotFound)(f.users.Posts(&models.User{NickName: "nobody"}, "", "", 0, 0, false))
+}
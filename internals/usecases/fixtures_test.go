@@ -0,0 +1,119 @@
+package usecases
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ApTyp5/new_db_techno/internals/dbtest"
+	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/jackc/pgx"
+)
+
+// fixture -- сценарии поверх настоящей базы, см. dbtest
+type fixture struct {
+	t       *testing.T
+	db      *pgx.ConnPool
+	users   UserUseCase
+	forums  ForumUseCase
+	threads ThreadUseCase
+	posts   PostUseCase
+	reports ReportUseCase
+	msgs    MessageUseCase
+}
+
+func newFixture(t *testing.T) *fixture {
+	db := dbtest.Connect(t)
+	return &fixture{
+		t:       t,
+		db:      db,
+		users:   CreateRDBUserUseCase(db),
+		forums:  CreateRDBForumUseCase(db),
+		threads: CreateRDBThreadUseCase(db),
+		posts:   CreateRDBPostUseCase(db),
+		reports: CreateRDBReportUseCase(db),
+		msgs:    CreateRDBMessageUseCase(db),
+	}
+}
+
+// expect -- проверка кода ответа сценария, тело возвращается для дальнейших проверок
+func (f *fixture) expect(want int) func(int, interface{}) interface{} {
+	return func(status int, resp interface{}) interface{} {
+		f.t.Helper()
+		if status != want {
+			if e, ok := resp.(*models.Error); ok {
+				f.t.Fatalf("status %d, want %d: %s", status, want, e.Message)
+			}
+			f.t.Fatalf("status %d, want %d: %+v", status, want, resp)
+		}
+		return resp
+	}
+}
+
+func (f *fixture) user(nicks ...string) {
+	f.t.Helper()
+	for _, nick := range nicks {
+		f.expect(http.StatusCreated)(f.users.Create(make([]models.User, 0),
+			&models.User{NickName: nick, FullName: nick, Email: nick + "@example.com"}))
+	}
+}
+
+func (f *fixture) forum(forum models.Forum) *models.Forum {
+	f.t.Helper()
+	if forum.Title == "" {
+		forum.Title = forum.Slug
+	}
+	return f.expect(http.StatusCreated)(f.forums.Create(&forum)).(*models.Forum)
+}
+
+func (f *fixture) thread(thread models.Thread) *models.Thread {
+	f.t.Helper()
+	if thread.Title == "" {
+		thread.Title = "thread"
+	}
+	if thread.Message == "" {
+		thread.Message = "message"
+	}
+	// без created тема получила бы нулевое время
+	if thread.Created.IsZero() {
+		thread.Created = time.Now()
+	}
+	thread.Id = -1
+	return f.expect(http.StatusCreated)(f.forums.CreateThread(&thread)).(*models.Thread)
+}
+
+func (f *fixture) addPosts(thread *models.Thread, posts ...models.Post) []models.Post {
+	f.t.Helper()
+	return f.expect(http.StatusCreated)(f.threads.AddPosts(&models.Thread{Id: thread.Id}, posts)).([]models.Post)
+}
+
+// post -- один пост с текстом message и родителем parent
+func (f *fixture) post(thread *models.Thread, author string, parent int, message string) models.Post {
+	f.t.Helper()
+	return f.addPosts(thread, models.Post{Author: author, Parent: parent, Message: message})[0]
+}
+
+func ids(posts []models.Post) []int {
+	result := make([]int, 0, len(posts))
+	for i := range posts {
+		result = append(result, posts[i].Id)
+	}
+	return result
+}
+
+func sameInts(got []int, want ...int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func itoa(i int) string {
+	return strconv.Itoa(i)
+}
@@ -2,7 +2,17 @@ package usecases
 
 import (
 	"errors"
+	_const "github.com/ApTyp5/new_db_techno/const"
+	"github.com/ApTyp5/new_db_techno/internals/filters"
+	"github.com/ApTyp5/new_db_techno/internals/markup"
 	"github.com/ApTyp5/new_db_techno/internals/models"
+	"github.com/ApTyp5/new_db_techno/internals/repositories"
+	"github.com/jackc/pgx"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 func wrapError(err error) interface{} {
@@ -16,3 +26,315 @@ func wrapStrError(str string) interface{} {
 func unknownError() (int, interface{}) {
 	return 600, errors.New("Unknown error")
 }
+
+// forumRole -- действующая роль пользователя в форуме
+func forumRole(rs repositories.RoleRepo, forum string, nick string) (string, error) {
+	role := models.ForumRole{Forum: forum, User: nick}
+	if err := rs.SelectRole(&role); err != nil {
+		return "", err
+	}
+	return role.Role, nil
+}
+
+func canModerate(role string) bool {
+	return role == models.RoleOwner || role == models.RoleModerator
+}
+
+var (
+	memberRoles    = []string{models.RoleOwner, models.RoleModerator, models.RoleMember}
+	moderatorRoles = []string{models.RoleOwner, models.RoleModerator}
+)
+
+// allHaveRole -- у каждого из nicks есть явная действующая роль из roles
+func allHaveRole(rs repositories.RoleRepo, forum string, nicks map[string]bool, roles []string) (bool, error) {
+	var nick string
+	if err := rs.SelectWithoutRole(forum, nicks, roles, &nick); err == pgx.ErrNoRows {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// canRead -- приватный форум и всё в нём видно только участникам
+func canRead(rs repositories.RoleRepo, forum *models.Forum, viewer string) (bool, error) {
+	if forum.Visibility != models.VisibilityPrivate {
+		return true, nil
+	}
+	if viewer == "" {
+		return false, nil
+	}
+	return allHaveRole(rs, forum.Slug, map[string]bool{viewer: true}, memberRoles)
+}
+
+// checkVisible -- форум по slug для читателя viewer; не участнику приватного форума
+// отвечаем так же, как на несуществующий объект, чтобы не выдавать его существование
+func checkVisible(fs repositories.ForumRepo, rs repositories.RoleRepo, slug string, viewer string,
+	notFound string) (int, interface{}) {
+	forum := &models.Forum{Slug: slug}
+	if err := fs.SelectBySlug(forum); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError(notFound)
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if ok, err := canRead(rs, forum, viewer); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	} else if !ok {
+		return http.StatusNotFound, wrapStrError(notFound)
+	}
+
+	return 0, nil
+}
+
+// checkWrite -- в приватном форуме пишут только участники, в read_only -- владелец и модераторы
+func checkWrite(rs repositories.RoleRepo, forum *models.Forum, nicks map[string]bool, notFound string) (int, interface{}) {
+	switch forum.Visibility {
+	case models.VisibilityPrivate:
+		if ok, err := allHaveRole(rs, forum.Slug, nicks, memberRoles); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		} else if !ok {
+			return http.StatusNotFound, wrapStrError(notFound)
+		}
+	case models.VisibilityReadOnly:
+		if ok, err := allHaveRole(rs, forum.Slug, nicks, moderatorRoles); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		} else if !ok {
+			return http.StatusForbidden, wrapStrError("forum is read-only")
+		}
+	}
+
+	return 0, nil
+}
+
+// checkHeld -- задержанная фильтром тема видна только автору и модераторам форума
+func checkHeld(rs repositories.RoleRepo, thread *models.Thread, viewer string) (int, interface{}) {
+	if !thread.Hidden || viewer != "" && strings.EqualFold(viewer, thread.Author) {
+		return 0, nil
+	}
+
+	if viewer != "" {
+		if role, err := forumRole(rs, thread.Forum, viewer); err != nil {
+			return http.StatusInternalServerError, wrapError(err)
+		} else if canModerate(role) {
+			return 0, nil
+		}
+	}
+
+	return http.StatusNotFound, wrapStrError("thread not found")
+}
+
+// forumPipeline -- конвейер фильтров сообщений по настройкам форума
+func forumPipeline(fls repositories.FilterRepo, forum string, recent filters.RecentFunc) (filters.Pipeline, error) {
+	config := models.FilterConfig{}
+	if err := fls.SelectByForum(forum, &config); err != nil {
+		return nil, err
+	}
+	return filters.Build(&config, recent)
+}
+
+func filterRejection(result filters.Result) interface{} {
+	return wrapStrError("rejected by filter " + result.Filter + ": " + result.Reason)
+}
+
+// renderPosts -- HTML и упоминания считаются при записи и хранятся рядом с сообщением
+func renderPosts(posts []models.Post) error {
+	for i := range posts {
+		html, err := markup.Render(posts[i].Message)
+		if err != nil {
+			return err
+		}
+		posts[i].MessageHTML = html
+		posts[i].Mentions = markup.Mentions(posts[i].Message)
+	}
+	return nil
+}
+
+// mutedBy -- авторы, заглушённые или заблокированные viewer; без viewer -- никто
+func mutedBy(bs repositories.BlockRepo, viewer string) (map[string]bool, error) {
+	muted := make(map[string]bool)
+	if viewer == "" {
+		return muted, nil
+	}
+	if err := bs.SelectMuted(viewer, muted); err != nil {
+		return nil, err
+	}
+	return muted, nil
+}
+
+// collapseMuted -- пост заглушённого автора остаётся в выдаче заглушкой, чтобы не рвать дерево
+// и пагинацию: id, parent и path сохраняются, содержимое -- нет
+func collapseMuted(posts []models.Post, muted map[string]bool) {
+	if len(muted) == 0 {
+		return
+	}
+	for i := range posts {
+		if muted[strings.ToLower(posts[i].Author)] {
+			collapsePost(&posts[i])
+		}
+	}
+}
+
+func collapsePost(post *models.Post) {
+	post.Muted = true
+	post.Message, post.MessageHTML, post.Reactions = "", "", nil
+}
+
+func collapseMutedThreads(threads []models.Thread, muted map[string]bool) {
+	if len(muted) == 0 {
+		return
+	}
+	for i := range threads {
+		if muted[strings.ToLower(threads[i].Author)] {
+			collapseThread(&threads[i])
+		}
+	}
+}
+
+func collapseThread(thread *models.Thread) {
+	thread.Muted = true
+	thread.Message, thread.MessageHTML, thread.Poll = "", "", nil
+}
+
+// subscribe -- 201 для новой подписки, 200 если она уже была
+func subscribe(us repositories.UserRepo, ss repositories.SubscriptionRepo, sub *models.Subscription) (int, interface{}) {
+	if err := us.SelectByNickname(&models.User{NickName: sub.NickName}); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("user not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	created := false
+	if err := ss.Insert(sub, &created); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	if created {
+		return http.StatusCreated, sub
+	}
+	return http.StatusOK, sub
+}
+
+func unsubscribe(ss repositories.SubscriptionRepo, sub *models.Subscription) (int, interface{}) {
+	if err := ss.Delete(sub); err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, wrapStrError("subscription not found")
+		}
+		return http.StatusInternalServerError, wrapError(err)
+	}
+
+	return http.StatusOK, sub
+}
+
+// parseFeedCursor -- разбор курсора ленты вида <микросекунды>_<kind>_<id>;
+// микросекунды бывают отрицательными, поэтому разделитель не минус
+func parseFeedCursor(cursor string) (*time.Time, string, int, error) {
+	parts := strings.Split(cursor, "_")
+	if len(parts) != 3 || (parts[1] != models.FeedPost && parts[1] != models.FeedThread) {
+		return nil, "", 0, errors.New("invalid cursor")
+	}
+
+	micro, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, "", 0, errors.New("invalid cursor")
+	}
+
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, "", 0, errors.New("invalid cursor")
+	}
+
+	since := time.UnixMicro(micro)
+	return &since, parts[1], id, nil
+}
+
+// normalizeTags -- теги хранятся в нижнем регистре без повторов; nil остаётся nil
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || strings.Contains(tag, ",") || utf8.RuneCountInString(tag) > _const.MaxTagLen {
+			return nil, errors.New("invalid tag " + strconv.Quote(tag))
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized, nil
+}
+
+// checkTags -- нормализует теги темы и сверяет их со списком разрешённых в форуме
+func checkTags(tgs repositories.TagRepo, forum string, tags *[]string) (int, interface{}) {
+	normalized, err := normalizeTags(*tags)
+	if err != nil {
+		return http.StatusBadRequest, wrapError(err)
+	}
+	*tags = normalized
+
+	if len(normalized) > _const.MaxThreadTags {
+		return http.StatusBadRequest, wrapStrError("too many tags")
+	}
+	if len(normalized) == 0 {
+		return http.StatusOK, nil
+	}
+
+	allowed := make([]string, 0)
+	if err := tgs.SelectAllowed(forum, &allowed); err != nil {
+		return http.StatusInternalServerError, wrapError(err)
+	}
+	if len(allowed) == 0 {
+		return http.StatusOK, nil
+	}
+
+	known := make(map[string]bool, len(allowed))
+	for _, tag := range allowed {
+		known[tag] = true
+	}
+	for _, tag := range normalized {
+		if !known[tag] {
+			return http.StatusBadRequest, wrapStrError("tag " + strconv.Quote(tag) + " is not allowed in this forum")
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// parseTags -- ?tag=a,b
+func parseTags(param string) ([]string, error) {
+	if param == "" {
+		return nil, nil
+	}
+	return normalizeTags(strings.Split(param, ","))
+}
+
+// checkPoll -- вопрос и от двух до MaxPollOptions непустых вариантов, закрытие -- в будущем
+func checkPoll(poll *models.Poll) error {
+	poll.Question = strings.TrimSpace(poll.Question)
+	if poll.Question == "" {
+		return errors.New("poll question is required")
+	}
+
+	if len(poll.Options) < 2 || len(poll.Options) > _const.MaxPollOptions {
+		return errors.New("poll must have from 2 to " + strconv.Itoa(_const.MaxPollOptions) + " options")
+	}
+	for i := range poll.Options {
+		poll.Options[i].Text = strings.TrimSpace(poll.Options[i].Text)
+		if poll.Options[i].Text == "" {
+			return errors.New("poll option text is required")
+		}
+	}
+
+	if poll.Closes != nil && !poll.Closes.After(time.Now()) {
+		return errors.New("poll closing time must be in the future")
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package usecases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ApTyp5/new_db_techno/internals/models"
+)
+
+func TestParseFeedCursor(t *testing.T) {
+	// тема без created получает нулевое время, микросекунды отрицательные
+	zero := time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+	since, kind, id, err := parseFeedCursor("-62135596800000000_thread_3")
+	if err != nil || !since.Equal(zero) || kind != models.FeedThread || id != 3 {
+		t.Fatalf("parsed %v %q %d %v", since, kind, id, err)
+	}
+
+	for _, cursor := range []string{"", "1_post", "1_message_2", "x_post_2", "1_post_x", "1-post-2"} {
+		if _, _, _, err := parseFeedCursor(cursor); err == nil {
+			t.Errorf("%q: no error", cursor)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	_const "github.com/ApTyp5/new_db_techno/const"
 	"github.com/ApTyp5/new_db_techno/database"
 	"github.com/ApTyp5/new_db_techno/internals/deliveries"
+	"github.com/ApTyp5/new_db_techno/internals/usecases"
 	_ "github.com/jackc/pgx"
 	"github.com/labstack/echo"
+	"os"
 	"time"
 )
 
@@ -25,19 +28,55 @@ func main() {
 	threadHandlers := deliveries.CreateThreadHandlerManager(db)
 	userHandlers := deliveries.CreateUserHandlerManager(db)
 	serviceHandlers := deliveries.CreateServiceHandlerManager(db)
+	reportHandlers := deliveries.CreateReportHandlerManager(db)
+	messageHandlers := deliveries.CreateMessageHandlerManager(db)
+
+	// тот же период нужен выдаче hot, чтобы показывать затухший рейтинг
+	if env := os.Getenv("HOT_HALF_LIFE"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			_const.HotHalfLife = d
+		} else {
+			fmt.Println("HOT_HALF_LIFE ignored:", env)
+		}
+	}
+	go usecases.CreateHotScoreJob(db, _const.HotHalfLife).Run(_const.HotRecomputeEvery)
 
 	{ // forum handlers
 		forumRouter := group.Group("/forum")
 		forumRouter.POST("/create", forumHandlers.Create())
 		forumRouter.POST("/:forum/create", forumHandlers.CreateThread())
 		forumRouter.GET("/:slug/details", forumHandlers.Details())
+		forumRouter.GET("/:slug/children", forumHandlers.Children())
 		forumRouter.GET("/:slug/threads", forumHandlers.Threads())
 		forumRouter.GET("/:slug/users", forumHandlers.Users())
+		forumRouter.POST("/:slug/roles", forumHandlers.GrantRole())
+		forumRouter.DELETE("/:slug/roles/:user", forumHandlers.RevokeRole())
+		forumRouter.POST("/:slug/invite", forumHandlers.Invite())
+		forumRouter.POST("/:slug/join", forumHandlers.Join())
+		forumRouter.GET("/:slug/invites", forumHandlers.Invites())
+		forumRouter.DELETE("/:slug/invites/:user", forumHandlers.CancelInvite())
+		forumRouter.GET("/:slug/reports", reportHandlers.ByForum())
+		forumRouter.GET("/:slug/filters", forumHandlers.Filters())
+		forumRouter.POST("/:slug/filters", forumHandlers.SetFilters())
+		forumRouter.GET("/:slug/tags", forumHandlers.Tags())
+		forumRouter.POST("/:slug/tags", forumHandlers.SetTags())
+		forumRouter.POST("/:slug/subscribe", forumHandlers.Subscribe())
+		forumRouter.GET("/:slug/stats", forumHandlers.Stats())
+		forumRouter.DELETE("/:slug/subscribe", forumHandlers.Unsubscribe())
 	}
 	{ // post handlers
 		postRouter := group.Group("/post")
 		postRouter.GET("/:id/details", postHandlers.Details())
 		postRouter.POST("/:id/details", postHandlers.Edit())
+		postRouter.GET("/:id/replies", postHandlers.Replies())
+		postRouter.POST("/:id/vote", postHandlers.Vote())
+		postRouter.DELETE("/:id/vote", postHandlers.Unvote())
+		postRouter.POST("/:id/split", postHandlers.Split())
+		postRouter.POST("/:id/report", reportHandlers.Create())
+	}
+	{ // report handlers
+		reportRouter := group.Group("/report")
+		reportRouter.POST("/:id/resolve", reportHandlers.Resolve())
 	}
 	{ // service handlers
 		serviceRouter := group.Group("/service")
@@ -51,12 +90,44 @@ func main() {
 		threadRouter.POST("/:slug_or_id/details", threadHandlers.Edit())
 		threadRouter.GET("/:slug_or_id/posts", threadHandlers.Posts())
 		threadRouter.POST("/:slug_or_id/vote", threadHandlers.Vote())
+		threadRouter.DELETE("/:slug_or_id/vote", threadHandlers.Unvote())
+		threadRouter.GET("/:slug_or_id/vote", threadHandlers.GetVote())
+		threadRouter.GET("/:slug_or_id/votes", threadHandlers.Votes())
+		threadRouter.POST("/:slug_or_id/poll/vote", threadHandlers.PollVote())
+		threadRouter.POST("/:slug_or_id/accept", threadHandlers.Accept())
+		threadRouter.POST("/:slug_or_id/moderation", threadHandlers.Moderate())
+		threadRouter.POST("/:slug_or_id/move", threadHandlers.Move())
+		threadRouter.POST("/:slug_or_id/merge", threadHandlers.Merge())
+		threadRouter.POST("/:slug_or_id/subscribe", threadHandlers.Subscribe())
+		threadRouter.DELETE("/:slug_or_id/subscribe", threadHandlers.Unsubscribe())
+		threadRouter.POST("/:slug_or_id/read", threadHandlers.Read())
 	}
+
+	{ // threads handlers
+		threadsRouter := group.Group("/threads")
+		threadsRouter.GET("/hot", threadHandlers.Hot())
+	}
+
+	group.GET("/tags", threadHandlers.Tags())
 	{ // user handlers
 		userRouter := group.Group("/user")
 		userRouter.POST("/:nickname/create", userHandlers.Create())
 		userRouter.GET("/:nickname/profile", userHandlers.Profile())
 		userRouter.POST("/:nickname/profile", userHandlers.UpdateProfile())
+		userRouter.GET("/:nickname/mentions", userHandlers.Mentions())
+		userRouter.POST("/:nickname/mentions/read", userHandlers.ReadMentions())
+		userRouter.GET("/:nickname/feed", userHandlers.Feed())
+		userRouter.GET("/:nickname/posts", userHandlers.Posts())
+		userRouter.GET("/:nickname/threads", userHandlers.Threads())
+		userRouter.GET("/:nickname/stats", userHandlers.Stats())
+		userRouter.GET("/:nickname/conversations", messageHandlers.Conversations())
+		userRouter.POST("/:nickname/block", messageHandlers.Block())
+		userRouter.DELETE("/:nickname/block", messageHandlers.Unblock())
+	}
+	{ // message handlers
+		group.POST("/messages", messageHandlers.Send())
+		conversationRouter := group.Group("/conversation")
+		conversationRouter.GET("/:id/messages", messageHandlers.Messages())
 	}
 
 	e.Logger.Fatal(e.Start(":80"))